@@ -22,6 +22,8 @@ import (
 	"chat/adapter/zhinao"
 	"chat/adapter/zhipuai"
 	"chat/globals"
+	"chat/utils"
+	"context"
 	"fmt"
 )
 
@@ -50,13 +52,32 @@ var channelFactories = map[string]adaptercommon.FactoryCreator{
 	globals.GroqChannelType:     openai.NewChatInstanceFromConfig, // openai format
 }
 
-func createChatRequest(conf globals.ChannelConfig, props *adaptercommon.ChatProps, hook globals.Hook) error {
+// toolsChannelTypes are the channel types whose adapters forward the tools (function calling)
+var toolsChannelTypes = []string{
+	globals.OpenAIChannelType,
+	globals.AzureOpenAIChannelType,
+	globals.ChatGLMChannelType,
+	globals.SparkdeskChannelType,
+	globals.SkylarkChannelType,
+	globals.MoonshotChannelType,
+	globals.GroqChannelType,
+	globals.ClaudeChannelType,
+	globals.PalmChannelType,
+}
+
+// SupportTools returns whether the adapter of the channel type supports the tools (function calling)
+func SupportTools(channelType string) bool {
+	return utils.Contains(channelType, toolsChannelTypes)
+}
+
+func createChatRequest(ctx context.Context, conf globals.ChannelConfig, props *adaptercommon.ChatProps, hook globals.Hook) error {
 	props.Model = conf.GetModelReflect(props.OriginalModel)
 	props.Proxy = conf.GetProxy()
+	props.Timeout = conf.GetTimeout()
 
 	factoryType := conf.GetType()
 	if factory, ok := channelFactories[factoryType]; ok {
-		return factory(conf).CreateStreamChatRequest(props, hook)
+		return factory(conf).CreateStreamChatRequest(ctx, props, hook)
 	}
 
 	return fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
@@ -77,3 +98,162 @@ func createVideoRequest(conf globals.ChannelConfig, props *adaptercommon.VideoPr
 
 	return fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
 }
+
+func createVideoRetrieveRequest(conf globals.ChannelConfig, props *adaptercommon.VideoJobProps) (string, error) {
+	props.Model = conf.GetModelReflect(props.OriginalModel)
+	props.Proxy = conf.GetProxy()
+
+	factoryType := conf.GetType()
+	if creator, ok := channelFactories[factoryType]; ok {
+		inst := creator(conf)
+		if v, ok := inst.(adaptercommon.VideoFactory); ok {
+			return v.RetrieveVideoRequest(props)
+		}
+		return "", fmt.Errorf("video request not supported by channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+	}
+
+	return "", fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+}
+
+func createVideoDeleteRequest(conf globals.ChannelConfig, props *adaptercommon.VideoJobProps) error {
+	props.Model = conf.GetModelReflect(props.OriginalModel)
+	props.Proxy = conf.GetProxy()
+
+	factoryType := conf.GetType()
+	if creator, ok := channelFactories[factoryType]; ok {
+		inst := creator(conf)
+		if v, ok := inst.(adaptercommon.VideoFactory); ok {
+			return v.DeleteVideoRequest(props)
+		}
+		return fmt.Errorf("video request not supported by channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+	}
+
+	return fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+}
+
+func createVideoContentRequest(conf globals.ChannelConfig, props *adaptercommon.VideoJobProps) ([]byte, error) {
+	props.Model = conf.GetModelReflect(props.OriginalModel)
+	props.Proxy = conf.GetProxy()
+
+	factoryType := conf.GetType()
+	if creator, ok := channelFactories[factoryType]; ok {
+		inst := creator(conf)
+		if v, ok := inst.(adaptercommon.VideoFactory); ok {
+			return v.GetVideoContentRequest(props)
+		}
+		return nil, fmt.Errorf("video request not supported by channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+	}
+
+	return nil, fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+}
+
+func createEmbeddingRequest(conf globals.ChannelConfig, props *adaptercommon.EmbeddingProps) (*adaptercommon.EmbeddingResponse, error) {
+	props.Model = conf.GetModelReflect(props.OriginalModel)
+	props.Proxy = conf.GetProxy()
+
+	factoryType := conf.GetType()
+	if creator, ok := channelFactories[factoryType]; ok {
+		inst := creator(conf)
+		if v, ok := inst.(adaptercommon.EmbeddingFactory); ok {
+			return v.CreateEmbeddingRequest(props)
+		}
+		return nil, fmt.Errorf("embedding request not supported by channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+	}
+
+	return nil, fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+}
+
+func createAudioRequest(conf globals.ChannelConfig, props *adaptercommon.AudioProps) (*adaptercommon.AudioResponse, error) {
+	props.Model = conf.GetModelReflect(props.OriginalModel)
+	props.Proxy = conf.GetProxy()
+
+	factoryType := conf.GetType()
+	if creator, ok := channelFactories[factoryType]; ok {
+		inst := creator(conf)
+		if v, ok := inst.(adaptercommon.AudioFactory); ok {
+			if props.IsSpeech() {
+				return v.CreateSpeechRequest(props)
+			}
+			return v.CreateTranscriptionRequest(props)
+		}
+		return nil, fmt.Errorf("audio request not supported by channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+	}
+
+	return nil, fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+}
+
+func createModerationRequest(conf globals.ChannelConfig, props *adaptercommon.ModerationProps) (*adaptercommon.ModerationResponse, error) {
+	props.Model = conf.GetModelReflect(props.OriginalModel)
+	props.Proxy = conf.GetProxy()
+
+	factoryType := conf.GetType()
+	if creator, ok := channelFactories[factoryType]; ok {
+		inst := creator(conf)
+		if v, ok := inst.(adaptercommon.ModerationFactory); ok {
+			return v.CreateModerationRequest(props)
+		}
+		return nil, fmt.Errorf("moderation request not supported by channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+	}
+
+	return nil, fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+}
+
+func createImageRequest(conf globals.ChannelConfig, props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	props.Model = conf.GetModelReflect(props.OriginalModel)
+	props.Proxy = conf.GetProxy()
+
+	factoryType := conf.GetType()
+	if creator, ok := channelFactories[factoryType]; ok {
+		inst := creator(conf)
+		if v, ok := inst.(adaptercommon.ImageFactory); ok {
+			if props.IsEdit() {
+				return v.CreateImageEditRequest(props)
+			} else if props.IsVariation() {
+				return v.CreateImageVariationRequest(props)
+			}
+			return v.CreateImageGenerationRequest(props)
+		}
+
+		if len(props.Image) > 0 {
+			return nil, fmt.Errorf("image edit and variation request not supported by channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+		}
+		return createChatImageRequest(inst, props)
+	}
+
+	return nil, fmt.Errorf("unknown channel type %s (channel #%d)", conf.GetType(), conf.GetId())
+}
+
+// createChatImageRequest generates the images through the chat request for the channels without the image factory
+func createChatImageRequest(factory adaptercommon.Factory, props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	resp := &adaptercommon.ImageResponse{}
+
+	for i := 0; i < props.GetN(); i++ {
+		var content string
+		if err := factory.CreateStreamChatRequest(context.Background(), &adaptercommon.ChatProps{
+			RequestProps: props.RequestProps,
+			Model:        props.Model,
+			Message:      []globals.Message{{Role: globals.User, Content: props.Prompt}},
+			MaxTokens:    utils.ToPtr(-1),
+			Buffer:       props.Buffer,
+			User:         props.User,
+		}, func(data *globals.Chunk) error {
+			content += data.Content
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		for _, url := range utils.ExtractImagesFromMarkdown(content) {
+			resp.Images = append(resp.Images, adaptercommon.ImageData{Url: url})
+		}
+		for _, data := range utils.ExtractBase64FromMarkdown(content) {
+			resp.Images = append(resp.Images, adaptercommon.ImageData{B64Json: utils.SafeSplit(data, ",", 2)[1]})
+		}
+	}
+
+	if len(resp.Images) == 0 {
+		return nil, fmt.Errorf("no image generated")
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,136 @@
+package azure
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/globals"
+	"chat/utils"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type SpeechRequest struct {
+	Model          string   `json:"model"`
+	Input          string   `json:"input"`
+	Voice          string   `json:"voice"`
+	ResponseFormat *string  `json:"response_format,omitempty"`
+	Speed          *float32 `json:"speed,omitempty"`
+}
+
+type TranscriptionResponse struct {
+	Text     string  `json:"text"`
+	Duration float32 `json:"duration"`
+	Error    struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+var speechContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/ogg",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
+
+func (c *ChatInstance) GetAudioEndpoint(model string, action string) string {
+	model = strings.ReplaceAll(model, ".", "")
+	return fmt.Sprintf("%s/openai/deployments/%s/audio/%s?api-version=%s", c.GetResource(), model, action, c.GetEndpoint())
+}
+
+// CreateTranscriptionRequest will create the transcription (or translation to english) of the audio file
+func (c *ChatInstance) CreateTranscriptionRequest(props *adaptercommon.AudioProps) (*adaptercommon.AudioResponse, error) {
+	fields := map[string]string{
+		"response_format": utils.GetPtrVal(props.ResponseFormat, ""),
+		"prompt":          utils.GetPtrVal(props.Prompt, ""),
+	}
+	if !props.Translate {
+		fields["language"] = utils.GetPtrVal(props.Language, "")
+	}
+	if props.Temperature != nil {
+		fields["temperature"] = utils.ToString(*props.Temperature)
+	}
+
+	body, contentType, err := utils.NewMultipartBody(
+		fields, utils.MultipartFile{Field: "file", Name: props.FileName, Data: props.File},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("azure error: %s", err.Error())
+	}
+
+	action := utils.Multi(props.Translate, "translations", "transcriptions")
+	data, err := utils.HttpRaw(
+		c.GetAudioEndpoint(props.Model, action), http.MethodPost,
+		map[string]string{
+			"Content-Type": contentType,
+			"api-key":      c.GetApiKey(),
+		}, body, []globals.ProxyConfig{props.Proxy},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("azure error: %s", err.Error())
+	}
+
+	format := utils.GetPtrVal(props.ResponseFormat, "")
+	isJson := format == "" || format == "json" || format == "verbose_json"
+	if form := utils.UnmarshalForm[TranscriptionResponse](string(data)); form != nil {
+		if form.Error.Message != "" {
+			return nil, fmt.Errorf("azure error: %s (type: %s)", form.Error.Message, form.Error.Type)
+		}
+
+		if isJson {
+			return &adaptercommon.AudioResponse{
+				Data:        data,
+				ContentType: "application/json",
+				Text:        form.Text,
+				Duration:    form.Duration,
+			}, nil
+		}
+	}
+
+	if isJson {
+		return nil, fmt.Errorf("azure error: cannot parse response")
+	}
+
+	return &adaptercommon.AudioResponse{
+		Data:        data,
+		ContentType: "text/plain; charset=utf-8",
+		Text:        string(data),
+	}, nil
+}
+
+// CreateSpeechRequest will create the speech audio of the input text
+func (c *ChatInstance) CreateSpeechRequest(props *adaptercommon.AudioProps) (*adaptercommon.AudioResponse, error) {
+	data, err := utils.HttpRaw(
+		c.GetAudioEndpoint(props.Model, "speech"), http.MethodPost, c.GetHeader(),
+		utils.ConvertBody(SpeechRequest{
+			Model:          props.Model,
+			Input:          props.Input,
+			Voice:          props.Voice,
+			ResponseFormat: props.ResponseFormat,
+			Speed:          props.Speed,
+		}), []globals.ProxyConfig{props.Proxy},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("azure error: %s", err.Error())
+	} else if len(data) == 0 {
+		return nil, fmt.Errorf("azure error: empty speech response")
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if form := utils.UnmarshalForm[ChatStreamErrorResponse](string(data)); form != nil && form.Error.Message != "" {
+			return nil, fmt.Errorf("azure error: %s (type: %s)", form.Error.Message, form.Error.Type)
+		}
+	}
+
+	contentType, ok := speechContentTypes[utils.GetPtrVal(props.ResponseFormat, "mp3")]
+	if !ok {
+		contentType = http.DetectContentType(data)
+	}
+
+	return &adaptercommon.AudioResponse{
+		Data:        data,
+		ContentType: contentType,
+	}, nil
+}
@@ -9,9 +9,72 @@ import (
 	"regexp"
 )
 
+// getPartContents converts the content parts to the openai content parts,
+// the images are counted for the vision models and dropped for the others
+func getPartContents(props *adaptercommon.ChatProps, parts []globals.ContentPart, vision bool) MessageContents {
+	return utils.EachNotNil(parts, func(part globals.ContentPart) *MessageContent {
+		if part.Type == globals.ContentTypeImageUrl && !vision {
+			return nil
+		}
+
+		content := MessageContent{
+			Type:       part.Type,
+			Text:       part.Text,
+			InputAudio: part.InputAudio,
+			File:       part.File,
+		}
+
+		if part.ImageUrl != nil {
+			content.ImageUrl = &ImageUrl{
+				Url:    part.ImageUrl.Url,
+				Detail: part.ImageUrl.Detail,
+			}
+
+			if vision {
+				obj, err := utils.NewImage(part.ImageUrl.Url)
+				if err != nil {
+					globals.Info(fmt.Sprintf("cannot process image: %s (source: %s)", err.Error(), utils.Extract(part.ImageUrl.Url, 24, "...")))
+				} else {
+					props.Buffer.AddImage(obj)
+				}
+			}
+		}
+
+		return &content
+	})
+}
+
+// getPartsMessage converts the message to the openai message, the content parts are kept if the message carries them
+func getPartsMessage(props *adaptercommon.ChatProps, message globals.Message, vision bool) Message {
+	var content interface{} = message.Content
+	if len(message.Parts) > 0 {
+		content = getPartContents(props, message.Parts, vision)
+	}
+
+	return Message{
+		Role:         message.Role,
+		Content:      content,
+		Name:         message.Name,
+		FunctionCall: message.FunctionCall,
+		ToolCalls:    message.ToolCalls,
+		ToolCallId:   message.ToolCallId,
+	}
+}
+
 func formatMessages(props *adaptercommon.ChatProps) interface{} {
-	if globals.IsVisionModel(props.Model) {
+	vision := globals.IsVisionModel(props.Model)
+	if !vision && globals.HasContentParts(props.Message) {
+		return utils.Each(props.Message, func(message globals.Message) Message {
+			return getPartsMessage(props, message, false)
+		})
+	}
+
+	if vision {
 		return utils.Each[globals.Message, Message](props.Message, func(message globals.Message) Message {
+			if len(message.Parts) > 0 {
+				return getPartsMessage(props, message, true)
+			}
+
 			if message.Role == globals.User {
 				raw, urls := utils.ExtractImages(message.Content, true)
 				images := utils.EachNotNil[string, MessageContent](urls, func(url string) *MessageContent {
@@ -75,26 +138,63 @@ func processChatErrorResponse(data string) *ChatStreamErrorResponse {
 	return utils.UnmarshalForm[ChatStreamErrorResponse](data)
 }
 
+// getUsage converts the openai usage to the chunk usage, nil if the usage is not reported
+func getUsage(usage *ChatUsage) *globals.ChunkUsage {
+	if usage == nil {
+		return nil
+	}
+
+	result := &globals.ChunkUsage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+	if usage.CompletionTokensDetails != nil {
+		result.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	if usage.PromptTokensDetails != nil {
+		result.CacheReadTokens = usage.PromptTokensDetails.CachedTokens
+	}
+
+	return result
+}
+
+// getReasoning returns the reasoning content of the delta, empty if the delta has no reasoning content
+func getReasoning(delta ChatStreamDelta) string {
+	if delta.ReasoningContent != nil {
+		return *delta.ReasoningContent
+	}
+
+	return utils.GetPtrVal(delta.Reasoning, "")
+}
+
 func getChoices(form *ChatStreamResponse) *globals.Chunk {
 	if len(form.Choices) == 0 {
-		return &globals.Chunk{Content: ""}
+		return &globals.Chunk{Content: "", Usage: getUsage(form.Usage)}
 	}
 
 	choice := form.Choices[0].Delta
 
 	return &globals.Chunk{
 		Content:      choice.Content,
+		Reasoning:    getReasoning(choice),
 		ToolCall:     choice.ToolCalls,
 		FunctionCall: choice.FunctionCall,
+		Index:        form.Choices[0].Index,
+		Logprobs:     form.Choices[0].Logprobs,
+		Usage:        getUsage(form.Usage),
 	}
 }
 
-func getCompletionChoices(form *CompletionResponse) string {
+func getCompletionChoices(form *CompletionResponse) *globals.Chunk {
 	if len(form.Choices) == 0 {
-		return ""
+		return &globals.Chunk{Content: "", Usage: getUsage(form.Usage)}
 	}
 
-	return form.Choices[0].Text
+	return &globals.Chunk{
+		Content: form.Choices[0].Text,
+		Index:   form.Choices[0].Index,
+		Usage:   getUsage(form.Usage),
+	}
 }
 
 func getRobustnessResult(chunk string) string {
@@ -116,9 +216,7 @@ func (c *ChatInstance) ProcessLine(data string, isCompletionType bool) (*globals
 	if isCompletionType {
 		// openai legacy support
 		if completion := processCompletionResponse(data); completion != nil {
-			return &globals.Chunk{
-				Content: getCompletionChoices(completion),
-			}, nil
+			return getCompletionChoices(completion), nil
 		}
 
 		globals.Warn(fmt.Sprintf("openai error: cannot parse completion response: %s", data))
@@ -8,16 +8,18 @@ type ImageUrl struct {
 }
 
 type MessageContent struct {
-	Type     string    `json:"type"`
-	Text     *string   `json:"text,omitempty"`
-	ImageUrl *ImageUrl `json:"image_url,omitempty"`
+	Type       string                     `json:"type"`
+	Text       *string                    `json:"text,omitempty"`
+	ImageUrl   *ImageUrl                  `json:"image_url,omitempty"`
+	InputAudio *globals.ContentInputAudio `json:"input_audio,omitempty"`
+	File       *globals.ContentFile       `json:"file,omitempty"`
 }
 
 type MessageContents []MessageContent
 
 type Message struct {
 	Role         string                `json:"role"`
-	Content      MessageContents       `json:"content"`
+	Content      interface{}           `json:"content"` // string or content parts
 	Name         *string               `json:"name,omitempty"`
 	FunctionCall *globals.FunctionCall `json:"function_call,omitempty"` // only `function` role
 	ToolCallId   *string               `json:"tool_call_id,omitempty"`  // only `tool` role
@@ -37,14 +39,32 @@ type ChatRequest struct {
 	TopP                *float32               `json:"top_p,omitempty"`
 	Tools               *globals.FunctionTools `json:"tools,omitempty"`
 	ToolChoice          *interface{}           `json:"tool_choice,omitempty"` // string or object
+	ParallelToolCalls   *bool                  `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat      *interface{}           `json:"response_format,omitempty"` // text, json_object or json_schema
+	Stop                []string               `json:"stop,omitempty"`
+	Seed                *int                   `json:"seed,omitempty"`
+	N                   *int                   `json:"n,omitempty"`
+	LogitBias           map[string]float32     `json:"logit_bias,omitempty"`
+	Logprobs            *bool                  `json:"logprobs,omitempty"`
+	TopLogprobs         *int                   `json:"top_logprobs,omitempty"`
+	StreamOptions       *StreamOptions         `json:"stream_options,omitempty"`
+	ReasoningEffort     *string                `json:"reasoning_effort,omitempty"` // low, medium or high (reasoning models)
 }
 
 // CompletionRequest is the request body for openai completion
 type CompletionRequest struct {
-	Model    string `json:"model"`
-	Prompt   string `json:"prompt"`
-	MaxToken *int   `json:"max_tokens,omitempty"`
-	Stream   bool   `json:"stream"`
+	Model         string         `json:"model"`
+	Prompt        string         `json:"prompt"`
+	MaxToken      *int           `json:"max_tokens,omitempty"`
+	Stream        bool           `json:"stream"`
+	Suffix        *string        `json:"suffix,omitempty"`
+	Temperature   *float32       `json:"temperature,omitempty"`
+	TopP          *float32       `json:"top_p,omitempty"`
+	N             *int           `json:"n,omitempty"`
+	Stop          []string       `json:"stop,omitempty"`
+	Seed          *int           `json:"seed,omitempty"`
+	User          interface{}    `json:"user,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
 }
 
 // ChatResponse is the native http request body for openai
@@ -70,10 +90,36 @@ type ChatStreamResponse struct {
 	Created int64  `json:"created"`
 	Model   string `json:"model"`
 	Choices []struct {
-		Delta        globals.Message `json:"delta"`
-		Index        int             `json:"index"`
-		FinishReason string          `json:"finish_reason"`
+		Delta        ChatStreamDelta         `json:"delta"`
+		Index        int                     `json:"index"`
+		FinishReason string                  `json:"finish_reason"`
+		Logprobs     *globals.ChoiceLogprobs `json:"logprobs"`
 	} `json:"choices"`
+	Usage *ChatUsage `json:"usage,omitempty"` // only the last chunk when stream_options.include_usage is enabled
+}
+
+// ChatStreamDelta is the delta of the stream response, the reasoning content is named `reasoning_content` or `reasoning` by the upstreams
+type ChatStreamDelta struct {
+	globals.Message
+	Reasoning *string `json:"reasoning,omitempty"`
+}
+
+// StreamOptions is the stream options for openai, include_usage makes the last chunk carry the usage
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatUsage is the usage reported by openai
+type ChatUsage struct {
+	PromptTokens            int `json:"prompt_tokens"`
+	CompletionTokens        int `json:"completion_tokens"`
+	TotalTokens             int `json:"total_tokens"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"` // included in the prompt tokens
+	} `json:"prompt_tokens_details,omitempty"`
 }
 
 // CompletionResponse is the native http request body / stream response body for openai completion
@@ -86,6 +132,7 @@ type CompletionResponse struct {
 		Text  string `json:"text"`
 		Index int    `json:"index"`
 	} `json:"choices"`
+	Usage *ChatUsage `json:"usage,omitempty"`
 }
 
 type ChatStreamErrorResponse struct {
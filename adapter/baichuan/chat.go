@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"errors"
 	"fmt"
 )
@@ -65,8 +66,10 @@ func (c *ChatInstance) CreateChatRequest(props *adaptercommon.ChatProps) (string
 }
 
 // CreateStreamChatRequest is the stream response body for baichuan
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	err := utils.EventScanner(&utils.EventScannerProps{
+		Ctx:     ctx,
+		Timeout: props.Timeout,
 		Method:  "POST",
 		Uri:     c.GetChatEndpoint(),
 		Headers: c.GetHeader(),
@@ -4,13 +4,14 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 	"strings"
 )
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, hook globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, hook globals.Hook) error {
 	var conn *utils.WebSocket
-	if conn = utils.NewWebsocketClient(c.GetEndpoint()); conn == nil {
+	if conn = utils.NewWebsocketClient(ctx, c.GetEndpoint()); conn == nil {
 		return fmt.Errorf("bing error: websocket connection failed")
 	}
 	defer conn.DeferClose()
@@ -4,11 +4,17 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"errors"
 	"fmt"
 )
 
-const defaultTokens = 2500
+const (
+	defaultTokens     = 2500
+	minThinkingBudget = 1024 // the minimum budget_tokens of anthropic api
+
+	maxCacheBreakpoints = 4 // the maximum cache_control blocks of anthropic api
+)
 
 func (c *ChatInstance) GetChatEndpoint() string {
 	return fmt.Sprintf("%s/v1/messages", c.GetEndpoint())
@@ -53,51 +59,44 @@ func (c *ChatInstance) GetTokens(props *adaptercommon.ChatProps) int {
 	return *props.MaxTokens
 }
 
-func (c *ChatInstance) ConvertMessages(props *adaptercommon.ChatProps) []globals.Message {
-	// anthropic api: top message must be user message, only `user` and `assistant` role messages are allowd
-	start := false
-
-	result := make([]globals.Message, 0)
-
-	for _, message := range props.Message {
-		if message.Role == globals.System {
-			continue
-		}
-
-		// if is first message, set it to user message
-		if !start {
-			start = true
-			result = append(result, globals.Message{
-				Role:    globals.User,
-				Content: message.Content,
-			})
-			continue
-		}
+// getTextContents returns the text block of the content, the empty text blocks are not allowed by anthropic api
+func getTextContents(content string) []MessageContent {
+	if len(content) == 0 {
+		return nil
+	}
 
-		// anthropic api does not allow multi-same role messages
-		if len(result) > 0 && result[len(result)-1].Role == message.Role {
-			result[len(result)-1].Content += "\n" + message.Content
-			continue
-		}
+	return []MessageContent{{
+		Type: "text",
+		Text: &content,
+	}}
+}
 
-		result = append(result, message)
+// getToolInput converts the json arguments of the tool call to the `tool_use` input object
+func getToolInput(arguments string) interface{} {
+	if input, err := utils.UnmarshalString[map[string]interface{}](arguments); err == nil && input != nil {
+		return input
 	}
 
-	return result
+	return map[string]interface{}{}
 }
 
-func (c *ChatInstance) GetMessages(props *adaptercommon.ChatProps) []Message {
-	converted := c.ConvertMessages(props)
-	return utils.Each(converted, func(message globals.Message) Message {
-		if !globals.IsVisionModel(props.Model) || message.Role != globals.User {
-			return Message{
-				Role:    message.Role,
-				Content: message.Content,
+// getPartContents converts the content parts to the anthropic content blocks, the images are dropped for the non-vision models,
+// the files are sent as the document blocks and the audio parts are not supported
+func getPartContents(props *adaptercommon.ChatProps, parts []globals.ContentPart) []MessageContent {
+	return utils.EachNotNil(parts, func(part globals.ContentPart) *MessageContent {
+		switch part.Type {
+		case globals.ContentTypeText:
+			if part.Text == nil || len(*part.Text) == 0 {
+				return nil
+			}
+
+			return &MessageContent{Type: "text", Text: part.Text}
+		case globals.ContentTypeImageUrl:
+			if part.ImageUrl == nil || !globals.IsVisionModel(props.Model) {
+				return nil
 			}
-		}
 
-		content, urls := utils.ExtractImages(message.Content, true)
-		images := utils.EachNotNil(urls, func(url string) *MessageContent {
+			url := part.ImageUrl.Url
 			obj, err := utils.NewImage(url)
 			props.Buffer.AddImage(obj)
 			if err != nil {
@@ -113,16 +112,242 @@ func (c *ChatInstance) GetMessages(props *adaptercommon.ChatProps) []Message {
 					Data:      i.ToRawBase64(),
 				},
 			}
+		case globals.ContentTypeFile:
+			if part.File == nil || part.File.FileData == nil {
+				return nil
+			}
+
+			mime, data, ok := utils.ParseDataUrl(*part.File.FileData)
+			if !ok {
+				return nil
+			}
+
+			return &MessageContent{
+				Type: "document",
+				Source: &MessageImage{
+					Type:      "base64",
+					MediaType: mime,
+					Data:      data,
+				},
+			}
+		}
+
+		globals.Info(fmt.Sprintf("[claude] unsupported content part type: %s", part.Type))
+		return nil
+	})
+}
+
+// GetContents converts the message to the anthropic content blocks,
+// the tool calls are converted to the `tool_use` blocks and the tool messages to the `tool_result` blocks
+func (c *ChatInstance) GetContents(props *adaptercommon.ChatProps, message globals.Message) []MessageContent {
+	switch message.Role {
+	case globals.Tool:
+		if message.ToolCallId == nil {
+			return getTextContents(message.Content)
+		}
+
+		content := message.Content
+		return []MessageContent{{
+			Type:      "tool_result",
+			ToolUseId: *message.ToolCallId,
+			Content:   &content,
+		}}
+	case globals.Assistant:
+		contents := getTextContents(message.Content)
+		if message.ToolCalls != nil {
+			for _, call := range *message.ToolCalls {
+				contents = append(contents, MessageContent{
+					Type:  "tool_use",
+					Id:    call.Id,
+					Name:  call.Function.Name,
+					Input: getToolInput(call.Function.Arguments),
+				})
+			}
+		}
+		return contents
+	}
+
+	if len(message.Parts) > 0 {
+		return getPartContents(props, message.Parts)
+	}
+
+	if !globals.IsVisionModel(props.Model) {
+		return getTextContents(message.Content)
+	}
+
+	content, urls := utils.ExtractImages(message.Content, true)
+	images := utils.EachNotNil(urls, func(url string) *MessageContent {
+		obj, err := utils.NewImage(url)
+		props.Buffer.AddImage(obj)
+		if err != nil {
+			globals.Info(fmt.Sprintf("cannot process image: %s (source: %s)", err.Error(), utils.Extract(url, 24, "...")))
+		}
+
+		i := utils.NewImageContent(url)
+		return &MessageContent{
+			Type: "image",
+			Source: &MessageImage{
+				Type:      "base64",
+				MediaType: i.GetType(),
+				Data:      i.ToRawBase64(),
+			},
+		}
+	})
+
+	return utils.PrependSlice(images, getTextContents(content))
+}
+
+func (c *ChatInstance) GetMessages(props *adaptercommon.ChatProps) []Message {
+	// anthropic api: top message must be user message, only `user` and `assistant` role messages are allowd,
+	// the tool results are sent as the user message
+	result := make([]Message, 0)
+
+	for _, message := range props.Message {
+		if message.Role == globals.System {
+			continue
+		}
+
+		role := utils.Multi(message.Role == globals.Assistant, globals.Assistant, globals.User)
+		if len(result) == 0 && role == globals.Assistant {
+			// if is first message, set it to user message
+			role = globals.User
+			message = globals.Message{
+				Role:         globals.User,
+				Content:      message.Content,
+				Parts:        message.Parts,
+				CacheControl: message.CacheControl,
+			}
+		}
+
+		contents := c.GetContents(props, message)
+		if len(contents) == 0 {
+			continue
+		}
+
+		if message.CacheControl != nil {
+			// the cache breakpoint is set on the last block of the message
+			contents[len(contents)-1].CacheControl = message.CacheControl
+		}
+
+		// anthropic api does not allow multi-same role messages
+		if len(result) > 0 && result[len(result)-1].Role == role {
+			result[len(result)-1].Content = append(result[len(result)-1].Content, contents...)
+			continue
+		}
+
+		result = append(result, Message{
+			Role:    role,
+			Content: contents,
 		})
+	}
 
-		return Message{
-			Role: message.Role,
-			Content: utils.Prepend(images, MessageContent{
-				Type: "text",
-				Text: &content,
-			}),
+	return result
+}
+
+// GetTools converts the openai function tools to the anthropic tools
+func (c *ChatInstance) GetTools(props *adaptercommon.ChatProps) []Tool {
+	if props.Tools == nil {
+		return nil
+	}
+
+	tools := utils.Each(*props.Tools, func(tool globals.ToolObject) Tool {
+		schema := tool.Function.Parameters
+		if schema.Properties == nil {
+			// anthropic api does not allow the null properties
+			schema.Properties = globals.ToolProperties{}
+		}
+
+		return Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
 		}
 	})
+
+	if len(tools) > 0 && props.CacheControl != nil && len(c.GetSystemPrompt(props)) == 0 {
+		// the tools are cached by the system prompt breakpoint if the system prompt exists
+		tools[len(tools)-1].CacheControl = props.CacheControl
+	}
+
+	return tools
+}
+
+// GetToolChoice converts the openai tool choice (and parallel tool calls) to the anthropic tool choice
+func (c *ChatInstance) GetToolChoice(props *adaptercommon.ChatProps) *ToolChoice {
+	if props.Tools == nil {
+		return nil
+	}
+
+	choice := &ToolChoice{Type: "auto"}
+	switch mode, name := props.GetToolChoice(); mode {
+	case "none":
+		return &ToolChoice{Type: "none"}
+	case "required":
+		choice.Type = "any"
+	case "function":
+		choice.Type = "tool"
+		choice.Name = name
+	}
+
+	if props.ParallelToolCalls != nil && !*props.ParallelToolCalls {
+		choice.DisableParallelToolUse = utils.ToPtr(true)
+	} else if choice.Type == "auto" {
+		// use the default tool choice of anthropic api
+		return nil
+	}
+
+	return choice
+}
+
+// GetSystem returns the system prompt, it is sent as the text block if it is a cache breakpoint
+func (c *ChatInstance) GetSystem(props *adaptercommon.ChatProps) interface{} {
+	prompt := c.GetSystemPrompt(props)
+
+	cache := props.CacheControl
+	for _, message := range props.Message {
+		if message.Role == globals.System && message.CacheControl != nil {
+			cache = message.CacheControl
+		}
+	}
+
+	if cache == nil || len(prompt) == 0 {
+		return prompt
+	}
+
+	return []MessageContent{{
+		Type:         "text",
+		Text:         &prompt,
+		CacheControl: cache,
+	}}
+}
+
+// limitCacheBreakpoints removes the earliest message breakpoints if the breakpoints exceed the limit
+func limitCacheBreakpoints(body *ChatBody) {
+	count := 0
+	if _, ok := body.System.([]MessageContent); ok {
+		count++
+	}
+	for _, tool := range body.Tools {
+		if tool.CacheControl != nil {
+			count++
+		}
+	}
+	for _, message := range body.Messages {
+		for _, content := range message.Content {
+			if content.CacheControl != nil {
+				count++
+			}
+		}
+	}
+
+	for i := 0; i < len(body.Messages) && count > maxCacheBreakpoints; i++ {
+		for j := range body.Messages[i].Content {
+			if body.Messages[i].Content[j].CacheControl != nil && count > maxCacheBreakpoints {
+				body.Messages[i].Content[j].CacheControl = nil
+				count--
+			}
+		}
+	}
 }
 
 func (c *ChatInstance) GetSystemPrompt(props *adaptercommon.ChatProps) (prompt string) {
@@ -134,24 +359,127 @@ func (c *ChatInstance) GetSystemPrompt(props *adaptercommon.ChatProps) (prompt s
 	return
 }
 
+// GetThinking returns the extended thinking config, nil if the thinking is disabled.
+// the thinking blocks are not kept in the history, so the thinking is also disabled when continuing a tool use turn
+func (c *ChatInstance) GetThinking(props *adaptercommon.ChatProps) *Thinking {
+	budget := props.GetThinkingBudget()
+	if budget <= 0 {
+		return nil
+	}
+
+	if length := len(props.Message); length > 0 && props.Message[length-1].Role == globals.Tool {
+		return nil
+	}
+
+	return &Thinking{
+		Type:         "enabled",
+		BudgetTokens: utils.Multi(budget < minThinkingBudget, minThinkingBudget, budget),
+	}
+}
+
 func (c *ChatInstance) GetChatBody(props *adaptercommon.ChatProps, stream bool) *ChatBody {
 	messages := c.GetMessages(props)
-	return &ChatBody{
-		Messages:    messages,
-		MaxTokens:   c.GetTokens(props),
-		Model:       props.Model,
-		System:      c.GetSystemPrompt(props),
-		Stream:      stream,
-		Temperature: props.Temperature,
-		TopP:        props.TopP,
-		TopK:        props.TopK,
+	// anthropic api does not support response_format, seed, n and logprobs
+	body := &ChatBody{
+		Messages:      messages,
+		MaxTokens:     c.GetTokens(props),
+		Model:         props.Model,
+		System:        c.GetSystem(props),
+		Stream:        stream,
+		Temperature:   props.Temperature,
+		TopP:          props.TopP,
+		TopK:          props.TopK,
+		StopSequences: props.Stop,
+		Tools:         c.GetTools(props),
+		ToolChoice:    c.GetToolChoice(props),
+		Thinking:      c.GetThinking(props),
 	}
+
+	if body.Thinking != nil {
+		// the thinking is not compatible with the sampling params and the forced tool use,
+		// and the max tokens must be greater than the thinking budget
+		body.Temperature, body.TopP, body.TopK = nil, nil, nil
+		if body.ToolChoice != nil && (body.ToolChoice.Type == "any" || body.ToolChoice.Type == "tool") {
+			body.ToolChoice.Type, body.ToolChoice.Name = "auto", ""
+		}
+		if body.MaxTokens <= body.Thinking.BudgetTokens {
+			body.MaxTokens = body.Thinking.BudgetTokens + defaultTokens
+		}
+	}
+
+	limitCacheBreakpoints(body)
+	return body
+}
+
+// getUsage returns the usage of the `message_start` or `message_delta` event, nil for the other events
+func getUsage(form *ChatStreamResponse) *globals.ChunkUsage {
+	if form.Message != nil && form.Message.Usage != nil {
+		// the output tokens of `message_start` are not final, only the input tokens are taken
+		usage := getInputUsage(form.Message.Usage)
+		return &usage
+	}
+
+	if form.Usage == nil {
+		return nil
+	}
+
+	usage := getInputUsage(form.Usage)
+	usage.OutputTokens = form.Usage.OutputTokens
+	return &usage
+}
+
+// getInputUsage returns the input usage, the cached tokens are added to the input tokens
+func getInputUsage(usage *ChatUsage) globals.ChunkUsage {
+	return globals.ChunkUsage{
+		InputTokens:      usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens,
+		CacheReadTokens:  usage.CacheReadInputTokens,
+		CacheWriteTokens: usage.CacheCreationInputTokens,
+	}
+}
+
+// getToolCalls converts the `tool_use` content block events to the tool call chunks,
+// the tools are the tool indexes of the content block indexes in the response
+func getToolCalls(form *ChatStreamResponse, tools map[int]int) *globals.ToolCalls {
+	switch form.Type {
+	case "content_block_start":
+		if form.ContentBlock == nil || form.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+
+		index := len(tools)
+		tools[form.Index] = index
+		return &globals.ToolCalls{{
+			Index: &index,
+			Type:  "function",
+			Id:    form.ContentBlock.Id,
+			Function: globals.ToolCallFunction{
+				Name: form.ContentBlock.Name,
+			},
+		}}
+	case "content_block_delta":
+		index, ok := tools[form.Index]
+		if !ok || form.Delta.Type != "input_json_delta" || form.Delta.PartialJson == "" {
+			return nil
+		}
+
+		return &globals.ToolCalls{{
+			Index: &index,
+			Function: globals.ToolCallFunction{
+				Arguments: form.Delta.PartialJson,
+			},
+		}}
+	}
+
+	return nil
 }
 
-func (c *ChatInstance) ProcessLine(data string) (*globals.Chunk, error) {
+func (c *ChatInstance) ProcessLine(data string, tools map[int]int) (*globals.Chunk, error) {
 	if form := processChatResponse(data); form != nil {
 		return &globals.Chunk{
-			Content: form.Delta.Text,
+			Content:   form.Delta.Text,
+			Reasoning: form.Delta.Thinking,
+			ToolCall:  getToolCalls(form, tools),
+			Usage:     getUsage(form),
 		}, nil
 	}
 
@@ -177,14 +505,17 @@ func processChatResponse(data string) *ChatStreamResponse {
 }
 
 // CreateStreamChatRequest is the stream request for anthropic claude
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, hook globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, hook globals.Hook) error {
+	tools := map[int]int{}
 	err := utils.EventScanner(&utils.EventScannerProps{
+		Ctx:     ctx,
+		Timeout: props.Timeout,
 		Method:  "POST",
 		Uri:     c.GetChatEndpoint(),
 		Headers: c.GetChatHeaders(),
 		Body:    c.GetChatBody(props, true),
 		Callback: func(data string) error {
-			partial, err := c.ProcessLine(data)
+			partial, err := c.ProcessLine(data, tools)
 			if err != nil {
 				return err
 			}
@@ -1,10 +1,12 @@
 package claude
 
+import "chat/globals"
+
 // ChatBody is the request body for anthropic claude
 
 type Message struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"`
+	Role    string           `json:"role"`
+	Content []MessageContent `json:"content"`
 }
 
 type MessageImage struct {
@@ -14,29 +16,78 @@ type MessageImage struct {
 }
 
 type MessageContent struct {
-	Type   string        `json:"type"`
-	Text   *string       `json:"text,omitempty"`
-	Source *MessageImage `json:"source,omitempty"`
+	Type      string        `json:"type"`
+	Text      *string       `json:"text,omitempty"`
+	Source    *MessageImage `json:"source,omitempty"`
+	Id        string        `json:"id,omitempty"`          // only `tool_use` type
+	Name      string        `json:"name,omitempty"`        // only `tool_use` type
+	Input     interface{}   `json:"input,omitempty"`       // only `tool_use` type
+	ToolUseId string        `json:"tool_use_id,omitempty"` // only `tool_result` type
+	Content   *string       `json:"content,omitempty"`     // only `tool_result` type
+
+	CacheControl *globals.CacheControl `json:"cache_control,omitempty"`
+}
+
+type Tool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema interface{} `json:"input_schema"`
+
+	CacheControl *globals.CacheControl `json:"cache_control,omitempty"`
+}
+
+type ToolChoice struct {
+	Type                   string `json:"type"` // auto, any, tool or none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse *bool  `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type Thinking struct {
+	Type         string `json:"type"` // enabled
+	BudgetTokens int    `json:"budget_tokens"`
 }
 
 type ChatBody struct {
-	Messages    []Message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens"`
-	Model       string    `json:"model"`
-	System      string    `json:"system"`
-	Stream      bool      `json:"stream"`
-	Temperature *float32  `json:"temperature,omitempty"`
-	TopP        *float32  `json:"top_p,omitempty"`
-	TopK        *int      `json:"top_k,omitempty"`
+	Messages      []Message   `json:"messages"`
+	MaxTokens     int         `json:"max_tokens"`
+	Model         string      `json:"model"`
+	System        interface{} `json:"system"` // string or text blocks (with the cache breakpoint)
+	Stream        bool        `json:"stream"`
+	Temperature   *float32    `json:"temperature,omitempty"`
+	TopP          *float32    `json:"top_p,omitempty"`
+	TopK          *int        `json:"top_k,omitempty"`
+	StopSequences []string    `json:"stop_sequences,omitempty"`
+	Tools         []Tool      `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice `json:"tool_choice,omitempty"`
+	Thinking      *Thinking   `json:"thinking,omitempty"`
 }
 
 type ChatStreamResponse struct {
 	Type  string `json:"type"`
 	Index int    `json:"index"`
 	Delta struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJson string `json:"partial_json"` // only `input_json_delta` type
+		Thinking    string `json:"thinking"`     // only `thinking_delta` type
 	} `json:"delta"`
+	ContentBlock *struct {
+		Type string `json:"type"`
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block,omitempty"` // only `content_block_start` event
+	Message *struct {
+		Usage *ChatUsage `json:"usage"`
+	} `json:"message,omitempty"` // only `message_start` event
+	Usage *ChatUsage `json:"usage,omitempty"` // only `message_delta` event
+}
+
+// ChatUsage is the usage reported in the `message_start` (input) and `message_delta` (output) events
+type ChatUsage struct {
+	InputTokens              int `json:"input_tokens"` // excludes the cached tokens
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
 type ChatErrorResponse struct {
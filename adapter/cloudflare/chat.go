@@ -3,11 +3,12 @@ package cloudflare
 import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
+	"context"
 	"fmt"
 )
 
 // CreateStreamChatRequest handles both text chat and image generation requests
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, hook globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, hook globals.Hook) error {
 	// Check if this is an image generation request
 	if c.IsImageModel(props.Model) {
 		return c.handleImageGeneration(props, hook)
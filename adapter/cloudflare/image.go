@@ -387,4 +387,55 @@ func (c *ChatInstance) GetLatestPrompt(props *adaptercommon.ChatProps) string {
 // IsImageModel checks if the model supports image generation
 func (c *ChatInstance) IsImageModel(model string) bool {
 	return globals.IsCloudflareImageModel(model)
-}
\ No newline at end of file
+}
+// variationPrompt is the prompt of the variation request, cloudflare requires the prompt for the img2img models
+const variationPrompt = "a variation of the input image"
+
+// createImages generates the images one by one (cloudflare workers ai returns a single image per request)
+func (c *ChatInstance) createImages(props *adaptercommon.ImageProps, prompt string) (*adaptercommon.ImageResponse, error) {
+	width, height := props.GetSize()
+
+	resp := &adaptercommon.ImageResponse{}
+	for i := 0; i < props.GetN(); i++ {
+		data, err := c.CreateImageRequest(ImageProps{
+			Model:      props.Model,
+			Prompt:     prompt,
+			Height:     height,
+			Width:      width,
+			InputImage: base64.StdEncoding.EncodeToString(props.Image),
+			MaskImage:  base64.StdEncoding.EncodeToString(props.Mask),
+			User:       props.User,
+			Proxy:      props.Proxy,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Images = append(resp.Images, adaptercommon.ImageData{B64Json: data})
+	}
+
+	return resp, nil
+}
+
+// CreateImageGenerationRequest will create the images from prompt
+func (c *ChatInstance) CreateImageGenerationRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	return c.createImages(props, props.Prompt)
+}
+
+// CreateImageEditRequest will edit the input image from prompt, the mask is used by the inpainting models
+func (c *ChatInstance) CreateImageEditRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	if !globals.IsCloudflareImg2ImgModel(props.Model) {
+		return nil, fmt.Errorf("cloudflare error: model %s does not support image input", props.Model)
+	}
+
+	return c.createImages(props, props.Prompt)
+}
+
+// CreateImageVariationRequest will create the variations of the input image
+func (c *ChatInstance) CreateImageVariationRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	if !globals.IsCloudflareImg2ImgModel(props.Model) {
+		return nil, fmt.Errorf("cloudflare error: model %s does not support image input", props.Model)
+	}
+
+	return c.createImages(props, variationPrompt)
+}
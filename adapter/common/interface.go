@@ -2,14 +2,40 @@ package adaptercommon
 
 import (
 	"chat/globals"
+	"context"
 )
 
 type Factory interface {
-	CreateStreamChatRequest(props *ChatProps, hook globals.Hook) error
+	// CreateStreamChatRequest aborts the upstream connection once the context is canceled
+	CreateStreamChatRequest(ctx context.Context, props *ChatProps, hook globals.Hook) error
 }
 
 type VideoFactory interface {
 	CreateVideoRequest(props *VideoProps, hook globals.Hook) error
+	// RetrieveVideoRequest returns the job json of the video job
+	RetrieveVideoRequest(props *VideoJobProps) (string, error)
+	DeleteVideoRequest(props *VideoJobProps) error
+	// GetVideoContentRequest returns the video file of the completed video job
+	GetVideoContentRequest(props *VideoJobProps) ([]byte, error)
+}
+
+type EmbeddingFactory interface {
+	CreateEmbeddingRequest(props *EmbeddingProps) (*EmbeddingResponse, error)
+}
+
+type AudioFactory interface {
+	CreateTranscriptionRequest(props *AudioProps) (*AudioResponse, error)
+	CreateSpeechRequest(props *AudioProps) (*AudioResponse, error)
+}
+
+type ImageFactory interface {
+	CreateImageGenerationRequest(props *ImageProps) (*ImageResponse, error)
+	CreateImageEditRequest(props *ImageProps) (*ImageResponse, error)
+	CreateImageVariationRequest(props *ImageProps) (*ImageResponse, error)
+}
+
+type ModerationFactory interface {
+	CreateModerationRequest(props *ModerationProps) (*ModerationResponse, error)
 }
 
 type FactoryCreator func(globals.ChannelConfig) Factory
@@ -13,13 +13,16 @@ package adaptercommon
 import (
 	"chat/globals"
 	"chat/utils"
+	"sort"
+	"strings"
 )
 
 type RequestProps struct {
-	MaxRetries *int                `json:"-"`
-	Current    int                 `json:"-"`
-	Group      string              `json:"-"`
-	Proxy      globals.ProxyConfig `json:"-"`
+	MaxRetries *int                  `json:"-"`
+	Current    int                   `json:"-"`
+	Group      string                `json:"-"`
+	Proxy      globals.ProxyConfig   `json:"-"`
+	Timeout    globals.TimeoutConfig `json:"-"`
 }
 
 type VideoProps struct {
@@ -32,10 +35,131 @@ type VideoProps struct {
 	Seconds        *string `json:"seconds,omitempty"`
 	Size           *string `json:"size,omitempty"`
 	InputReference *string `json:"input_reference,omitempty"`
+	RemixVideoId   *string `json:"-"` // remix the completed video job instead of creating a new one
 
 	User string `json:"-"`
 }
 
+// VideoJobProps is the follow-up request (retrieve or delete) of the video job created at the channel
+type VideoJobProps struct {
+	RequestProps
+
+	Model         string `json:"-"`
+	OriginalModel string `json:"-"`
+	Id            string `json:"-"`
+}
+
+type EmbeddingProps struct {
+	RequestProps
+
+	Model         string `json:"model,omitempty"`
+	OriginalModel string `json:"-"`
+
+	Input          interface{} `json:"input"` // string, []string, []int or [][]int
+	EncodingFormat *string     `json:"encoding_format,omitempty"`
+	Dimensions     *int        `json:"dimensions,omitempty"`
+
+	User string `json:"-"`
+}
+
+type EmbeddingData struct {
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"` // []float64 or base64 string
+}
+
+type EmbeddingResponse struct {
+	Data        []EmbeddingData `json:"data"`
+	InputTokens int             `json:"input_tokens"`
+}
+
+type AudioProps struct {
+	RequestProps
+
+	Model         string `json:"model,omitempty"`
+	OriginalModel string `json:"-"`
+
+	// transcription and translation
+	Translate   bool     `json:"-"`
+	File        []byte   `json:"-"`
+	FileName    string   `json:"-"`
+	Language    *string  `json:"language,omitempty"`
+	Prompt      *string  `json:"prompt,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+
+	// speech
+	Input string   `json:"input,omitempty"`
+	Voice string   `json:"voice,omitempty"`
+	Speed *float32 `json:"speed,omitempty"`
+
+	ResponseFormat *string `json:"response_format,omitempty"`
+
+	User string `json:"-"`
+}
+
+type AudioResponse struct {
+	Data        []byte  `json:"-"`
+	ContentType string  `json:"content_type"`
+	Text        string  `json:"text"`     // transcription text
+	Duration    float32 `json:"duration"` // seconds of the input audio, 0 if not reported by upstream
+}
+
+type ImageProps struct {
+	RequestProps
+
+	Model         string `json:"model,omitempty"`
+	OriginalModel string `json:"-"`
+
+	Prompt         string  `json:"prompt,omitempty"`
+	N              *int    `json:"n,omitempty"`
+	Size           *string `json:"size,omitempty"`
+	Quality        *string `json:"quality,omitempty"`
+	Style          *string `json:"style,omitempty"`
+	ResponseFormat *string `json:"response_format,omitempty"` // url or b64_json
+
+	// edits and variations
+	Image     []byte `json:"-"`
+	ImageName string `json:"-"`
+	Mask      []byte `json:"-"`
+	MaskName  string `json:"-"`
+
+	Buffer *utils.Buffer `json:"-"`
+	User   string        `json:"-"`
+}
+
+type ImageData struct {
+	Url           string `json:"url,omitempty"`
+	B64Json       string `json:"b64_json,omitempty"` // raw base64 data without the data uri prefix
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+type ImageResponse struct {
+	Images []ImageData `json:"images"`
+}
+
+type ModerationProps struct {
+	RequestProps
+
+	Model         string `json:"model,omitempty"`
+	OriginalModel string `json:"-"`
+
+	Input interface{} `json:"input"` // string, string array or multimodal content array
+
+	User string `json:"-"`
+}
+
+type ModerationResult struct {
+	Flagged                   bool                `json:"flagged"`
+	Categories                map[string]bool     `json:"categories"`
+	CategoryScores            map[string]float64  `json:"category_scores"`
+	CategoryAppliedInputTypes map[string][]string `json:"category_applied_input_types,omitempty"`
+}
+
+type ModerationResponse struct {
+	Id      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
+
 type ChatProps struct {
 	RequestProps
 
@@ -43,6 +167,8 @@ type ChatProps struct {
 	OriginalModel string `json:"-"`
 
 	Message           []globals.Message      `json:"messages,omitempty"`
+	Prompt            *string                `json:"prompt,omitempty"` // raw prompt of the legacy completions (completion-type models only)
+	Suffix            *string                `json:"suffix,omitempty"` // text after the completion (completion-type models only)
 	MaxTokens         *int                   `json:"max_tokens,omitempty"`
 	PresencePenalty   *float32               `json:"presence_penalty,omitempty"`
 	FrequencyPenalty  *float32               `json:"frequency_penalty,omitempty"`
@@ -52,6 +178,18 @@ type ChatProps struct {
 	TopK              *int                   `json:"top_k,omitempty"`
 	Tools             *globals.FunctionTools `json:"tools,omitempty"`
 	ToolChoice        *interface{}           `json:"tool_choice,omitempty"`
+	ParallelToolCalls *bool                  `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat    *interface{}           `json:"response_format,omitempty"`
+	Stop              []string               `json:"stop,omitempty"`
+	Seed              *int                   `json:"seed,omitempty"`
+	N                 *int                   `json:"n,omitempty"`
+	LogitBias         map[string]float32     `json:"logit_bias,omitempty"`
+	Logprobs          *bool                  `json:"logprobs,omitempty"`
+	TopLogprobs       *int                   `json:"top_logprobs,omitempty"`
+	ReasoningEffort   *string                `json:"reasoning_effort,omitempty"` // low, medium or high
+	ThinkingBudget    *int                   `json:"thinking_budget,omitempty"`  // reasoning token budget (claude thinking)
+	CacheControl      *globals.CacheControl  `json:"cache_control,omitempty"`    // prompt caching breakpoint of the tools and system prompt (claude)
+	IncludeUsage      bool                   `json:"-"`                          // the client requests the usage of the stream (stream_options.include_usage)
 	Buffer            *utils.Buffer          `json:"-"`
 	User              interface{}            `json:"user,omitempty"`
 	Ip                string                 `json:"-"`
@@ -62,6 +200,73 @@ func (c *ChatProps) SetupBuffer(buf *utils.Buffer) {
 	c.Buffer = buf
 }
 
+// GetThinkingBudget returns the reasoning token budget, the budget is derived from the reasoning effort if it is not set,
+// 0 means the thinking is disabled
+func (c *ChatProps) GetThinkingBudget() int {
+	if c.ThinkingBudget != nil {
+		return utils.Multi(*c.ThinkingBudget > 0, *c.ThinkingBudget, 0)
+	}
+
+	switch utils.GetPtrVal(c.ReasoningEffort, "") {
+	case "low":
+		return 1024
+	case "medium":
+		return 4096
+	case "high":
+		return 16384
+	}
+
+	return 0
+}
+
+// GetResponseFormat returns the response format type (`text`, `json_object` or `json_schema`) and the json schema
+func (c *ChatProps) GetResponseFormat() (string, interface{}) {
+	if c.ResponseFormat == nil {
+		return "", nil
+	}
+
+	form, ok := (*c.ResponseFormat).(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+
+	format, _ := form["type"].(string)
+	if schema, ok := form["json_schema"].(map[string]interface{}); ok {
+		return format, schema["schema"]
+	}
+
+	return format, nil
+}
+
+// GetToolChoice returns the tool choice mode (`auto`, `none`, `required` or `function`) and the forced function name,
+// the mode is empty if the tool choice is not set
+func (c *ChatProps) GetToolChoice() (string, string) {
+	if c.ToolChoice == nil {
+		return "", ""
+	}
+
+	switch v := (*c.ToolChoice).(type) {
+	case string:
+		return v, ""
+	case map[string]interface{}:
+		if function, ok := v["function"].(map[string]interface{}); ok {
+			name, _ := function["name"].(string)
+			return "function", name
+		}
+	}
+
+	return "", ""
+}
+
+// GetN returns the number of the choices to generate (at least 1)
+func (c *ChatProps) GetN() int {
+	if c.N == nil || *c.N < 1 {
+		return 1
+	}
+
+	return *c.N
+}
+
 func CreateChatProps(props *ChatProps, buffer *utils.Buffer) *ChatProps {
 	props.SetupBuffer(buffer)
 	return props
@@ -70,3 +275,165 @@ func CreateChatProps(props *ChatProps, buffer *utils.Buffer) *ChatProps {
 func CreateVideoProps(props *VideoProps) *VideoProps {
 	return props
 }
+
+func CreateEmbeddingProps(props *EmbeddingProps) *EmbeddingProps {
+	return props
+}
+
+func CreateAudioProps(props *AudioProps) *AudioProps {
+	return props
+}
+
+func CreateImageProps(props *ImageProps) *ImageProps {
+	return props
+}
+
+func CreateModerationProps(props *ModerationProps) *ModerationProps {
+	return props
+}
+
+// GetInputs returns the text inputs of the moderation request, the text parts of the multimodal inputs are included
+func (p *ModerationProps) GetInputs() []string {
+	switch v := p.Input.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			switch value := item.(type) {
+			case string:
+				result = append(result, value)
+			case map[string]interface{}:
+				if text, ok := value["text"].(string); ok && value["type"] == "text" {
+					result = append(result, text)
+				}
+			}
+		}
+		return result
+	}
+
+	return []string{}
+}
+
+// GetFlaggedCategories returns the flagged categories of all the results, nil if nothing is flagged
+func (r *ModerationResponse) GetFlaggedCategories() []string {
+	var categories []string
+	for _, result := range r.Results {
+		if !result.Flagged {
+			continue
+		}
+
+		for category, flagged := range result.Categories {
+			if flagged && !utils.Contains(category, categories) {
+				categories = append(categories, category)
+			}
+		}
+	}
+
+	sort.Strings(categories)
+	return categories
+}
+
+// IsFlagged returns whether any of the results is flagged
+func (r *ModerationResponse) IsFlagged() bool {
+	for _, result := range r.Results {
+		if result.Flagged {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetN returns the number of the images to generate (at least 1)
+func (p *ImageProps) GetN() int {
+	if p.N == nil || *p.N < 1 {
+		return 1
+	}
+
+	return *p.N
+}
+
+// GetSize returns the width and the height of the size (e.g. `1024x1024`), zero if the size is not specified or invalid
+func (p *ImageProps) GetSize() (int, int) {
+	size := strings.Split(strings.ToLower(utils.GetPtrVal(p.Size, "")), "x")
+	if len(size) != 2 {
+		return 0, 0
+	}
+
+	width, height := utils.ParseInt(size[0]), utils.ParseInt(size[1])
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+
+	return width, height
+}
+
+// IsEdit returns whether the image request is an edit request (input image with prompt)
+func (p *ImageProps) IsEdit() bool {
+	return len(p.Image) > 0 && len(p.Prompt) > 0
+}
+
+// IsVariation returns whether the image request is a variation request (input image without prompt)
+func (p *ImageProps) IsVariation() bool {
+	return len(p.Image) > 0 && len(p.Prompt) == 0
+}
+
+// IsSpeech returns whether the audio request is a text-to-speech request
+func (p *AudioProps) IsSpeech() bool {
+	return len(p.File) == 0 && len(p.Input) > 0
+}
+
+// CountTokenInputs returns the tokens of the token array inputs of the embedding request,
+// each number is one token and the nested arrays are summed up
+func (p *EmbeddingProps) CountTokenInputs() int {
+	switch v := p.Input.(type) {
+	case []int:
+		return len(v)
+	case [][]int:
+		tokens := 0
+		for _, item := range v {
+			tokens += len(item)
+		}
+		return tokens
+	case []interface{}:
+		tokens := 0
+		for _, item := range v {
+			switch value := item.(type) {
+			case float64, int:
+				tokens++
+			case []interface{}:
+				for _, token := range value {
+					if _, ok := token.(float64); ok {
+						tokens++
+					}
+				}
+			}
+		}
+		return tokens
+	}
+
+	return 0
+}
+
+// GetInputs returns the text inputs of the embedding request, token array inputs are counted by CountTokenInputs
+func (p *EmbeddingProps) GetInputs() []string {
+	switch v := p.Input.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if text, ok := item.(string); ok {
+				result = append(result, text)
+			}
+		}
+		return result
+	}
+
+	return []string{}
+}
@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -134,7 +135,7 @@ func (c *ChatInstance) CreateChatRequest(props *adaptercommon.ChatProps) (string
 	var responseContent string
 	var responseMutex sync.Mutex
 
-	err = c.CreateStreamChatRequest(props, func(chunk *globals.Chunk) error {
+	err = c.CreateStreamChatRequest(context.Background(), props, func(chunk *globals.Chunk) error {
 		responseMutex.Lock()
 		defer responseMutex.Unlock()
 		responseContent += chunk.Content
@@ -152,11 +153,13 @@ func (c *ChatInstance) CreateChatRequest(props *adaptercommon.ChatProps) (string
 	return responseContent, nil
 }
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	c.responseComplete = false
 	c.AutoSaveHistory = false
 
 	err := utils.EventScanner(&utils.EventScannerProps{
+		Ctx:     ctx,
+		Timeout: props.Timeout,
 		Method:  "POST",
 		Uri:     c.GetChatEndpoint(),
 		Headers: c.GetHeader(),
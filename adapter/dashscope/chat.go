@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -103,8 +104,9 @@ func (c *ChatInstance) GetChatEndpoint() string {
 	return fmt.Sprintf("%s/api/v1/services/aigc/text-generation/generation", c.Endpoint)
 }
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	return utils.EventSource(
+		ctx,
 		"POST",
 		c.GetChatEndpoint(),
 		c.GetHeader(),
@@ -127,7 +129,14 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, c
 					return fmt.Errorf("dashscope error: %s", form.Message)
 				}
 
-				if err := callback(&globals.Chunk{Content: form.Output.Text}); err != nil {
+				// the usage is cumulative in each chunk
+				if err := callback(&globals.Chunk{
+					Content: form.Output.Text,
+					Usage: &globals.ChunkUsage{
+						InputTokens:  form.Usage.InputTokens,
+						OutputTokens: form.Usage.OutputTokens,
+					},
+				}); err != nil {
 					return err
 				}
 				return nil
@@ -0,0 +1,90 @@
+package dashscope
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/utils"
+	"fmt"
+)
+
+type EmbeddingRequest struct {
+	Model      string         `json:"model"`
+	Input      EmbeddingInput `json:"input"`
+	Parameters EmbeddingParam `json:"parameters"`
+}
+
+type EmbeddingInput struct {
+	Texts []string `json:"texts"`
+}
+
+type EmbeddingParam struct {
+	TextType  string `json:"text_type"`
+	Dimension *int   `json:"dimension,omitempty"`
+}
+
+type EmbeddingResponse struct {
+	Output struct {
+		Embeddings []struct {
+			TextIndex int       `json:"text_index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"embeddings"`
+	} `json:"output"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+	RequestId string `json:"request_id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+func (c *ChatInstance) GetEmbeddingEndpoint() string {
+	return fmt.Sprintf("%s/api/v1/services/embeddings/text-embedding/text-embedding", c.Endpoint)
+}
+
+func (c *ChatInstance) GetEmbeddingHeader() map[string]string {
+	return map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": fmt.Sprintf("Bearer %s", c.GetApiKey()),
+	}
+}
+
+// CreateEmbeddingRequest will create the embeddings of the input texts
+func (c *ChatInstance) CreateEmbeddingRequest(props *adaptercommon.EmbeddingProps) (*adaptercommon.EmbeddingResponse, error) {
+	texts := props.GetInputs()
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("dashscope error: only text inputs are supported")
+	}
+
+	res, err := utils.Post(c.GetEmbeddingEndpoint(), c.GetEmbeddingHeader(), EmbeddingRequest{
+		Model: props.Model,
+		Input: EmbeddingInput{
+			Texts: texts,
+		},
+		Parameters: EmbeddingParam{
+			TextType:  "document",
+			Dimension: props.Dimensions,
+		},
+	}, props.Proxy)
+	if err != nil || res == nil {
+		return nil, fmt.Errorf("dashscope error: %s", utils.GetError(err))
+	}
+
+	data := utils.MapToStruct[EmbeddingResponse](res)
+	if data == nil {
+		return nil, fmt.Errorf("dashscope error: cannot parse response")
+	} else if data.Message != "" && len(data.Output.Embeddings) == 0 {
+		return nil, fmt.Errorf("dashscope error: %s (code: %s)", data.Message, data.Code)
+	}
+
+	result := make([]adaptercommon.EmbeddingData, 0, len(data.Output.Embeddings))
+	for _, item := range data.Output.Embeddings {
+		result = append(result, adaptercommon.EmbeddingData{
+			Index:     item.TextIndex,
+			Embedding: item.Embedding,
+		})
+	}
+
+	return &adaptercommon.EmbeddingResponse{
+		Data:        result,
+		InputTokens: data.Usage.TotalTokens,
+	}, nil
+}
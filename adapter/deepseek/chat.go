@@ -4,15 +4,14 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"errors"
 	"fmt"
 )
 
 type ChatInstance struct {
-	Endpoint         string
-	ApiKey           string
-	isFirstReasoning bool
-	isReasonOver     bool
+	Endpoint string
+	ApiKey   string
 }
 
 func (c *ChatInstance) GetEndpoint() string {
@@ -32,9 +31,8 @@ func (c *ChatInstance) GetHeader() map[string]string {
 
 func NewChatInstance(endpoint, apiKey string) *ChatInstance {
 	return &ChatInstance{
-		Endpoint:         endpoint,
-		ApiKey:           apiKey,
-		isFirstReasoning: true,
+		Endpoint: endpoint,
+		ApiKey:   apiKey,
 	}
 }
 
@@ -59,7 +57,7 @@ func (c *ChatInstance) GetChatBody(props *adaptercommon.ChatProps, stream bool)
 		messages[0].Role = globals.User
 	}
 
-	return ChatRequest{
+	request := ChatRequest{
 		Model:            props.Model,
 		Messages:         messages,
 		MaxTokens:        props.MaxTokens,
@@ -71,6 +69,13 @@ func (c *ChatInstance) GetChatBody(props *adaptercommon.ChatProps, stream bool)
 		User:             props.User,
 		Userip:           props.Ip,
 	}
+
+	if stream {
+		// the upstream reports the usage in the last chunk for billing
+		request.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	return request
 }
 
 func processChatResponse(data string) *ChatResponse {
@@ -94,41 +99,48 @@ func processChatErrorResponse(data string) *ChatStreamErrorResponse {
 	return nil
 }
 
-func (c *ChatInstance) ProcessLine(data string) (string, error) {
-	if form := processChatStreamResponse(data); form != nil {
-		if len(form.Choices) == 0 {
-			return "", nil
-		}
+func getUsage(usage *ChatUsage) *globals.ChunkUsage {
+	if usage == nil {
+		return nil
+	}
 
-		delta := form.Choices[0].Delta
+	result := &globals.ChunkUsage{
+		InputTokens:     usage.PromptTokens,
+		OutputTokens:    usage.CompletionTokens,
+		CacheReadTokens: usage.PromptCacheHitTokens,
+	}
+	if usage.CompletionTokensDetails != nil {
+		result.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
 
-		if c.isFirstReasoning == false && !c.isReasonOver && delta.ReasoningContent == nil {
-			c.isReasonOver = true
-			if delta.Content != "" {
-				return fmt.Sprintf("\n</think>\n\n%s", delta.Content), nil
-			}
-			return "\n</think>\n\n", nil
-		}
+	return result
+}
 
-		if delta.ReasoningContent != nil {
-			content := *delta.ReasoningContent
-			if c.isFirstReasoning {
-				c.isFirstReasoning = false
-				return fmt.Sprintf("<think>\n%s", content), nil
-			}
-			return content, nil
-		}
+func getDeltaChunk(form *ChatStreamResponse) *globals.Chunk {
+	if len(form.Choices) == 0 {
+		return &globals.Chunk{Content: "", Usage: getUsage(form.Usage)}
+	}
+
+	delta := form.Choices[0].Delta
+	return &globals.Chunk{
+		Content:   delta.Content,
+		Reasoning: utils.GetPtrVal(delta.ReasoningContent, ""),
+		Usage:     getUsage(form.Usage),
+	}
+}
 
-		return delta.Content, nil
+func (c *ChatInstance) ProcessLine(data string) (*globals.Chunk, error) {
+	if form := processChatStreamResponse(data); form != nil {
+		return getDeltaChunk(form), nil
 	}
 
 	if form := processChatErrorResponse(data); form != nil {
 		if form.Error.Message != "" {
-			return "", errors.New(fmt.Sprintf("deepseek error: %s", form.Error.Message))
+			return &globals.Chunk{Content: ""}, errors.New(fmt.Sprintf("deepseek error: %s", form.Error.Message))
 		}
 	}
 
-	return "", nil
+	return &globals.Chunk{Content: ""}, nil
 }
 
 func (c *ChatInstance) CreateChatRequest(props *adaptercommon.ChatProps) (string, error) {
@@ -152,19 +164,13 @@ func (c *ChatInstance) CreateChatRequest(props *adaptercommon.ChatProps) (string
 		return "", fmt.Errorf("deepseek error: no choices")
 	}
 
-	message := data.Choices[0].Message
-	content := message.Content
-	if message.ReasoningContent != nil {
-		content = fmt.Sprintf("<think>\n%s\n</think>\n\n%s", *message.ReasoningContent, content)
-	}
-
-	return content, nil
+	return data.Choices[0].Message.Content, nil
 }
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
-	c.isFirstReasoning = true
-	c.isReasonOver = false
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	err := utils.EventScanner(&utils.EventScannerProps{
+		Ctx:     ctx,
+		Timeout: props.Timeout,
 		Method:  "POST",
 		Uri:     c.GetChatEndpoint(),
 		Headers: c.GetHeader(),
@@ -174,7 +180,7 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, c
 			if err != nil {
 				return err
 			}
-			return callback(&globals.Chunk{Content: partial})
+			return callback(partial)
 		},
 	}, props.Proxy)
 
@@ -15,10 +15,27 @@ type ChatRequest struct {
 	TopP             *float32          `json:"top_p,omitempty"`
 	PresencePenalty  *float32          `json:"presence_penalty,omitempty"`
 	FrequencyPenalty *float32          `json:"frequency_penalty,omitempty"`
+	StreamOptions    *StreamOptions    `json:"stream_options,omitempty"`
 	User             interface{}       `json:"user,omitempty"`
 	Userip           string            `json:"user_ip,omitempty"`
 }
 
+// StreamOptions is the stream options for deepseek, include_usage makes the last chunk carry the usage
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatUsage is the usage reported by deepseek
+type ChatUsage struct {
+	PromptTokens            int `json:"prompt_tokens"`
+	CompletionTokens        int `json:"completion_tokens"`
+	TotalTokens             int `json:"total_tokens"`
+	PromptCacheHitTokens    int `json:"prompt_cache_hit_tokens"` // included in the prompt tokens
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+}
+
 // ChatResponse is the native http request body for deepseek
 type ChatResponse struct {
 	ID      string `json:"id"`
@@ -30,11 +47,7 @@ type ChatResponse struct {
 		Message      globals.Message `json:"message"`
 		FinishReason string          `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage ChatUsage `json:"usage"`
 }
 
 // ChatStreamResponse is the stream response body for deepseek
@@ -48,6 +61,7 @@ type ChatStreamResponse struct {
 		Index        int             `json:"index"`
 		FinishReason string          `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *ChatUsage `json:"usage,omitempty"` // only the last chunk
 }
 
 type ChatStreamErrorResponse struct {
@@ -30,10 +30,10 @@ func (c *ChatInstance) FormatMessages(messages []globals.Message) []globals.Mess
 	return result
 }
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	credential := NewCredential(c.GetSecretId(), c.GetSecretKey())
 	client := NewInstance(c.GetAppId(), c.GetEndpoint(), credential)
-	channel, err := client.Chat(context.Background(), NewRequest(Stream, c.FormatMessages(props.Message), props.Temperature, props.TopP))
+	channel, err := client.Chat(ctx, NewRequest(Stream, c.FormatMessages(props.Message), props.Temperature, props.TopP))
 	if err != nil {
 		return fmt.Errorf("tencent hunyuan error: %+v", err)
 	}
@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -76,7 +77,7 @@ func (c *ChatInstance) GetPrompt(props *adaptercommon.ChatProps) string {
 	return c.GetCleanPrompt(props.Model, content)
 }
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	// partial response like:
 	// ```progress
 	// 0
@@ -95,7 +96,7 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, c
 
 	var begin bool
 
-	form, err := c.CreateStreamTask(props, action, prompt, func(form *StorageForm, progress int) error {
+	form, err := c.CreateStreamTask(ctx, props, action, prompt, func(form *StorageForm, progress int) error {
 		if progress == -1 {
 			// ping event
 			return callback(&globals.Chunk{Content: ""})
@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -84,7 +85,7 @@ func (c *ChatInstance) CreateRequest(proxy globals.ProxyConfig, action string, p
 	}
 }
 
-func (c *ChatInstance) CreateStreamTask(props *adaptercommon.ChatProps, action string, prompt string, hook func(form *StorageForm, progress int) error) (*StorageForm, error) {
+func (c *ChatInstance) CreateStreamTask(ctx context.Context, props *adaptercommon.ChatProps, action string, prompt string, hook func(form *StorageForm, progress int) error) (*StorageForm, error) {
 	res, err := c.CreateRequest(props.Proxy, action, prompt)
 	if err != nil {
 		return nil, err
@@ -136,6 +137,8 @@ func (c *ChatInstance) CreateStreamTask(props *adaptercommon.ChatProps, action s
 			}
 		case <-time.After(maxTimeout):
 			return nil, fmt.Errorf("task timeout")
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
 	}
 }
\ No newline at end of file
@@ -0,0 +1,174 @@
+package openai
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/globals"
+	"chat/utils"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type SpeechRequest struct {
+	Model          string   `json:"model"`
+	Input          string   `json:"input"`
+	Voice          string   `json:"voice"`
+	ResponseFormat *string  `json:"response_format,omitempty"`
+	Speed          *float32 `json:"speed,omitempty"`
+}
+
+type TranscriptionResponse struct {
+	Text     string  `json:"text"`
+	Duration float32 `json:"duration"`
+	Usage    *struct {
+		Type    string  `json:"type"`
+		Seconds float32 `json:"seconds"`
+	} `json:"usage,omitempty"`
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+var speechContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/ogg",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
+
+func (c *ChatInstance) GetTranscriptionEndpoint(translate bool) string {
+	if translate {
+		return fmt.Sprintf("%s/v1/audio/translations", c.GetEndpoint())
+	}
+	return fmt.Sprintf("%s/v1/audio/transcriptions", c.GetEndpoint())
+}
+
+func (c *ChatInstance) GetSpeechEndpoint() string {
+	return fmt.Sprintf("%s/v1/audio/speech", c.GetEndpoint())
+}
+
+func (c *ChatInstance) GetAuthHeader(contentType string) map[string]string {
+	return map[string]string{
+		"Content-Type":  contentType,
+		"Authorization": fmt.Sprintf("Bearer %s", c.GetApiKey()),
+	}
+}
+
+// GetTranscriptionForm returns the multipart fields of the transcription / translation request
+func GetTranscriptionForm(props *adaptercommon.AudioProps, model string) map[string]string {
+	fields := map[string]string{
+		"model":           model,
+		"response_format": utils.GetPtrVal(props.ResponseFormat, ""),
+		"prompt":          utils.GetPtrVal(props.Prompt, ""),
+	}
+
+	if !props.Translate {
+		fields["language"] = utils.GetPtrVal(props.Language, "")
+	}
+
+	if props.Temperature != nil {
+		fields["temperature"] = utils.ToString(*props.Temperature)
+	}
+
+	return fields
+}
+
+// ParseTranscriptionResponse parses the transcription response (json, verbose_json, text, srt or vtt format)
+func ParseTranscriptionResponse(data []byte, format string) (*adaptercommon.AudioResponse, error) {
+	isJson := format == "" || format == "json" || format == "verbose_json"
+	if form := utils.UnmarshalForm[TranscriptionResponse](string(data)); form != nil {
+		if form.Error.Message != "" {
+			return nil, fmt.Errorf("openai error: %s (type: %s)", form.Error.Message, form.Error.Type)
+		}
+
+		if isJson {
+			duration := form.Duration
+			if duration == 0 && form.Usage != nil && form.Usage.Type == "duration" {
+				duration = form.Usage.Seconds
+			}
+
+			return &adaptercommon.AudioResponse{
+				Data:        data,
+				ContentType: "application/json",
+				Text:        form.Text,
+				Duration:    duration,
+			}, nil
+		}
+	}
+
+	if isJson {
+		return nil, fmt.Errorf("openai error: cannot parse response")
+	}
+
+	return &adaptercommon.AudioResponse{
+		Data:        data,
+		ContentType: "text/plain; charset=utf-8",
+		Text:        string(data),
+	}, nil
+}
+
+// ParseSpeechResponse checks the speech response and returns the audio data
+func ParseSpeechResponse(data []byte, format string) (*adaptercommon.AudioResponse, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("openai error: empty speech response")
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if form := utils.UnmarshalForm[ChatStreamErrorResponse](string(data)); form != nil && form.Error.Message != "" {
+			return nil, fmt.Errorf("openai error: %s (type: %s)", form.Error.Message, form.Error.Type)
+		}
+	}
+
+	contentType, ok := speechContentTypes[format]
+	if !ok {
+		contentType = http.DetectContentType(data)
+	}
+
+	return &adaptercommon.AudioResponse{
+		Data:        data,
+		ContentType: contentType,
+	}, nil
+}
+
+// CreateTranscriptionRequest will create the transcription (or translation to english) of the audio file
+func (c *ChatInstance) CreateTranscriptionRequest(props *adaptercommon.AudioProps) (*adaptercommon.AudioResponse, error) {
+	body, contentType, err := utils.NewMultipartBody(
+		GetTranscriptionForm(props, props.Model),
+		utils.MultipartFile{Field: "file", Name: props.FileName, Data: props.File},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	data, err := utils.HttpRaw(
+		c.GetTranscriptionEndpoint(props.Translate), http.MethodPost,
+		c.GetAuthHeader(contentType), body, []globals.ProxyConfig{props.Proxy},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	return ParseTranscriptionResponse(data, utils.GetPtrVal(props.ResponseFormat, ""))
+}
+
+// CreateSpeechRequest will create the speech audio of the input text
+func (c *ChatInstance) CreateSpeechRequest(props *adaptercommon.AudioProps) (*adaptercommon.AudioResponse, error) {
+	data, err := utils.HttpRaw(
+		c.GetSpeechEndpoint(), http.MethodPost, c.GetHeader(),
+		utils.ConvertBody(SpeechRequest{
+			Model:          props.Model,
+			Input:          props.Input,
+			Voice:          props.Voice,
+			ResponseFormat: props.ResponseFormat,
+			Speed:          props.Speed,
+		}), []globals.ProxyConfig{props.Proxy},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	return ParseSpeechResponse(data, utils.GetPtrVal(props.ResponseFormat, "mp3"))
+}
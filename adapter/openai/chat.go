@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
@@ -33,15 +34,32 @@ func (c *ChatInstance) GetLatestPrompt(props *adaptercommon.ChatProps) string {
 	return props.Message[len(props.Message)-1].Content
 }
 
+// getCompletionRequest returns the legacy completion request body, the raw prompt is preferred over the formatted messages
+func getCompletionRequest(props *adaptercommon.ChatProps, prompt string, stream bool, usage bool) CompletionRequest {
+	request := CompletionRequest{
+		Model:       props.Model,
+		Prompt:      utils.GetPtrVal(props.Prompt, prompt),
+		MaxToken:    props.MaxTokens,
+		Stream:      stream,
+		Suffix:      props.Suffix,
+		Temperature: props.Temperature,
+		TopP:        props.TopP,
+		N:           props.N,
+		Stop:        props.Stop,
+		Seed:        props.Seed,
+		User:        props.User,
+	}
+
+	if stream && usage {
+		request.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	return request
+}
+
 func (c *ChatInstance) GetChatBody(props *adaptercommon.ChatProps, stream bool) interface{} {
 	if props.Model == globals.GPT3TurboInstruct {
 		// for completions
-		return CompletionRequest{
-			Model:    props.Model,
-			Prompt:   c.GetCompletionPrompt(props.Message),
-			MaxToken: props.MaxTokens,
-			Stream:   stream,
-		}
+		return getCompletionRequest(props, c.GetCompletionPrompt(props.Message), stream, c.isIncludeUsage(props))
 	}
 
 	messages := formatMessages(props)
@@ -67,10 +85,28 @@ func (c *ChatInstance) GetChatBody(props *adaptercommon.ChatProps, stream bool)
 		TopP:             props.TopP,
 		Tools:            props.Tools,
 		ToolChoice:       props.ToolChoice,
+		ResponseFormat:   props.ResponseFormat,
+		Stop:             props.Stop,
+		Seed:             props.Seed,
+		N:                props.N,
+		LogitBias:        props.LogitBias,
+		Logprobs:         props.Logprobs,
+		TopLogprobs:      props.TopLogprobs,
+		ReasoningEffort:  props.ReasoningEffort,
 		User:             props.User,
 		Userip:           props.Ip,
 	}
 
+	if props.Tools != nil {
+		// parallel_tool_calls is only allowed when tools are specified
+		request.ParallelToolCalls = props.ParallelToolCalls
+	}
+
+	if stream && c.isIncludeUsage(props) {
+		// the upstream reports the usage in the last chunk for billing
+		request.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
 	if isNewModel {
 		request.MaxCompletionTokens = props.MaxTokens
 	} else {
@@ -113,7 +149,7 @@ func hideRequestId(message string) string {
 }
 
 // CreateStreamChatRequest is the stream response body for openai
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	if globals.IsOpenAIDalleModel(props.Model) {
 		if url, err := c.CreateImage(props); err != nil {
 			return err
@@ -128,6 +164,8 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, c
 
 	ticks := 0
 	err := utils.EventScanner(&utils.EventScannerProps{
+		Ctx:     ctx,
+		Timeout: props.Timeout,
 		Method:  "POST",
 		Uri:     c.GetChatEndpoint(props),
 		Headers: c.GetHeader(),
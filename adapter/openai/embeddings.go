@@ -0,0 +1,69 @@
+package openai
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/utils"
+	"fmt"
+)
+
+type EmbeddingRequest struct {
+	Model          string      `json:"model"`
+	Input          interface{} `json:"input"`
+	EncodingFormat *string     `json:"encoding_format,omitempty"`
+	Dimensions     *int        `json:"dimensions,omitempty"`
+	User           string      `json:"user,omitempty"`
+}
+
+type EmbeddingItem struct {
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"`
+}
+
+type EmbeddingResponse struct {
+	Data  []EmbeddingItem `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func (c *ChatInstance) GetEmbeddingEndpoint() string {
+	return fmt.Sprintf("%s/v1/embeddings", c.GetEndpoint())
+}
+
+// CreateEmbeddingRequest will create the embeddings of the input texts
+func (c *ChatInstance) CreateEmbeddingRequest(props *adaptercommon.EmbeddingProps) (*adaptercommon.EmbeddingResponse, error) {
+	res, err := utils.Post(c.GetEmbeddingEndpoint(), c.GetHeader(), EmbeddingRequest{
+		Model:          props.Model,
+		Input:          props.Input,
+		EncodingFormat: props.EncodingFormat,
+		Dimensions:     props.Dimensions,
+		User:           props.User,
+	}, props.Proxy)
+	if err != nil || res == nil {
+		return nil, fmt.Errorf("openai error: %s", utils.GetError(err))
+	}
+
+	data := utils.MapToStruct[EmbeddingResponse](res)
+	if data == nil {
+		return nil, fmt.Errorf("openai error: cannot parse response")
+	} else if data.Error.Message != "" {
+		return nil, fmt.Errorf("openai error: %s (type: %s)", data.Error.Message, data.Error.Type)
+	} else if len(data.Data) == 0 {
+		return nil, fmt.Errorf("openai error: empty embedding response")
+	}
+
+	return &adaptercommon.EmbeddingResponse{
+		Data: utils.Each(data.Data, func(item EmbeddingItem) adaptercommon.EmbeddingData {
+			return adaptercommon.EmbeddingData{
+				Index:     item.Index,
+				Embedding: item.Embedding,
+			}
+		}),
+		InputTokens: utils.Multi(data.Usage.PromptTokens > 0, data.Usage.PromptTokens, data.Usage.TotalTokens),
+	}, nil
+}
@@ -5,6 +5,7 @@ import (
 	"chat/globals"
 	"chat/utils"
 	"fmt"
+	"net/http"
 	"strings"
 )
 
@@ -19,6 +20,14 @@ func (c *ChatInstance) GetImageEndpoint() string {
 	return fmt.Sprintf("%s/v1/images/generations", c.GetEndpoint())
 }
 
+func (c *ChatInstance) GetImageEditEndpoint() string {
+	return fmt.Sprintf("%s/v1/images/edits", c.GetEndpoint())
+}
+
+func (c *ChatInstance) GetImageVariationEndpoint() string {
+	return fmt.Sprintf("%s/v1/images/variations", c.GetEndpoint())
+}
+
 // CreateImageRequest will create a dalle image from prompt, return url of image, base64 data and error
 func (c *ChatInstance) CreateImageRequest(props ImageProps) (string, string, error) {
 	res, err := utils.Post(
@@ -73,3 +82,113 @@ func (c *ChatInstance) CreateImage(props *adaptercommon.ChatProps) (string, erro
 	storedUrl := utils.StoreImage(url)
 	return utils.GetImageMarkdown(storedUrl), nil
 }
+
+// getImageResponseFormat returns the response format of the image request, gpt-image-1 always returns base64 data and rejects the param
+func getImageResponseFormat(props *adaptercommon.ImageProps) *string {
+	if props.Model == globals.GPTImage1 {
+		return nil
+	}
+
+	return props.ResponseFormat
+}
+
+// GetImageForm returns the multipart fields of the image edit / variation request
+func GetImageForm(props *adaptercommon.ImageProps) map[string]string {
+	return map[string]string{
+		"model":           props.Model,
+		"prompt":          props.Prompt,
+		"n":               utils.ToString(props.GetN()),
+		"size":            utils.GetPtrVal(props.Size, ""),
+		"quality":         utils.GetPtrVal(props.Quality, ""),
+		"response_format": utils.GetPtrVal(getImageResponseFormat(props), ""),
+		"user":            props.User,
+	}
+}
+
+// ParseImageResponse parses the image generation / edit / variation response
+func ParseImageResponse(data []byte) (*adaptercommon.ImageResponse, error) {
+	form := utils.UnmarshalForm[ImageResponse](string(data))
+	if form == nil {
+		return nil, fmt.Errorf("openai error: cannot parse response")
+	} else if form.Error.Message != "" {
+		return nil, fmt.Errorf("openai error: %s", form.Error.Message)
+	} else if len(form.Data) == 0 {
+		return nil, fmt.Errorf("openai error: no image generated")
+	}
+
+	return &adaptercommon.ImageResponse{
+		Images: utils.Each(form.Data, func(item ImageResponseData) adaptercommon.ImageData {
+			return adaptercommon.ImageData{
+				Url:           item.Url,
+				B64Json:       item.B64Json,
+				RevisedPrompt: item.RevisedPrompt,
+			}
+		}),
+	}, nil
+}
+
+// CreateImageGenerationRequest will create the images from prompt
+func (c *ChatInstance) CreateImageGenerationRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	data, err := utils.HttpRaw(
+		c.GetImageEndpoint(), http.MethodPost, c.GetHeader(),
+		utils.ConvertBody(ImageRequest{
+			Model:          props.Model,
+			Prompt:         props.Prompt,
+			Size:           ImageSize(utils.GetPtrVal(props.Size, "")),
+			N:              props.GetN(),
+			Quality:        props.Quality,
+			Style:          props.Style,
+			ResponseFormat: getImageResponseFormat(props),
+			User:           props.User,
+		}), []globals.ProxyConfig{props.Proxy},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	return ParseImageResponse(data)
+}
+
+// CreateImageEditRequest will edit the input image (with the optional mask) from prompt
+func (c *ChatInstance) CreateImageEditRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	files := []utils.MultipartFile{{Field: "image", Name: props.ImageName, Data: props.Image}}
+	if len(props.Mask) > 0 {
+		files = append(files, utils.MultipartFile{Field: "mask", Name: props.MaskName, Data: props.Mask})
+	}
+
+	body, contentType, err := utils.NewMultipartBody(GetImageForm(props), files...)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	data, err := utils.HttpRaw(
+		c.GetImageEditEndpoint(), http.MethodPost,
+		c.GetAuthHeader(contentType), body, []globals.ProxyConfig{props.Proxy},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	return ParseImageResponse(data)
+}
+
+// CreateImageVariationRequest will create the variations of the input image
+func (c *ChatInstance) CreateImageVariationRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	body, contentType, err := utils.NewMultipartBody(
+		GetImageForm(props),
+		utils.MultipartFile{Field: "image", Name: props.ImageName, Data: props.Image},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	data, err := utils.HttpRaw(
+		c.GetImageVariationEndpoint(), http.MethodPost,
+		c.GetAuthHeader(contentType), body, []globals.ProxyConfig{props.Proxy},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("openai error: %s", err.Error())
+	}
+
+	return ParseImageResponse(data)
+}
@@ -0,0 +1,46 @@
+package openai
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/utils"
+	"fmt"
+)
+
+type ModerationRequest struct {
+	Model string      `json:"model,omitempty"`
+	Input interface{} `json:"input"`
+}
+
+type ModerationResponse struct {
+	adaptercommon.ModerationResponse
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func (c *ChatInstance) GetModerationEndpoint() string {
+	return fmt.Sprintf("%s/v1/moderations", c.GetEndpoint())
+}
+
+// CreateModerationRequest will classify whether the inputs violate the usage policies
+func (c *ChatInstance) CreateModerationRequest(props *adaptercommon.ModerationProps) (*adaptercommon.ModerationResponse, error) {
+	res, err := utils.Post(c.GetModerationEndpoint(), c.GetHeader(), ModerationRequest{
+		Model: props.Model,
+		Input: props.Input,
+	}, props.Proxy)
+	if err != nil || res == nil {
+		return nil, fmt.Errorf("openai error: %s", utils.GetError(err))
+	}
+
+	data := utils.MapToStruct[ModerationResponse](res)
+	if data == nil {
+		return nil, fmt.Errorf("openai error: cannot parse response")
+	} else if data.Error.Message != "" {
+		return nil, fmt.Errorf("openai error: %s (type: %s)", data.Error.Message, data.Error.Type)
+	} else if len(data.Results) == 0 {
+		return nil, fmt.Errorf("openai error: empty moderation response")
+	}
+
+	return &data.ModerationResponse, nil
+}
@@ -9,6 +9,7 @@ import (
 type ChatInstance struct {
 	Endpoint string
 	ApiKey   string
+	Type     string // channel type, the openai format channels (e.g. moonshot, groq) share the instance
 }
 
 func (c *ChatInstance) GetEndpoint() string {
@@ -34,8 +35,16 @@ func NewChatInstance(endpoint, apiKey string) *ChatInstance {
 }
 
 func NewChatInstanceFromConfig(conf globals.ChannelConfig) factory.Factory {
-	return NewChatInstance(
+	instance := NewChatInstance(
 		conf.GetEndpoint(),
 		conf.GetRandomSecret(),
 	)
+	instance.Type = conf.GetType()
+	return instance
+}
+
+// isIncludeUsage returns whether the stream_options is sent to the upstream, the openai compatible backends may reject the unknown field,
+// so that it is only sent to the openai channels or when the client requests it (the usage is estimated from the tokens otherwise)
+func (c *ChatInstance) isIncludeUsage(props *factory.ChatProps) bool {
+	return props.IncludeUsage || c.Type == globals.OpenAIChannelType
 }
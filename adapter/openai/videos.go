@@ -5,6 +5,7 @@ import (
 	"chat/globals"
 	"chat/utils"
 	"fmt"
+	"net/http"
 	"time"
 )
 
@@ -16,6 +17,10 @@ type VideoRequest struct {
 	InputReference *string `json:"input_reference,omitempty"`
 }
 
+type VideoRemixRequest struct {
+	Prompt string `json:"prompt"`
+}
+
 type VideoJob struct {
 	CompletedAt        *int64  `json:"completed_at,omitempty"`
 	CreatedAt          int64   `json:"created_at"`
@@ -35,6 +40,14 @@ type VideoJob struct {
 	} `json:"error,omitempty"`
 }
 
+type VideoDeleteResponse struct {
+	Id      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
 func (c *ChatInstance) getVideoCreateEndpoint() string {
 	return fmt.Sprintf("%s/v1/videos", c.GetEndpoint())
 }
@@ -43,16 +56,35 @@ func (c *ChatInstance) getVideoQueryEndpoint(id string) string {
 	return fmt.Sprintf("%s/v1/videos/%s", c.GetEndpoint(), id)
 }
 
-func (c *ChatInstance) CreateVideoRequest(props *adaptercommon.VideoProps, hook globals.Hook) error {
-	body := VideoRequest{
+func (c *ChatInstance) getVideoContentEndpoint(id string) string {
+	return fmt.Sprintf("%s/v1/videos/%s/content", c.GetEndpoint(), id)
+}
+
+func (c *ChatInstance) getVideoRemixEndpoint(id string) string {
+	return fmt.Sprintf("%s/v1/videos/%s/remix", c.GetEndpoint(), id)
+}
+
+// getVideoBody returns the endpoint and the request body of the video job (create or remix)
+func (c *ChatInstance) getVideoBody(props *adaptercommon.VideoProps) (string, interface{}) {
+	if props.RemixVideoId != nil {
+		return c.getVideoRemixEndpoint(*props.RemixVideoId), VideoRemixRequest{
+			Prompt: props.Prompt,
+		}
+	}
+
+	return c.getVideoCreateEndpoint(), VideoRequest{
 		Prompt:         props.Prompt,
 		Model:          props.Model,
 		Seconds:        props.Seconds,
 		Size:           props.Size,
 		InputReference: props.InputReference,
 	}
+}
 
-	res, err := utils.Post(c.getVideoCreateEndpoint(), c.GetHeader(), body, props.Proxy)
+func (c *ChatInstance) CreateVideoRequest(props *adaptercommon.VideoProps, hook globals.Hook) error {
+	endpoint, body := c.getVideoBody(props)
+
+	res, err := utils.Post(endpoint, c.GetHeader(), body, props.Proxy)
 	if err != nil || res == nil {
 		if err != nil {
 			return fmt.Errorf("openai video error: %s", err.Error())
@@ -139,3 +171,60 @@ func (c *ChatInstance) CreateVideoRequest(props *adaptercommon.VideoProps, hook
 		}
 	}
 }
+
+func (c *ChatInstance) RetrieveVideoRequest(props *adaptercommon.VideoJobProps) (string, error) {
+	res, err := utils.Get(c.getVideoQueryEndpoint(props.Id), c.GetHeader(), props.Proxy)
+	if err != nil || res == nil {
+		if err != nil {
+			return "", fmt.Errorf("openai video error: %s", err.Error())
+		}
+		return "", fmt.Errorf("openai video error: empty response")
+	}
+
+	job := utils.MapToStruct[VideoJob](res)
+	if job == nil || job.Id != props.Id {
+		if job != nil && job.Error != nil && job.Error.Message != "" {
+			return "", fmt.Errorf("openai video error: %s", job.Error.Message)
+		}
+		return "", fmt.Errorf("openai video error: cannot parse response")
+	}
+
+	return utils.Marshal(res), nil
+}
+
+func (c *ChatInstance) DeleteVideoRequest(props *adaptercommon.VideoJobProps) error {
+	data, err := utils.HttpRaw(c.getVideoQueryEndpoint(props.Id), http.MethodDelete, c.GetHeader(), nil, []globals.ProxyConfig{props.Proxy})
+	if err != nil {
+		return fmt.Errorf("openai video error: %s", err.Error())
+	}
+
+	res, err := utils.UnmarshalString[VideoDeleteResponse](string(data))
+	if err != nil {
+		return fmt.Errorf("openai video error: cannot parse response")
+	}
+	if !res.Deleted {
+		if res.Error != nil && res.Error.Message != "" {
+			return fmt.Errorf("openai video error: %s", res.Error.Message)
+		}
+		return fmt.Errorf("openai video error: video job %s is not deleted", props.Id)
+	}
+
+	return nil
+}
+
+func (c *ChatInstance) GetVideoContentRequest(props *adaptercommon.VideoJobProps) ([]byte, error) {
+	data, err := utils.HttpRaw(c.getVideoContentEndpoint(props.Id), http.MethodGet, c.GetHeader(), nil, []globals.ProxyConfig{props.Proxy})
+	if err != nil || len(data) == 0 {
+		if err != nil {
+			return nil, fmt.Errorf("openai video error: %s", err.Error())
+		}
+		return nil, fmt.Errorf("openai video error: empty response")
+	}
+
+	// the error is responded in json instead of the video file
+	if res, err := utils.UnmarshalString[VideoDeleteResponse](string(data)); err == nil && res.Error != nil && res.Error.Message != "" {
+		return nil, fmt.Errorf("openai video error: %s", res.Error.Message)
+	}
+
+	return data, nil
+}
@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -58,14 +59,29 @@ func (c *ChatInstance) GetPalm2ChatBody(props *adaptercommon.ChatProps) *PalmCha
 }
 
 func (c *ChatInstance) GetGeminiChatBody(props *adaptercommon.ChatProps) *GeminiChatBody {
+	config := GeminiConfig{
+		Temperature:     props.Temperature,
+		MaxOutputTokens: props.MaxTokens,
+		TopP:            props.TopP,
+		TopK:            props.TopK,
+		StopSequences:   props.Stop,
+		Seed:            props.Seed,
+		CandidateCount:  props.N,
+	}
+
+	switch format, schema := props.GetResponseFormat(); format {
+	case "json_object":
+		config.ResponseMimeType = "application/json"
+	case "json_schema":
+		config.ResponseMimeType = "application/json"
+		config.ResponseSchema = getGeminiSchema(schema)
+	}
+
 	return &GeminiChatBody{
-		Contents: c.GetGeminiContents(props.Model, props.Message),
-		GenerationConfig: GeminiConfig{
-			Temperature:     props.Temperature,
-			MaxOutputTokens: props.MaxTokens,
-			TopP:            props.TopP,
-			TopK:            props.TopK,
-		},
+		Contents:         c.GetGeminiContents(props.Model, props.Message),
+		GenerationConfig: config,
+		Tools:            getGeminiTools(props),
+		ToolConfig:       getGeminiToolConfig(props),
 	}
 }
 
@@ -119,7 +135,7 @@ func (c *ChatInstance) CreateChatRequest(props *adaptercommon.ChatProps) (string
 }
 
 // CreateStreamChatRequest is the stream request for palm2
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	// Handle imagen models
 	if globals.IsGoogleImagenModel(props.Model) {
 		response, err := c.CreateImage(props)
@@ -144,10 +160,12 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, c
 		return nil
 	}
 
-	ticks := 0
+	ticks, calls := 0, 0
 	scanErr := utils.EventScanner(&utils.EventScannerProps{
-		Method: "POST",
-		Uri:    c.GetChatEndpoint(props.Model, true),
+		Ctx:     ctx,
+		Timeout: props.Timeout,
+		Method:  "POST",
+		Uri:     c.GetChatEndpoint(props.Model, true),
 		Headers: map[string]string{
 			"Content-Type": "application/json",
 		},
@@ -156,9 +174,58 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, c
 			ticks += 1
 
 			if form := utils.UnmarshalForm[GeminiStreamResponse](data); form != nil {
-				if len(form.Candidates) != 0 && len(form.Candidates[0].Content.Parts) != 0 {
+				// multiple candidates are returned when the candidate count (n) is greater than 1
+				for _, candidate := range form.Candidates {
+					if len(candidate.Content.Parts) == 0 {
+						continue
+					}
+
+					// the function calls are returned as the whole parts (the arguments are not streamed)
+					var content string
+					var tools globals.ToolCalls
+					for _, part := range candidate.Content.Parts {
+						content += part.Text
+
+						if part.FunctionCall != nil {
+							index := calls
+							calls += 1
+
+							args := part.FunctionCall.Args
+							if args == nil {
+								args = map[string]interface{}{}
+							}
+
+							tools = append(tools, globals.ToolCall{
+								Index: &index,
+								Type:  "function",
+								Id:    fmt.Sprintf("call_%s", utils.GenerateChar(24)),
+								Function: globals.ToolCallFunction{
+									Name:      part.FunctionCall.Name,
+									Arguments: utils.Marshal(args),
+								},
+							})
+						}
+					}
+
+					if err := callback(&globals.Chunk{
+						Content:  content,
+						ToolCall: utils.Multi[*globals.ToolCalls](len(tools) > 0, &tools, nil),
+						Index:    candidate.Index,
+					}); err != nil {
+						return err
+					}
+				}
+
+				if usage := form.UsageMetadata; usage != nil {
+					// the thoughts tokens are billed as the output tokens
 					return callback(&globals.Chunk{
-						Content: form.Candidates[0].Content.Parts[0].Text,
+						Content: "",
+						Usage: &globals.ChunkUsage{
+							InputTokens:     usage.PromptTokenCount,
+							OutputTokens:    usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+							ReasoningTokens: usage.ThoughtsTokenCount,
+							CacheReadTokens: usage.CachedContentTokenCount,
+						},
 					})
 				}
 				return nil
@@ -1,22 +1,57 @@
 package palm2
 
 import (
+	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"fmt"
 	"strings"
 )
 
 func getGeminiRole(role string) string {
 	switch role {
-	case globals.User:
+	case globals.User, globals.Tool:
+		// the function responses are sent by the user
 		return GeminiUserType
-	case globals.Assistant, globals.Tool, globals.System:
+	case globals.Assistant, globals.System:
 		return GeminiModelType
 	default:
 		return GeminiUserType
 	}
 }
 
+// getGeminiSchema converts the json schema to the gemini response schema (openapi schema subset),
+// the unsupported keywords (e.g. additionalProperties, $schema) are removed
+func getGeminiSchema(schema interface{}) interface{} {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			switch key {
+			case "additionalProperties", "$schema", "$id", "strict":
+				continue
+			case "properties":
+				// property names should be kept as they are
+				if properties, ok := value.(map[string]interface{}); ok {
+					mapper := make(map[string]interface{}, len(properties))
+					for name, property := range properties {
+						mapper[name] = getGeminiSchema(property)
+					}
+					result[key] = mapper
+					continue
+				}
+			}
+
+			result[key] = getGeminiSchema(value)
+		}
+		return result
+	case []interface{}:
+		return utils.Each(v, getGeminiSchema)
+	default:
+		return v
+	}
+}
+
 func getMimeType(content string) string {
 	segment := strings.Split(content, ".")
 	if len(segment) == 0 || len(segment) == 1 {
@@ -76,18 +111,150 @@ func getGeminiContent(parts []GeminiChatPart, content string, model string) []Ge
 	return parts
 }
 
+// getGeminiInlineData returns the inline data of the data url or the remote image url
+func getGeminiInlineData(url string) *GeminiInlineData {
+	if mime, data, ok := utils.ParseDataUrl(url); ok {
+		return &GeminiInlineData{MimeType: mime, Data: data}
+	}
+
+	data, err := utils.ConvertToBase64(url)
+	if err != nil {
+		return nil
+	}
+
+	return &GeminiInlineData{MimeType: getMimeType(url), Data: data}
+}
+
+// getGeminiContentParts converts the content parts to the gemini parts, the images, audios and files are sent as the inline data
+// (the images are dropped for the non-vision model)
+func getGeminiContentParts(parts []GeminiChatPart, content []globals.ContentPart, model string) []GeminiChatPart {
+	images := 0
+	for _, part := range content {
+		switch part.Type {
+		case globals.ContentTypeText:
+			if part.Text != nil && len(*part.Text) > 0 {
+				parts = append(parts, GeminiChatPart{Text: part.Text})
+			}
+		case globals.ContentTypeImageUrl:
+			if part.ImageUrl == nil || images >= geminiMaxImages || model == globals.GeminiPro {
+				continue
+			}
+
+			if data := getGeminiInlineData(part.ImageUrl.Url); data != nil {
+				images++
+				parts = append(parts, GeminiChatPart{InlineData: data})
+			}
+		case globals.ContentTypeInputAudio:
+			if part.InputAudio != nil {
+				parts = append(parts, GeminiChatPart{
+					InlineData: &GeminiInlineData{
+						MimeType: fmt.Sprintf("audio/%s", part.InputAudio.Format),
+						Data:     part.InputAudio.Data,
+					},
+				})
+			}
+		case globals.ContentTypeFile:
+			if part.File == nil || part.File.FileData == nil {
+				continue
+			}
+
+			if mime, data, ok := utils.ParseDataUrl(*part.File.FileData); ok {
+				parts = append(parts, GeminiChatPart{
+					InlineData: &GeminiInlineData{MimeType: mime, Data: data},
+				})
+			}
+		}
+	}
+
+	return parts
+}
+
+// getToolName returns the function name of the tool message, which is looked up from the tool calls of the messages
+func getToolName(item globals.Message, message []globals.Message) string {
+	if item.Name != nil {
+		return *item.Name
+	}
+
+	for _, msg := range message {
+		if msg.ToolCalls == nil {
+			continue
+		}
+
+		for _, call := range *msg.ToolCalls {
+			if item.ToolCallId != nil && call.Id == *item.ToolCallId {
+				return call.Function.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+// getFunctionResponse returns the response object of the tool message (the non-object content is wrapped)
+func getFunctionResponse(content string) interface{} {
+	if response, err := utils.UnmarshalString[map[string]interface{}](content); err == nil && response != nil {
+		return response
+	}
+
+	return map[string]interface{}{
+		"content": content,
+	}
+}
+
+// getGeminiParts converts the message to the gemini parts, the tool calls are converted to the `functionCall` parts
+// and the tool messages to the `functionResponse` parts
+func getGeminiParts(item globals.Message, message []globals.Message, model string) []GeminiChatPart {
+	parts := make([]GeminiChatPart, 0)
+
+	if item.Role == globals.Tool {
+		if name := getToolName(item, message); name != "" {
+			return append(parts, GeminiChatPart{
+				FunctionResponse: &GeminiFunctionResponse{
+					Name:     name,
+					Response: getFunctionResponse(item.Content),
+				},
+			})
+		}
+	}
+
+	if len(item.Parts) > 0 {
+		parts = getGeminiContentParts(parts, item.Parts, model)
+	} else if len(item.Content) > 0 {
+		parts = getGeminiContent(parts, item.Content, model)
+	}
+
+	if item.Role == globals.Assistant && item.ToolCalls != nil {
+		for _, call := range *item.ToolCalls {
+			args, err := utils.UnmarshalString[map[string]interface{}](call.Function.Arguments)
+			if err != nil || args == nil {
+				args = map[string]interface{}{}
+			}
+
+			parts = append(parts, GeminiChatPart{
+				FunctionCall: &GeminiFunctionCall{
+					Name: call.Function.Name,
+					Args: args,
+				},
+			})
+		}
+	}
+
+	return parts
+}
+
 func (c *ChatInstance) GetGeminiContents(model string, message []globals.Message) []GeminiContent {
 	// gemini role should be user-model
 
 	result := make([]GeminiContent, 0)
 	for _, item := range message {
 		role := getGeminiRole(item.Role)
-		if len(item.Content) == 0 {
+		parts := getGeminiParts(item, message, model)
+		if len(parts) == 0 {
 			// gemini model: message must include non empty content
 			continue
 		}
 
-		if len(result) == 0 && getGeminiRole(item.Role) == GeminiModelType {
+		if len(result) == 0 && role == GeminiModelType {
 			// gemini model: first message must be user
 
 			result = append(result, GeminiContent{
@@ -98,15 +265,64 @@ func (c *ChatInstance) GetGeminiContents(model string, message []globals.Message
 
 		if len(result) > 0 && role == result[len(result)-1].Role {
 			// gemini model: messages must alternate between authors
-			result[len(result)-1].Parts = getGeminiContent(result[len(result)-1].Parts, item.Content, model)
+			result[len(result)-1].Parts = append(result[len(result)-1].Parts, parts...)
 			continue
 		}
 
 		result = append(result, GeminiContent{
-			Role:  getGeminiRole(item.Role),
-			Parts: getGeminiContent(make([]GeminiChatPart, 0), item.Content, model),
+			Role:  role,
+			Parts: parts,
 		})
 	}
 
 	return result
 }
+
+// getGeminiTools converts the openai function tools to the gemini function declarations
+func getGeminiTools(props *adaptercommon.ChatProps) []GeminiTool {
+	if props.Tools == nil || len(*props.Tools) == 0 {
+		return nil
+	}
+
+	return []GeminiTool{{
+		FunctionDeclarations: utils.Each(*props.Tools, func(tool globals.ToolObject) GeminiFunctionDeclaration {
+			declaration := GeminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+			}
+
+			// gemini api does not allow the object parameters without properties
+			if len(tool.Function.Parameters.Properties) > 0 {
+				if schema, err := utils.UnmarshalString[map[string]interface{}](utils.Marshal(tool.Function.Parameters)); err == nil {
+					declaration.Parameters = getGeminiSchema(schema)
+				}
+			}
+
+			return declaration
+		}),
+	}}
+}
+
+// getGeminiToolConfig converts the openai tool choice to the gemini function calling config
+func getGeminiToolConfig(props *adaptercommon.ChatProps) *GeminiToolConfig {
+	if props.Tools == nil {
+		return nil
+	}
+
+	config := GeminiFunctionCallingConfig{}
+	switch mode, name := props.GetToolChoice(); mode {
+	case "none":
+		config.Mode = "NONE"
+	case "required":
+		config.Mode = "ANY"
+	case "function":
+		config.Mode = "ANY"
+		config.AllowedFunctionNames = []string{name}
+	default:
+		return nil
+	}
+
+	return &GeminiToolConfig{
+		FunctionCallingConfig: config,
+	}
+}
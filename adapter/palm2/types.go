@@ -26,15 +26,41 @@ type PalmChatResponse struct {
 
 // GeminiChatBody is the native http request body for gemini
 type GeminiChatBody struct {
-	Contents         []GeminiContent `json:"contents"`
-	GenerationConfig GeminiConfig    `json:"generationConfig"`
+	Contents         []GeminiContent   `json:"contents"`
+	GenerationConfig GeminiConfig      `json:"generationConfig"`
+	Tools            []GeminiTool      `json:"tools,omitempty"`
+	ToolConfig       *GeminiToolConfig `json:"toolConfig,omitempty"`
+}
+
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type GeminiFunctionDeclaration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig GeminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type GeminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"` // AUTO, ANY or NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
 }
 
 type GeminiConfig struct {
-	Temperature     *float32 `json:"temperature,omitempty"`
-	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
-	TopP            *float32 `json:"topP,omitempty"`
-	TopK            *int     `json:"topK,omitempty"`
+	Temperature      *float32    `json:"temperature,omitempty"`
+	MaxOutputTokens  *int        `json:"maxOutputTokens,omitempty"`
+	TopP             *float32    `json:"topP,omitempty"`
+	TopK             *int        `json:"topK,omitempty"`
+	StopSequences    []string    `json:"stopSequences,omitempty"`
+	Seed             *int        `json:"seed,omitempty"`
+	CandidateCount   *int        `json:"candidateCount,omitempty"`
+	ResponseMimeType string      `json:"responseMimeType,omitempty"`
+	ResponseSchema   interface{} `json:"responseSchema,omitempty"`
 }
 
 type GeminiContent struct {
@@ -43,8 +69,20 @@ type GeminiContent struct {
 }
 
 type GeminiChatPart struct {
-	Text       *string           `json:"text,omitempty"`
-	InlineData *GeminiInlineData `json:"inline_data,omitempty"`
+	Text             *string                 `json:"text,omitempty"`
+	InlineData       *GeminiInlineData       `json:"inline_data,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type GeminiFunctionCall struct {
+	Name string      `json:"name"`
+	Args interface{} `json:"args"`
+}
+
+type GeminiFunctionResponse struct {
+	Name     string      `json:"name"`
+	Response interface{} `json:"response"`
 }
 
 type GeminiInlineData struct {
@@ -73,13 +111,25 @@ type GeminiChatErrorResponse struct {
 
 type GeminiStreamResponse struct {
 	Candidates []struct {
+		Index   int `json:"index"`
 		Content struct {
 			Parts []struct {
-				Text string `json:"text"`
+				Text         string              `json:"text"`
+				FunctionCall *GeminiFunctionCall `json:"functionCall,omitempty"`
 			} `json:"parts"`
 			Role string `json:"role"`
 		} `json:"content"`
 	} `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+}
+
+// GeminiUsageMetadata is the cumulative usage reported in each stream chunk
+type GeminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"` // included in the prompt tokens
+	TotalTokenCount         int `json:"totalTokenCount"`
 }
 
 // ImageRequest is the native http request body for imagen
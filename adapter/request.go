@@ -4,17 +4,43 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
 func IsAvailableError(err error) bool {
-	return err != nil && (err.Error() != "signal" && !strings.Contains(err.Error(), "signal"))
+	return err != nil && (err.Error() != "signal" && !strings.Contains(err.Error(), "signal")) && !IsCanceledError(err)
 }
 
 func IsSkipError(err error) bool {
-	return err == nil || (err.Error() == "signal" || strings.Contains(err.Error(), "signal"))
+	return err == nil || (err.Error() == "signal" || strings.Contains(err.Error(), "signal")) || IsCanceledError(err)
+}
+
+// IsCanceledError returns whether the request is aborted by the client (disconnected or stopped)
+func IsCanceledError(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// PartialError is the error raised after the partial content is sent to the hook (e.g. the stream is stalled midway),
+// the request is neither retried nor failed over to the next channel, otherwise the client receives the concatenated answers
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+func IsPartialError(err error) bool {
+	var partial *PartialError
+	return errors.As(err, &partial)
 }
 
 func isQPSOverLimit(model string, err error) bool {
@@ -24,8 +50,23 @@ func isQPSOverLimit(model string, err error) bool {
 	return false
 }
 
-func NewChatRequest(conf globals.ChannelConfig, props *adaptercommon.ChatProps, hook globals.Hook) error {
-	err := createChatRequest(conf, props, hook)
+func NewChatRequest(ctx context.Context, conf globals.ChannelConfig, props *adaptercommon.ChatProps, hook globals.Hook) error {
+	streamed := false
+	err := createChatRequest(ctx, conf, props, func(data *globals.Chunk) error {
+		if !data.IsEmpty() {
+			streamed = true
+		}
+		return hook(data)
+	})
+	if ctx.Err() != nil {
+		// the upstream connection is aborted by the client, no retry is needed
+		return ctx.Err()
+	}
+
+	if err != nil && streamed {
+		// the partial content is already sent, terminate the stream with the error instead of retrying
+		return &PartialError{Err: conf.ProcessError(err)}
+	}
 
 	retries := conf.GetRetry()
 	props.Current++
@@ -36,13 +77,13 @@ func NewChatRequest(conf globals.ChannelConfig, props *adaptercommon.ChatProps,
 
 			globals.Info(fmt.Sprintf("qps limit for %s, sleep and retry (times: %d)", props.OriginalModel, props.Current))
 			time.Sleep(500 * time.Millisecond)
-			return NewChatRequest(conf, props, hook)
+			return NewChatRequest(ctx, conf, props, hook)
 		}
 
 		if props.Current < retries {
 			content := strings.Replace(err.Error(), "\n", "", -1)
 			globals.Warn(fmt.Sprintf("retrying chat request for %s (attempt %d/%d, error: %s)", props.OriginalModel, props.Current+1, retries, content))
-			return NewChatRequest(conf, props, hook)
+			return NewChatRequest(ctx, conf, props, hook)
 		}
 	}
 
@@ -74,6 +115,66 @@ func NewVideoRequest(conf globals.ChannelConfig, props *adaptercommon.VideoProps
 	return conf.ProcessError(err)
 }
 
+// retryRequest sends the request to the channel and retries the available errors up to the channel retries
+func retryRequest[T any](conf globals.ChannelConfig, kind string, model string, current *int, request func() (T, error)) (T, error) {
+	for {
+		resp, err := request()
+
+		retries := conf.GetRetry()
+		*current++
+
+		if !IsAvailableError(err) || *current >= retries {
+			return resp, conf.ProcessError(err)
+		}
+
+		content := strings.Replace(err.Error(), "\n", "", -1)
+		globals.Info(fmt.Sprintf("retrying %s request for %s (attempt %d/%d, error: %s)", kind, model, *current+1, retries, content))
+	}
+}
+
+func NewVideoRetrieveRequest(conf globals.ChannelConfig, props *adaptercommon.VideoJobProps) (string, error) {
+	return retryRequest(conf, "video retrieve", props.OriginalModel, &props.Current, func() (string, error) {
+		return createVideoRetrieveRequest(conf, props)
+	})
+}
+
+func NewVideoDeleteRequest(conf globals.ChannelConfig, props *adaptercommon.VideoJobProps) error {
+	_, err := retryRequest(conf, "video delete", props.OriginalModel, &props.Current, func() (struct{}, error) {
+		return struct{}{}, createVideoDeleteRequest(conf, props)
+	})
+	return err
+}
+
+func NewVideoContentRequest(conf globals.ChannelConfig, props *adaptercommon.VideoJobProps) ([]byte, error) {
+	return retryRequest(conf, "video content", props.OriginalModel, &props.Current, func() ([]byte, error) {
+		return createVideoContentRequest(conf, props)
+	})
+}
+
+func NewEmbeddingRequest(conf globals.ChannelConfig, props *adaptercommon.EmbeddingProps) (*adaptercommon.EmbeddingResponse, error) {
+	return retryRequest(conf, "embedding", props.OriginalModel, &props.Current, func() (*adaptercommon.EmbeddingResponse, error) {
+		return createEmbeddingRequest(conf, props)
+	})
+}
+
+func NewAudioRequest(conf globals.ChannelConfig, props *adaptercommon.AudioProps) (*adaptercommon.AudioResponse, error) {
+	return retryRequest(conf, "audio", props.OriginalModel, &props.Current, func() (*adaptercommon.AudioResponse, error) {
+		return createAudioRequest(conf, props)
+	})
+}
+
+func NewImageRequest(conf globals.ChannelConfig, props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	return retryRequest(conf, "image", props.OriginalModel, &props.Current, func() (*adaptercommon.ImageResponse, error) {
+		return createImageRequest(conf, props)
+	})
+}
+
+func NewModerationRequest(conf globals.ChannelConfig, props *adaptercommon.ModerationProps) (*adaptercommon.ModerationResponse, error) {
+	return retryRequest(conf, "moderation", props.OriginalModel, &props.Current, func() (*adaptercommon.ModerationResponse, error) {
+		return createModerationRequest(conf, props)
+	})
+}
+
 func ClearMessages(model string, messages []globals.Message) []globals.Message {
 	if globals.IsVisionModel(model) || utils.IsCustomVisionModel(model) {
 		return messages
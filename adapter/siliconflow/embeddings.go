@@ -0,0 +1,64 @@
+package siliconflow
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/utils"
+	"fmt"
+)
+
+// Embedding request for SiliconFlow API (openai compatible)
+type EmbeddingRequest struct {
+	Model          string      `json:"model"`
+	Input          interface{} `json:"input"`
+	EncodingFormat *string     `json:"encoding_format,omitempty"`
+	Dimensions     *int        `json:"dimensions,omitempty"`
+}
+
+type EmbeddingItem struct {
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"`
+}
+
+// Embedding response from SiliconFlow API
+type EmbeddingResponse struct {
+	Data  []EmbeddingItem `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func (c *ChatInstance) GetEmbeddingEndpoint() string {
+	return c.GetEndpoint() + "/embeddings"
+}
+
+// CreateEmbeddingRequest calls SiliconFlow API to create the embeddings of the input texts
+func (c *ChatInstance) CreateEmbeddingRequest(props *adaptercommon.EmbeddingProps) (*adaptercommon.EmbeddingResponse, error) {
+	res, err := utils.Post(c.GetEmbeddingEndpoint(), c.GetHeader(), EmbeddingRequest{
+		Model:          props.Model,
+		Input:          props.Input,
+		EncodingFormat: props.EncodingFormat,
+		Dimensions:     props.Dimensions,
+	}, props.Proxy)
+	if err != nil || res == nil {
+		return nil, fmt.Errorf("siliconflow api request failed: %s", utils.GetError(err))
+	}
+
+	data := utils.MapToStruct[EmbeddingResponse](res)
+	if data == nil || len(data.Data) == 0 {
+		if form := utils.MapToStruct[ErrorResponse](res); form != nil && form.Error.Message != "" {
+			return nil, fmt.Errorf("siliconflow error: %s", form.Error.Message)
+		}
+		return nil, fmt.Errorf("siliconflow error: empty embedding response")
+	}
+
+	return &adaptercommon.EmbeddingResponse{
+		Data: utils.Each(data.Data, func(item EmbeddingItem) adaptercommon.EmbeddingData {
+			return adaptercommon.EmbeddingData{
+				Index:     item.Index,
+				Embedding: item.Embedding,
+			}
+		}),
+		InputTokens: utils.Multi(data.Usage.PromptTokens > 0, data.Usage.PromptTokens, data.Usage.TotalTokens),
+	}, nil
+}
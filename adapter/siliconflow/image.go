@@ -8,6 +8,7 @@ import (
 	"chat/globals"
 	"chat/utils"
 	"fmt"
+	"net/http"
 	"strings"
 )
 
@@ -272,4 +273,74 @@ func (c *ChatInstance) GetLatestPrompt(props *adaptercommon.ChatProps) string {
 // IsImageModel checks if the model supports image generation
 func (c *ChatInstance) IsImageModel(model string) bool {
 	return globals.IsSiliconFlowImageModel(model)
-}
\ No newline at end of file
+}
+// variationPrompt is the prompt of the variation request, siliconflow requires the prompt for the image-to-image models
+const variationPrompt = "a variation of the input image"
+
+// getImageCfg returns the default cfg of the qwen image models, 0 for the other models
+func getImageCfg(model string) float32 {
+	model = strings.ToLower(model)
+	if !strings.Contains(model, "qwen") {
+		return 0
+	}
+
+	if strings.Contains(model, "edit") {
+		return 4.0
+	}
+	return 7.5
+}
+
+// createImages generates the images one by one (the batch size is not supported by all the models)
+func (c *ChatInstance) createImages(props *adaptercommon.ImageProps, prompt string, inputImage string) (*adaptercommon.ImageResponse, error) {
+	size := "1024x1024"
+	if width, height := props.GetSize(); width > 0 {
+		size = fmt.Sprintf("%dx%d", width, height)
+	}
+
+	resp := &adaptercommon.ImageResponse{}
+	for i := 0; i < props.GetN(); i++ {
+		data, err := c.CreateImageRequest(ImageProps{
+			Model:      props.Model,
+			Prompt:     prompt,
+			ImageSize:  size,
+			BatchSize:  1,
+			Cfg:        getImageCfg(props.Model),
+			InputImage: inputImage,
+			User:       props.User,
+			Proxy:      props.Proxy,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Images = append(resp.Images, adaptercommon.ImageData{
+			B64Json: utils.SafeSplit(data, ",", 2)[1],
+		})
+	}
+
+	return resp, nil
+}
+
+// getInputImage converts the uploaded image to the data uri
+func getInputImage(data []byte) string {
+	return fmt.Sprintf("data:%s;base64,%s", http.DetectContentType(data), base64.StdEncoding.EncodeToString(data))
+}
+
+// CreateImageGenerationRequest will create the images from prompt
+func (c *ChatInstance) CreateImageGenerationRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	return c.createImages(props, props.Prompt, "")
+}
+
+// CreateImageEditRequest will edit the input image from prompt, the mask is not supported by siliconflow
+func (c *ChatInstance) CreateImageEditRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	if len(props.Mask) > 0 {
+		return nil, fmt.Errorf("siliconflow error: mask is not supported")
+	}
+
+	return c.createImages(props, props.Prompt, getInputImage(props.Image))
+}
+
+// CreateImageVariationRequest will create the variations of the input image
+func (c *ChatInstance) CreateImageVariationRequest(props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	return c.createImages(props, variationPrompt, getInputImage(props.Image))
+}
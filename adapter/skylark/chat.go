@@ -101,15 +101,14 @@ func getChoice(choice model.ChatCompletionStreamResponse) *globals.Chunk {
 
 	message := choice.Choices[0].Delta
 	return &globals.Chunk{
-		Content:  message.Content,
-		ToolCall: getToolCalls(choice.ID, message),
+		Content:   message.Content,
+		Reasoning: utils.GetPtrVal(message.ReasoningContent, ""),
+		ToolCall:  getToolCalls(choice.ID, message),
 	}
 }
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	req := c.CreateRequest(props)
-	c.isFirstReasoning = true
-	c.isReasonOver = false
 
 	if globals.DebugMode {
 		globals.Debug(fmt.Sprintf("[skylark] request: %v", utils.Marshal(req)))
@@ -140,31 +139,7 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, c
 			globals.Debug(fmt.Sprintf("[skylark] response: %v", utils.Marshal(recv)))
 		}
 
-		choice := getChoice(recv)
-		if len(recv.Choices) > 0 {
-			delta := recv.Choices[0].Delta
-
-			// Handle reasoning content
-			if c.isFirstReasoning == false && !c.isReasonOver && delta.ReasoningContent == nil {
-				c.isReasonOver = true
-				if delta.Content != "" {
-					choice.Content = fmt.Sprintf("\n</think>\n\n%s", delta.Content)
-				} else {
-					choice.Content = "\n</think>\n\n"
-				}
-			}
-
-			if delta.ReasoningContent != nil {
-				if c.isFirstReasoning {
-					c.isFirstReasoning = false
-					choice.Content = fmt.Sprintf("<think>\n%s", *delta.ReasoningContent)
-				} else {
-					choice.Content = *delta.ReasoningContent
-				}
-			}
-		}
-
-		if err = callback(choice); err != nil {
+		if err = callback(getChoice(recv)); err != nil {
 			return err
 		}
 	}
@@ -8,18 +8,14 @@ import (
 )
 
 type ChatInstance struct {
-	Instance         *arkruntime.Client
-	isFirstReasoning bool
-	isReasonOver     bool
+	Instance *arkruntime.Client
 }
 
 func NewChatInstance(endpoint, apiKey string) *ChatInstance {
 	//https://ark.cn-beijing.volces.com/api/v3
 	instance := arkruntime.NewClientWithApiKey(apiKey, arkruntime.WithBaseUrl(endpoint))
 	return &ChatInstance{
-		Instance:         instance,
-		isFirstReasoning: true,
-		isReasonOver:     false,
+		Instance: instance,
 	}
 }
 
@@ -6,12 +6,12 @@ import (
 	"context"
 )
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, hook globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, hook globals.Hook) error {
 	if err := c.Instance.NewChannel(c.GetChannel()); err != nil {
 		return err
 	}
 
-	resp, err := c.Instance.Reply(context.Background(), c.FormatMessage(props.Message), nil)
+	resp, err := c.Instance.Reply(ctx, c.FormatMessage(props.Message), nil)
 	if err != nil {
 		return err
 	}
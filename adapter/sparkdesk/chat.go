@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -114,7 +115,7 @@ func getChoice(form *ChatResponse) *globals.Chunk {
 	}
 }
 
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, hook globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, hook globals.Hook) error {
 	var endpoint string
 	switch props.Model {
 	case globals.SparkDeskPro128K, globals.SparkDeskMax32K:
@@ -123,7 +124,7 @@ func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, h
 		endpoint = fmt.Sprintf("%s/%s/chat", c.Endpoint, TransformAddr(props.Model))
 	}
 	var conn *utils.WebSocket
-	if conn = utils.NewWebsocketClient(c.GenerateUrl(endpoint)); conn == nil {
+	if conn = utils.NewWebsocketClient(ctx, c.GenerateUrl(endpoint)); conn == nil {
 		return fmt.Errorf("sparkdesk error: websocket connection failed")
 	}
 	defer conn.DeferClose()
@@ -4,6 +4,7 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -68,12 +69,13 @@ func (c *ChatInstance) CreateChatRequest(props *adaptercommon.ChatProps) (string
 }
 
 // CreateStreamChatRequest is the stream response body for zhinao
-func (c *ChatInstance) CreateStreamChatRequest(props *adaptercommon.ChatProps, callback globals.Hook) error {
+func (c *ChatInstance) CreateStreamChatRequest(ctx context.Context, props *adaptercommon.ChatProps, callback globals.Hook) error {
 	buf := ""
 	cursor := 0
 	chunk := ""
 
 	err := utils.EventSource(
+		ctx,
 		"POST",
 		c.GetChatEndpoint(),
 		c.GetHeader(),
@@ -0,0 +1,70 @@
+package zhipuai
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/utils"
+	"fmt"
+)
+
+type EmbeddingRequest struct {
+	Model      string      `json:"model"`
+	Input      interface{} `json:"input"`
+	Dimensions *int        `json:"dimensions,omitempty"`
+}
+
+type EmbeddingItem struct {
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+type EmbeddingResponse struct {
+	Data  []EmbeddingItem `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *ChatInstance) GetEmbeddingEndpoint() string {
+	return fmt.Sprintf("%s/api/paas/v4/embeddings", c.GetEndpoint())
+}
+
+// CreateEmbeddingRequest will create the embeddings of the input texts
+func (c *ChatInstance) CreateEmbeddingRequest(props *adaptercommon.EmbeddingProps) (*adaptercommon.EmbeddingResponse, error) {
+	texts := props.GetInputs()
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("chatglm error: only text inputs are supported")
+	}
+
+	res, err := utils.Post(c.GetEmbeddingEndpoint(), c.GetHeader(), EmbeddingRequest{
+		Model:      props.Model,
+		Input:      texts,
+		Dimensions: props.Dimensions,
+	}, props.Proxy)
+	if err != nil || res == nil {
+		return nil, fmt.Errorf("chatglm error: %s", utils.GetError(err))
+	}
+
+	data := utils.MapToStruct[EmbeddingResponse](res)
+	if data == nil {
+		return nil, fmt.Errorf("chatglm error: cannot parse response")
+	} else if data.Error.Message != "" {
+		return nil, fmt.Errorf("chatglm error: %s (code: %s)", data.Error.Message, data.Error.Code)
+	} else if len(data.Data) == 0 {
+		return nil, fmt.Errorf("chatglm error: empty embedding response")
+	}
+
+	return &adaptercommon.EmbeddingResponse{
+		Data: utils.Each(data.Data, func(item EmbeddingItem) adaptercommon.EmbeddingData {
+			return adaptercommon.EmbeddingData{
+				Index:     item.Index,
+				Embedding: item.Embedding,
+			}
+		}),
+		InputTokens: utils.Multi(data.Usage.PromptTokens > 0, data.Usage.PromptTokens, data.Usage.TotalTokens),
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"chat/channel"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 )
 
@@ -17,7 +18,7 @@ func CreateGeneration(group, model, prompt, path string, hook func(buffer *utils
 	message := GenerateMessage(prompt)
 	buffer := utils.NewBuffer(model, message, channel.ChargeInstance.GetCharge(model))
 
-	err := channel.NewChatRequest(group, adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
+	err := channel.NewChatRequest(context.Background(), group, adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
 		OriginalModel: model,
 		Message:       message,
 	}, buffer), func(data *globals.Chunk) error {
@@ -170,6 +170,13 @@ func InvitationPaginationAPI(c *gin.Context) {
 	c.JSON(http.StatusOK, GetInvitationPagination(db, int64(page)))
 }
 
+func ModerationLogPaginationAPI(c *gin.Context) {
+	db := utils.GetDBFromContext(c)
+
+	page, _ := strconv.Atoi(c.Query("page"))
+	c.JSON(http.StatusOK, GetModerationLogPagination(db, int64(page)))
+}
+
 func DeleteInvitationAPI(c *gin.Context) {
 	db := utils.GetDBFromContext(c)
 
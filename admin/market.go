@@ -2,6 +2,7 @@ package admin
 
 import (
 	"chat/globals"
+	"chat/utils"
 	"fmt"
 
 	"github.com/spf13/viper"
@@ -9,16 +10,24 @@ import (
 
 type ModelTag []string
 type MarketModel struct {
-	Id          string   `json:"id" mapstructure:"id" required:"true"`
-	Name        string   `json:"name" mapstructure:"name" required:"true"`
-	Description string   `json:"description" mapstructure:"description"`
-	Default     bool     `json:"default" mapstructure:"default"`
-	HighContext bool     `json:"high_context" mapstructure:"highcontext"`
-	Avatar      string   `json:"avatar" mapstructure:"avatar"`
-	Tag         ModelTag `json:"tag" mapstructure:"tag"`
+	Id            string   `json:"id" mapstructure:"id" required:"true"`
+	Name          string   `json:"name" mapstructure:"name" required:"true"`
+	Description   string   `json:"description" mapstructure:"description"`
+	Default       bool     `json:"default" mapstructure:"default"`
+	HighContext   bool     `json:"high_context" mapstructure:"highcontext"`
+	Avatar        string   `json:"avatar" mapstructure:"avatar"`
+	Tag           ModelTag `json:"tag" mapstructure:"tag"`
+	ContextLength int      `json:"context_length,omitempty" mapstructure:"contextlength"`
+	Capabilities  []string `json:"capabilities,omitempty" mapstructure:"capabilities"` // declared capabilities (vision, tools, reasoning)
 }
 type MarketModelList []MarketModel
 
+const (
+	CapabilityVision    = "vision"
+	CapabilityTools     = "tools"
+	CapabilityReasoning = "reasoning"
+)
+
 type Market struct {
 	Models MarketModelList `json:"models" mapstructure:"models"`
 }
@@ -48,6 +57,11 @@ func (m *Market) GetModel(id string) *MarketModel {
 	return nil
 }
 
+// HasCapability returns whether the capability is declared by the market model
+func (m *MarketModel) HasCapability(capability string) bool {
+	return m != nil && utils.Contains(capability, m.Capabilities)
+}
+
 func (m *Market) SaveConfig() error {
 	viper.Set("market", m.Models)
 	return viper.WriteConfig()
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"chat/globals"
+	"chat/utils"
+	"database/sql"
+	"fmt"
+	"math"
+)
+
+// AddModerationLog records the prompt blocked by the pre-flight moderation gate
+func AddModerationLog(db *sql.DB, username string, model string, source string, reason string, content string) {
+	if _, err := globals.ExecDb(db, `
+		INSERT INTO moderation_log (username, model, source, reason, content)
+		VALUES (?, ?, ?, ?, ?)
+	`, username, model, source, utils.Extract(reason, 250, "..."), content); err != nil {
+		globals.Warn(fmt.Sprintf("[moderation] failed to record moderation log: %s", err.Error()))
+	}
+}
+
+func GetModerationLogPagination(db *sql.DB, page int64) PaginationForm {
+	var logs []interface{}
+	var total int64
+	if err := globals.QueryRowDb(db, `
+		SELECT COUNT(*) FROM moderation_log
+	`).Scan(&total); err != nil {
+		return PaginationForm{
+			Status:  false,
+			Message: err.Error(),
+		}
+	}
+
+	rows, err := globals.QueryDb(db, `
+		SELECT id, username, model, source, reason, content, created_at
+		FROM moderation_log
+		ORDER BY id DESC LIMIT ? OFFSET ?
+	`, pagination, page*pagination)
+	if err != nil {
+		return PaginationForm{
+			Status:  false,
+			Message: err.Error(),
+		}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var log ModerationLogData
+		var createdAt []uint8
+		if err := rows.Scan(&log.Id, &log.Username, &log.Model, &log.Source, &log.Reason, &log.Content, &createdAt); err != nil {
+			return PaginationForm{
+				Status:  false,
+				Message: err.Error(),
+			}
+		}
+		if t := utils.ConvertTime(createdAt); t != nil {
+			log.CreatedAt = t.Format("2006-01-02 15:04:05")
+		}
+		logs = append(logs, log)
+	}
+
+	return PaginationForm{
+		Status: true,
+		Total:  int(math.Ceil(float64(total) / float64(pagination))),
+		Data:   logs,
+	}
+}
@@ -47,6 +47,8 @@ func Register(app *gin.RouterGroup) {
 
 	app.GET("/admin/user/quota/log", QuotaLogPaginationAPI)
 
+	app.GET("/admin/moderation/log", ModerationLogPaginationAPI)
+
 	app.GET("/admin/vision/config", GetVisionConfigAPI)
 	app.POST("/admin/vision/config", UpdateVisionConfigAPI)
 	app.POST("/admin/vision/refresh", RefreshVisionConfigAPI)
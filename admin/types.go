@@ -53,6 +53,16 @@ type InvitationData struct {
 	Username  string  `json:"username"`
 }
 
+type ModerationLogData struct {
+	Id        int64  `json:"id"`
+	Username  string `json:"username"`
+	Model     string `json:"model"`
+	Source    string `json:"source"`
+	Reason    string `json:"reason"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
 type RedeemData struct {
 	Code      string  `json:"code"`
 	Quota     float32 `json:"quota"`
@@ -12,6 +12,7 @@ export type StreamMessage = {
   keyword?: string;
   quota?: number;
   message: string;
+  reasoning?: string;
   end: boolean;
   plan?: boolean;
   title?: string;
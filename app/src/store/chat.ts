@@ -166,6 +166,18 @@ const chatSlice = createSlice({
         });
 
       const instance = conversation.messages[conversation.messages.length - 1];
+
+      // the reasoning content is rendered as the think block of the message
+      const thinking = () =>
+        instance.content.includes("<think>") &&
+        !instance.content.includes("</think>");
+      if (message.reasoning && message.reasoning.length > 0) {
+        if (!thinking()) instance.content += "<think>\n";
+        instance.content += message.reasoning;
+      }
+      if (thinking() && (message.message.length > 0 || message.end))
+        instance.content += "\n</think>\n\n";
+
       if (message.message.length > 0) instance.content += message.message;
       if (message.keyword) instance.keyword = message.keyword;
       if (message.quota) instance.quota = message.quota;
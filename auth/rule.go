@@ -26,7 +26,7 @@ func CanEnableModel(db *sql.DB, user *User, model string, messages []globals.Mes
 	charge := channel.ChargeInstance.GetCharge(model)
 
 	if charge.IsUnsetType() && !isAdmin {
-		return fmt.Errorf(ErrNotSetPrice, model)
+		return globals.NewModelNotFoundError(ErrNotSetPrice, model)
 	}
 
 	if !charge.IsBilling() {
@@ -35,11 +35,11 @@ func CanEnableModel(db *sql.DB, user *User, model string, messages []globals.Mes
 			return nil
 		}
 
-		return fmt.Errorf(ErrNotAuthenticated, model)
+		return globals.NewAuthenticationError(fmt.Sprintf(ErrNotAuthenticated, model))
 	}
 
 	if !isAuth {
-		return fmt.Errorf(ErrNotAuthenticated, model)
+		return globals.NewAuthenticationError(fmt.Sprintf(ErrNotAuthenticated, model))
 	}
 
 	// Calculate estimated input cost
@@ -49,7 +49,7 @@ func CanEnableModel(db *sql.DB, user *User, model string, messages []globals.Mes
 	// Get user's current quota
 	quota := user.GetQuota(db)
 	if quota < estimatedInputCost {
-		return fmt.Errorf(ErrEstimatedCost, model, estimatedInputCost, quota)
+		return globals.NewInsufficientQuotaError(ErrEstimatedCost, model, estimatedInputCost, quota)
 	}
 
 	return nil
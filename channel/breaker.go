@@ -0,0 +1,333 @@
+package channel
+
+import (
+	"chat/adapter"
+	"chat/globals"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"    // the channel is healthy
+	BreakerOpen     = "open"      // the channel is skipped until the cooldown is over
+	BreakerHalfOpen = "half_open" // the trial request is sent to probe the channel
+)
+
+var (
+	breakerConsecutiveErrors = 5                // consecutive errors to open the breaker
+	breakerWindowSize        = 20               // the latest results to calculate the error rate
+	breakerMinRequests       = 10               // minimum results in the window to apply the error rate
+	breakerErrorRate         = 0.5              // error rate to open the breaker
+	breakerCooldown          = 30 * time.Second // initial cooldown, doubled on every failed probe
+	breakerMaxCooldown       = 10 * time.Minute
+)
+
+// BreakerState is the health state of the channel circuit breaker
+type BreakerState struct {
+	State       string  `json:"state"`
+	Consecutive int     `json:"consecutive"`
+	ErrorRate   float64 `json:"error_rate"`
+	LastError   string  `json:"last_error,omitempty"`
+	OpenedAt    int64   `json:"opened_at,omitempty"`
+	RetryAt     int64   `json:"retry_at,omitempty"` // the time to probe the open channel
+}
+
+type Breaker struct {
+	mutex       sync.Mutex
+	state       string
+	consecutive int
+	results     []bool // ring buffer of the latest results (true for error)
+	cursor      int
+	lastError   string
+	openedAt    time.Time
+	cooldown    time.Duration
+	probing     bool // the trial request of the half-open channel is in flight
+}
+
+type BreakerManager struct {
+	mutex    sync.RWMutex
+	breakers map[int]*Breaker
+}
+
+var BreakerInstance = NewBreakerManager()
+
+func NewBreakerManager() *BreakerManager {
+	return &BreakerManager{
+		breakers: map[int]*Breaker{},
+	}
+}
+
+func newBreaker() *Breaker {
+	return &Breaker{
+		state:    BreakerClosed,
+		cooldown: breakerCooldown,
+	}
+}
+
+// Get returns the breaker of the channel, the breaker is created if not exists
+func (m *BreakerManager) Get(id int) *Breaker {
+	m.mutex.RLock()
+	breaker, ok := m.breakers[id]
+	m.mutex.RUnlock()
+
+	if ok {
+		return breaker
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if breaker, ok = m.breakers[id]; !ok {
+		breaker = newBreaker()
+		m.breakers[id] = breaker
+	}
+	return breaker
+}
+
+// Reset closes the breaker of the channel (e.g. the channel is updated or activated by the admin)
+func (m *BreakerManager) Reset(id int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.breakers, id)
+}
+
+// IsAvailable returns whether the channel can be picked by the ticker
+func (m *BreakerManager) IsAvailable(channel *Channel) bool {
+	return m.Get(channel.GetId()).IsAvailable()
+}
+
+// Begin marks the picked channel as requested, the open channel after the cooldown turns into half-open
+func (m *BreakerManager) Begin(channel *Channel) {
+	breaker := m.Get(channel.GetId())
+	if breaker.Begin() {
+		globals.Info(fmt.Sprintf("[breaker] channel %s (#%d) is half-open, probing with the trial request", channel.GetName(), channel.GetId()))
+	}
+}
+
+// Cancel releases the trial request of the half-open channel which is picked but not sent (e.g. the channel is saturated)
+func (m *BreakerManager) Cancel(channel *Channel) {
+	m.Get(channel.GetId()).Cancel()
+}
+
+// Record records the result of the channel request,
+// the client cancellation and the client-caused errors (e.g. invalid request, context length exceeded) are ignored
+func (m *BreakerManager) Record(channel *Channel, err error) {
+	if err != nil && (adapter.IsSkipError(err) || globals.IsClientError(err)) {
+		return
+	}
+
+	breaker := m.Get(channel.GetId())
+	before, after := breaker.Record(err)
+	if before == after {
+		return
+	}
+
+	switch after {
+	case BreakerOpen:
+		globals.Warn(fmt.Sprintf("[breaker] channel %s (#%d) is open for %s (error: %s)", channel.GetName(), channel.GetId(), breaker.GetCooldown(), breaker.GetLastError()))
+	case BreakerClosed:
+		globals.Info(fmt.Sprintf("[breaker] channel %s (#%d) is recovered and closed", channel.GetName(), channel.GetId()))
+	}
+}
+
+// RecordProbe records the result of the channel probe, the successful probe closes the open breaker immediately
+func (m *BreakerManager) RecordProbe(channel *Channel, err error) {
+	if err != nil {
+		m.Record(channel, err)
+		return
+	}
+
+	if breaker := m.Get(channel.GetId()); breaker.Close() {
+		globals.Info(fmt.Sprintf("[breaker] channel %s (#%d) is probed successfully and closed", channel.GetName(), channel.GetId()))
+	}
+}
+
+// GetState returns the health state of the channel
+func (m *BreakerManager) GetState(id int) BreakerState {
+	return m.Get(id).GetState()
+}
+
+func (b *Breaker) isCooling() bool {
+	return time.Since(b.openedAt) < b.cooldown
+}
+
+func (b *Breaker) IsAvailable() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		return !b.isCooling()
+	case BreakerHalfOpen:
+		// only one trial request at the same time, the stuck probe is released after the cooldown
+		return !b.probing || !b.isCooling()
+	default:
+		return true
+	}
+}
+
+// Begin returns true if the breaker turns into half-open
+func (b *Breaker) Begin() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerClosed:
+		return false
+	case BreakerOpen:
+		if b.isCooling() {
+			return false
+		}
+	case BreakerHalfOpen:
+		// the released probe is taken by the next request
+		if b.probing && b.isCooling() {
+			return false
+		}
+	}
+
+	changed := b.state == BreakerOpen
+	b.state = BreakerHalfOpen
+	b.openedAt = time.Now()
+	b.probing = true
+	return changed
+}
+
+// Cancel releases the probe of the half-open breaker, so that the next request is sent as the trial request
+func (b *Breaker) Cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// Record returns the state before and after recording the result
+func (b *Breaker) Record(err error) (string, string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	before := b.state
+	failed := err != nil
+
+	if len(b.results) < breakerWindowSize {
+		b.results = append(b.results, failed)
+	} else {
+		b.results[b.cursor] = failed
+		b.cursor = (b.cursor + 1) % breakerWindowSize
+	}
+
+	if !failed {
+		b.consecutive = 0
+		if b.state == BreakerHalfOpen {
+			b.close()
+		}
+		return before, b.state
+	}
+
+	b.consecutive++
+	b.lastError = strings.TrimSpace(err.Error())
+
+	switch b.state {
+	case BreakerHalfOpen:
+		// the probe is failed, open again with the longer cooldown
+		b.open(min(b.cooldown*2, breakerMaxCooldown))
+	case BreakerClosed:
+		if b.consecutive >= breakerConsecutiveErrors ||
+			(len(b.results) >= breakerMinRequests && b.getErrorRate() >= breakerErrorRate) {
+			b.open(breakerCooldown)
+		}
+	}
+
+	return before, b.state
+}
+
+// Close closes the breaker, returns true if the breaker is not closed before
+func (b *Breaker) Close() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == BreakerClosed {
+		return false
+	}
+
+	b.consecutive = 0
+	b.close()
+	return true
+}
+
+func (b *Breaker) open(cooldown time.Duration) {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.cooldown = cooldown
+	b.probing = false
+}
+
+func (b *Breaker) close() {
+	b.state = BreakerClosed
+	b.cooldown = breakerCooldown
+	b.probing = false
+	b.results = nil
+	b.cursor = 0
+}
+
+func (b *Breaker) getErrorRate() float64 {
+	if len(b.results) == 0 {
+		return 0
+	}
+
+	errors := 0
+	for _, failed := range b.results {
+		if failed {
+			errors++
+		}
+	}
+	return float64(errors) / float64(len(b.results))
+}
+
+func (b *Breaker) GetCooldown() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.cooldown
+}
+
+// GetOpenedAt returns the time when the breaker is opened, zero if the breaker is closed
+func (b *Breaker) GetOpenedAt() time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == BreakerClosed {
+		return time.Time{}
+	}
+	return b.openedAt
+}
+
+func (b *Breaker) GetLastError() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.lastError
+}
+
+func (b *Breaker) GetState() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state := BreakerState{
+		State:       b.state,
+		Consecutive: b.consecutive,
+		ErrorRate:   b.getErrorRate(),
+		LastError:   b.lastError,
+	}
+
+	if b.state != BreakerClosed {
+		state.OpenedAt = b.openedAt.Unix()
+		state.RetryAt = b.openedAt.Add(b.cooldown).Unix()
+	}
+
+	return state
+}
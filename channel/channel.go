@@ -54,34 +54,34 @@ func (c *Channel) GetSecret() string {
 	return c.Secret
 }
 
-func (c *Channel) GetCurrentSecret() *string {
-	return c.CurrentSecret
+// GetSecrets returns the secret list of the multi-secret channel (newline separated)
+func (c *Channel) GetSecrets() []string {
+	return strings.Split(c.GetSecret(), "\n")
 }
 
-// GetRandomSecret returns a random secret from the secret list
+// GetRandomSecret returns a random secret from the enabled secrets, all the secrets are used if none of them is enabled
 func (c *Channel) GetRandomSecret() string {
-	arr := strings.Split(c.GetSecret(), "\n")
+	arr := c.GetSecrets()
 	if len(arr) == 0 {
 		return ""
 	}
 
-	idx := utils.Intn(len(arr))
-	secret := arr[idx]
-
-	c.CurrentSecret = &secret
-	return secret
-}
-
-func (c *Channel) GetCurrentSecretValue() string {
-	if c.CurrentSecret == nil {
-		return ""
+	if enabled := utils.Filter(arr, func(secret string) bool {
+		return SecretInstance.IsEnabled(c.GetId(), secret)
+	}); len(enabled) > 0 {
+		arr = enabled
 	}
 
-	return *c.CurrentSecret
+	idx := utils.Intn(len(arr))
+	return arr[idx]
 }
 
 func (c *Channel) SplitRandomSecret(num int) []string {
-	secret := c.GetRandomSecret()
+	return splitSecret(c.GetRandomSecret(), num)
+}
+
+// splitSecret splits the secret by `|` into the fixed number of parts (e.g. the azure endpoint and the api key)
+func splitSecret(secret string, num int) []string {
 	arr := strings.Split(secret, "|")
 	if len(arr) == num {
 		return arr
@@ -187,6 +187,14 @@ func (c *Channel) GetProxy() globals.ProxyConfig {
 	return c.Proxy
 }
 
+func (c *Channel) GetLimit() ChannelLimit {
+	return c.Limit
+}
+
+func (c *Channel) GetTimeout() globals.TimeoutConfig {
+	return c.Timeout
+}
+
 func (c *Channel) IsHitGroup(group string) bool {
 	if len(c.GetGroup()) == 0 {
 		return true
@@ -219,10 +227,48 @@ func (c *Channel) ProcessError(err error) error {
 		content = strings.Replace(content, item, "chatnio_upstream", -1)
 	}
 
-	secret := c.GetCurrentSecret()
-	if secret != nil {
-		content = strings.Replace(content, *secret, utils.HideSecret(*secret), -1)
+	// the channel is shared by the concurrent requests, so all the secrets of the channel are hidden
+	for _, secret := range c.GetSecrets() {
+		for _, item := range append(strings.Split(secret, "|"), secret) {
+			if item = strings.TrimSpace(item); len(item) >= 8 {
+				content = strings.Replace(content, item, utils.HideSecret(item), -1)
+			}
+		}
 	}
 
 	return errors.New(content)
 }
+
+// ChannelRequest is the channel config of the single upstream request,
+// it keeps the secret picked by the adapter so that the result is attributed to the secret actually used
+type ChannelRequest struct {
+	*Channel
+	secret string
+	pinned bool // always use the secret instead of picking a random one
+}
+
+func NewChannelRequest(channel *Channel) *ChannelRequest {
+	return &ChannelRequest{Channel: channel}
+}
+
+// NewPinnedChannelRequest returns the request which always uses the secret,
+// e.g. the follow-up requests of the upstream job which only exists at the secret it is created with
+func NewPinnedChannelRequest(channel *Channel, secret string) *ChannelRequest {
+	return &ChannelRequest{Channel: channel, secret: secret, pinned: true}
+}
+
+func (r *ChannelRequest) GetRandomSecret() string {
+	if !r.pinned {
+		r.secret = r.Channel.GetRandomSecret()
+	}
+	return r.secret
+}
+
+func (r *ChannelRequest) SplitRandomSecret(num int) []string {
+	return splitSecret(r.GetRandomSecret(), num)
+}
+
+// GetUsedSecret returns the secret used by the latest attempt of the request, empty if the adapter has not picked any
+func (r *ChannelRequest) GetUsedSecret() string {
+	return r.secret
+}
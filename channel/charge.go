@@ -259,10 +259,36 @@ func (c *Charge) GetOutput() float32 {
 	return c.Output
 }
 
+// GetCacheRead returns the price of the cache read tokens, the input price if the cache read price is not set
+func (c *Charge) GetCacheRead() float32 {
+	if c.CacheRead <= 0 {
+		return c.GetInput()
+	}
+	return c.CacheRead
+}
+
+// GetCacheWrite returns the price of the cache write tokens, the input price if the cache write price is not set
+func (c *Charge) GetCacheWrite() float32 {
+	if c.CacheWrite <= 0 {
+		return c.GetInput()
+	}
+	return c.CacheWrite
+}
+
 func (c *Charge) SupportAnonymous() bool {
 	return c.Anonymous
 }
 
+// GetBatchRatio returns the ratio of the quota charged for the batch api requests
+func (c *Charge) GetBatchRatio() float32 {
+	if c.BatchDiscount <= 0 {
+		return 1
+	} else if c.BatchDiscount >= 1 {
+		return 0
+	}
+	return 1 - c.BatchDiscount
+}
+
 func (c *Charge) IsBilling() bool {
 	return c.GetType() != globals.NonBilling
 }
@@ -280,6 +306,12 @@ func (c *Charge) GetLimit() float32 {
 	case globals.TokenBilling:
 		// 1k input tokens + 1k output tokens
 		return c.GetInput() + c.GetOutput()
+	case globals.SecondBilling:
+		// 1 minute of audio
+		return c.GetInput() * 60
+	case globals.CharacterBilling:
+		// 1k characters
+		return c.GetInput()
 	default:
 		return 0
 	}
@@ -296,5 +328,9 @@ func (c *Charge) New(model string) *Charge {
 		Input:     c.Input,
 		Output:    c.Output,
 		Anonymous: c.Anonymous,
+
+		CacheRead:     c.CacheRead,
+		CacheWrite:    c.CacheWrite,
+		BatchDiscount: c.BatchDiscount,
 	}
 }
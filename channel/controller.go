@@ -7,6 +7,14 @@ import (
 	"net/http"
 )
 
+type TestChannelForm struct {
+	Model string `json:"model"`
+}
+
+type ChannelSecretForm struct {
+	Index int `json:"index"`
+}
+
 type SyncChargeForm struct {
 	Overwrite bool           `json:"overwrite"`
 	Data      ChargeSequence `json:"data"`
@@ -55,20 +63,116 @@ func DeactivateChannel(c *gin.Context) {
 func GetChannelList(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status": true,
-		"data":   ConduitInstance.Sequence,
+		"data":   utils.Each(ConduitInstance.Sequence, getChannelState),
 	})
 }
 
 func GetChannel(c *gin.Context) {
 	id := c.Param("id")
 	channel := ConduitInstance.Sequence.GetChannelById(utils.ParseInt(id))
+	if channel == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status": false,
+			"data":   nil,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": true,
+		"data":   getChannelState(channel),
+	})
+}
+
+func TestChannel(c *gin.Context) {
+	var form TestChannelForm
+	if err := c.ShouldBindJSON(&form); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	id := c.Param("id")
+	channel := ConduitInstance.Sequence.GetChannelById(utils.ParseInt(id))
+	if channel == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status": false,
+			"error":  "channel not found",
+		})
+		return
+	}
+
+	model, err := GetProbeModel(channel, form.Model)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	result := ProbeChannel(c.Request.Context(), channel, model)
+	c.JSON(http.StatusOK, gin.H{
+		"status": result.Success,
+		"error":  result.Error,
+		"data":   result,
+	})
+}
+
+func GetChannelProbe(c *gin.Context) {
+	id := c.Param("id")
+	c.JSON(http.StatusOK, gin.H{
+		"status": true,
+		"data":   ProbeInstance.Get(utils.ParseInt(id)),
+	})
+}
+
+func EnableChannelSecret(c *gin.Context) {
+	var form ChannelSecretForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	id := c.Param("id")
+	state := ConduitInstance.EnableChannelSecret(utils.ParseInt(id), form.Index)
+	c.JSON(http.StatusOK, gin.H{
+		"status": state == nil,
+		"error":  utils.GetError(state),
+	})
+}
+
+func DeleteChannelSecret(c *gin.Context) {
+	var form ChannelSecretForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
 
+	id := c.Param("id")
+	state := ConduitInstance.DeleteChannelSecret(utils.ParseInt(id), form.Index)
 	c.JSON(http.StatusOK, gin.H{
-		"status": channel != nil,
-		"data":   channel,
+		"status": state == nil,
+		"error":  utils.GetError(state),
 	})
 }
 
+func getChannelState(channel *Channel) ChannelState {
+	return ChannelState{
+		Channel: channel,
+		Health:  BreakerInstance.GetState(channel.GetId()),
+		Secrets: SecretInstance.GetStates(channel),
+	}
+}
+
 func CreateChannel(c *gin.Context) {
 	var channel Channel
 	if err := c.ShouldBindJSON(&channel); err != nil {
@@ -200,3 +304,24 @@ func UpdatePlanConfig(c *gin.Context) {
 		"error":  utils.GetError(state),
 	})
 }
+
+func GetRoutingConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, RoutingInstance.GetConfig())
+}
+
+func UpdateRoutingConfig(c *gin.Context) {
+	var config RoutingConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	state := RoutingInstance.UpdateConfig(&config)
+	c.JSON(http.StatusOK, gin.H{
+		"status": state == nil,
+		"error":  utils.GetError(state),
+	})
+}
@@ -0,0 +1,203 @@
+package channel
+
+import (
+	"chat/connection"
+	"chat/globals"
+	"chat/utils"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	limitPollInterval = 200 * time.Millisecond // interval to check the saturated channel while queueing
+	limitWindowExpire = 2 * time.Minute        // expiration of the rpm and tpm counters of the minute window
+	limitConcurrency  = 10 * time.Minute       // expiration of the single concurrency slot (e.g. leaked by the crashed instance)
+)
+
+func (l ChannelLimit) IsEmpty() bool {
+	return l.RPM <= 0 && l.TPM <= 0 && l.Concurrency <= 0
+}
+
+func getRPMKey(id int) string {
+	return fmt.Sprintf("nio:channel-rpm:%d:%d", id, time.Now().Unix()/60)
+}
+
+func getTPMKey(id int) string {
+	return fmt.Sprintf("nio:channel-tpm:%d:%d", id, time.Now().Unix()/60)
+}
+
+func getConcurrencyKey(id int) string {
+	return fmt.Sprintf("nio:channel-concurrency:%d", id)
+}
+
+// getLimitRetryAfter returns the seconds until the next minute window
+func getLimitRetryAfter() int {
+	return int(60 - time.Now().Unix()%60)
+}
+
+func addTokens(cache *redis.Client, id int, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	key := getTPMKey(id)
+	if _, err := utils.Incr(cache, key, int64(tokens)); err == nil {
+		cache.Expire(context.Background(), key, limitWindowExpire)
+	}
+}
+
+// getConcurrencyMin returns the score before which the concurrency slots are expired
+func getConcurrencyMin() string {
+	return strconv.FormatInt(time.Now().Add(-limitConcurrency).UnixMilli(), 10)
+}
+
+// IsChannelSaturated returns whether the channel reaches the rpm, tpm or concurrency limit,
+// the limits are not applied if the redis is not available
+func IsChannelSaturated(channel *Channel) bool {
+	limit := channel.GetLimit()
+	cache := connection.Cache
+	if limit.IsEmpty() || cache == nil {
+		return false
+	}
+
+	id := channel.GetId()
+	ctx := context.Background()
+
+	pipe := cache.Pipeline()
+	counters := pipe.MGet(ctx, getRPMKey(id), getTPMKey(id))
+	slots := pipe.ZCount(ctx, getConcurrencyKey(id), "("+getConcurrencyMin(), "+inf")
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false
+	}
+
+	values := counters.Val()
+	getCounter := func(idx int) int64 {
+		if idx >= len(values) || values[idx] == nil {
+			return 0
+		}
+		return utils.ParseInt64(fmt.Sprint(values[idx]))
+	}
+
+	return (limit.RPM > 0 && getCounter(0) >= int64(limit.RPM)) ||
+		(limit.TPM > 0 && getCounter(1) >= int64(limit.TPM)) ||
+		(limit.Concurrency > 0 && slots.Val() >= int64(limit.Concurrency))
+}
+
+// takeConcurrencySlot adds the slot to the concurrency set of the channel,
+// each slot expires individually so that the slot leaked by the crashed instance is dropped without affecting the others
+func takeConcurrencySlot(cache *redis.Client, id int, slot string, limit int) (bool, error) {
+	ctx := context.Background()
+	key := getConcurrencyKey(id)
+
+	pipe := cache.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", getConcurrencyMin())
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(time.Now().UnixMilli()), Member: slot})
+	count := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, limitConcurrency)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+
+	if count.Val() > int64(limit) {
+		releaseConcurrencySlot(cache, id, slot)
+		return false, nil
+	}
+	return true, nil
+}
+
+func releaseConcurrencySlot(cache *redis.Client, id int, slot string) {
+	cache.ZRem(context.Background(), getConcurrencyKey(id), slot)
+}
+
+// tryAcquireChannel takes the request slot of the channel, the counters are failed open if the redis is not available.
+// slot is the taken concurrency slot which needs to be released, empty if the concurrency is not limited
+func tryAcquireChannel(cache *redis.Client, channel *Channel, tokens int) (acquired bool, slot string) {
+	limit := channel.GetLimit()
+	id := channel.GetId()
+
+	if limit.Concurrency > 0 {
+		slot = utils.GenerateChar(16)
+		if ok, err := takeConcurrencySlot(cache, id, slot, limit.Concurrency); err != nil {
+			slot = ""
+		} else if !ok {
+			return false, ""
+		}
+	}
+
+	release := func() {
+		if slot != "" {
+			releaseConcurrencySlot(cache, id, slot)
+		}
+	}
+
+	if limit.TPM > 0 && utils.MustInt(cache, getTPMKey(id)) >= int64(limit.TPM) {
+		release()
+		return false, ""
+	}
+
+	if limit.RPM > 0 {
+		key := getRPMKey(id)
+		if value, err := utils.Incr(cache, key, 1); err == nil {
+			cache.Expire(context.Background(), key, limitWindowExpire)
+			if value > int64(limit.RPM) {
+				utils.DecrInt(cache, key, 1)
+				release()
+				return false, ""
+			}
+		}
+	}
+
+	if limit.TPM > 0 {
+		addTokens(cache, id, tokens)
+	}
+
+	return true, slot
+}
+
+// AcquireChannel takes the request slot of the channel with the input tokens of the buffer,
+// the request is queued for `limit.queue` seconds if the channel is saturated.
+// the returned release function must be called after the request is finished to count the output tokens
+func AcquireChannel(ctx context.Context, channel *Channel, buffer *utils.Buffer) (func(), error) {
+	limit := channel.GetLimit()
+	cache := connection.Cache
+	if limit.IsEmpty() || cache == nil {
+		return func() {}, nil
+	}
+
+	tokens := 0
+	if buffer != nil {
+		tokens = buffer.CountInputToken()
+	}
+
+	deadline := time.Now().Add(time.Duration(limit.Queue) * time.Second)
+	for {
+		if acquired, slot := tryAcquireChannel(cache, channel, tokens); acquired {
+			return func() {
+				if slot != "" {
+					releaseConcurrencySlot(cache, channel.GetId(), slot)
+				}
+
+				if limit.TPM > 0 && buffer != nil {
+					addTokens(cache, channel.GetId(), buffer.CountOutputToken(false))
+				}
+			}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, globals.NewRateLimitError(
+				getLimitRetryAfter(), "channel #%d is saturated (rpm: %d, tpm: %d, concurrency: %d)",
+				channel.GetId(), limit.RPM, limit.TPM, limit.Concurrency,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(limitPollInterval):
+		}
+	}
+}
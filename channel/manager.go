@@ -5,6 +5,7 @@ import (
 	"chat/utils"
 	"errors"
 	"github.com/spf13/viper"
+	"strings"
 	"time"
 )
 
@@ -12,12 +13,14 @@ var ConduitInstance *Manager
 var ChargeInstance *ChargeManager
 var SystemInstance *SystemConfig
 var PlanInstance *PlanManager
+var RoutingInstance *RoutingManager
 
 func InitManager() {
 	ConduitInstance = NewChannelManager()
 	ChargeInstance = NewChargeManager()
 	SystemInstance = NewSystemConfig()
 	PlanInstance = NewPlanManager()
+	RoutingInstance = NewRoutingManager()
 }
 
 func NewChannelManager() *Manager {
@@ -123,7 +126,7 @@ func (m *Manager) GetTicker(model, group string) *Ticker {
 		return nil
 	}
 
-	return NewTicker(m.HitSequence(model), group)
+	return NewTicker(m.HitSequence(model), model, group)
 }
 
 func (m *Manager) Len() int {
@@ -156,6 +159,7 @@ func (m *Manager) UpdateChannel(id int, channel *Channel) error {
 	for i, item := range m.Sequence {
 		if item.Id == id {
 			m.Sequence[i] = channel
+			BreakerInstance.Reset(id)
 			return m.SaveConfig()
 		}
 	}
@@ -166,6 +170,9 @@ func (m *Manager) DeleteChannel(id int) error {
 	for i, item := range m.Sequence {
 		if item.Id == id {
 			m.Sequence = append(m.Sequence[:i], m.Sequence[i+1:]...)
+			BreakerInstance.Reset(id)
+			SecretInstance.Reset(id)
+			ProbeInstance.Reset(id)
 			return m.SaveConfig()
 		}
 	}
@@ -176,6 +183,7 @@ func (m *Manager) ActivateChannel(id int) error {
 	for i, item := range m.Sequence {
 		if item.Id == id {
 			m.Sequence[i].State = true
+			BreakerInstance.Reset(id)
 			return m.SaveConfig()
 		}
 	}
@@ -191,3 +199,38 @@ func (m *Manager) DeactivateChannel(id int) error {
 	}
 	return errors.New("channel not found")
 }
+
+// EnableChannelSecret re-enables the disabled secret of the channel by the index of the secret list
+func (m *Manager) EnableChannelSecret(id int, index int) error {
+	channel := m.Sequence.GetChannelById(id)
+	if channel == nil {
+		return errors.New("channel not found")
+	}
+
+	secrets := channel.GetSecrets()
+	if index < 0 || index >= len(secrets) {
+		return errors.New("secret not found")
+	}
+
+	SecretInstance.Enable(id, secrets[index])
+	return nil
+}
+
+// DeleteChannelSecret removes the secret from the secret list of the channel by the index
+func (m *Manager) DeleteChannelSecret(id int, index int) error {
+	channel := m.Sequence.GetChannelById(id)
+	if channel == nil {
+		return errors.New("channel not found")
+	}
+
+	secrets := channel.GetSecrets()
+	if index < 0 || index >= len(secrets) {
+		return errors.New("secret not found")
+	} else if len(secrets) == 1 {
+		return errors.New("cannot delete the last secret of the channel")
+	}
+
+	SecretInstance.Remove(id, secrets[index])
+	channel.Secret = strings.Join(append(secrets[:index], secrets[index+1:]...), "\n")
+	return m.SaveConfig()
+}
@@ -0,0 +1,210 @@
+package channel
+
+import (
+	"chat/adapter"
+	adaptercommon "chat/adapter/common"
+	"chat/globals"
+	"chat/utils"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	probePrompt      = "hi"
+	probeMaxTokens   = 16
+	probeTimeout     = 60 * time.Second
+	probeHistorySize = 60 // the latest probe results kept for each channel model
+)
+
+// ProbeResult is the result of the minimal chat request sent to the channel
+type ProbeResult struct {
+	Model      string `json:"model"`
+	Success    bool   `json:"success"`
+	Latency    int64  `json:"latency"`     // total duration of the request (ms)
+	FirstToken int64  `json:"first_token"` // duration until the first chunk is received (ms), 0 if no chunk is received
+	Error      string `json:"error,omitempty"`
+	Time       int64  `json:"time"`
+}
+
+type ProbeHistory struct {
+	mutex   sync.RWMutex
+	results map[int]map[string][]ProbeResult
+}
+
+var ProbeInstance = NewProbeHistory()
+
+func NewProbeHistory() *ProbeHistory {
+	return &ProbeHistory{
+		results: map[int]map[string][]ProbeResult{},
+	}
+}
+
+// Add appends the probe result of the channel model, the oldest results are dropped beyond the history size
+func (h *ProbeHistory) Add(id int, result ProbeResult) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	models, ok := h.results[id]
+	if !ok {
+		models = map[string][]ProbeResult{}
+		h.results[id] = models
+	}
+
+	history := append(models[result.Model], result)
+	if len(history) > probeHistorySize {
+		history = history[len(history)-probeHistorySize:]
+	}
+	models[result.Model] = history
+}
+
+// Get returns the probe history of the channel grouped by the models
+func (h *ProbeHistory) Get(id int) map[string][]ProbeResult {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	data := map[string][]ProbeResult{}
+	for model, history := range h.results[id] {
+		data[model] = append([]ProbeResult{}, history...)
+	}
+	return data
+}
+
+// Reset clears the probe history of the channel (e.g. the channel is deleted)
+func (h *ProbeHistory) Reset(id int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.results, id)
+}
+
+// probeChannel disables the retries of the channel to measure the single request
+type probeChannel struct {
+	*ChannelRequest
+}
+
+func (c probeChannel) GetRetry() int {
+	return 1
+}
+
+// GetProbeModel returns the model to probe the channel, the first model of the channel is used if not specified
+func GetProbeModel(channel *Channel, model string) (string, error) {
+	models := channel.GetHitModels()
+	if model == "" {
+		if len(models) == 0 {
+			return "", fmt.Errorf("channel %s (#%d) has no models", channel.GetName(), channel.GetId())
+		}
+		return models[0], nil
+	}
+
+	if !channel.IsHit(model) {
+		return "", fmt.Errorf("model %s is not supported by channel %s (#%d)", model, channel.GetName(), channel.GetId())
+	}
+	return model, nil
+}
+
+// ProbeChannel sends the minimal prompt to the channel and measures the latency and the first token time,
+// the result is recorded to the breaker, the secret health and the probe history of the channel
+func ProbeChannel(ctx context.Context, channel *Channel, model string) ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	messages := []globals.Message{
+		{Role: globals.User, Content: probePrompt},
+	}
+	buffer := utils.NewBuffer(model, messages, ChargeInstance.GetCharge(model))
+	props := adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
+		OriginalModel: model,
+		Message:       messages,
+		MaxTokens:     utils.ToPtr(probeMaxTokens),
+	}, buffer)
+	props.MaxRetries = utils.ToPtr(1)
+
+	start := time.Now()
+	var firstToken time.Duration
+
+	conf := NewChannelRequest(channel)
+	err := adapter.NewChatRequest(ctx, probeChannel{conf}, props, func(data *globals.Chunk) error {
+		if firstToken == 0 {
+			firstToken = time.Since(start)
+		}
+		buffer.WriteChunk(data)
+		return nil
+	})
+
+	result := ProbeResult{
+		Model:      model,
+		Success:    err == nil,
+		Latency:    time.Since(start).Milliseconds(),
+		FirstToken: firstToken.Milliseconds(),
+		Time:       start.Unix(),
+	}
+	if err != nil {
+		result.Error = strings.TrimSpace(err.Error())
+	}
+
+	BreakerInstance.RecordProbe(channel, err)
+	SecretInstance.Record(channel, conf.GetUsedSecret(), err)
+	ProbeInstance.Add(channel.GetId(), result)
+
+	return result
+}
+
+// StartProbeWorker probes the active channels periodically if `probe.interval` (seconds) is set,
+// the models to probe are set by `probe.models`, the first model of the channel is probed if not set
+func StartProbeWorker() {
+	interval := viper.GetInt("probe.interval")
+	if interval <= 0 {
+		return
+	}
+
+	globals.Info(fmt.Sprintf("[probe] channel probe worker started (interval: %ds)", interval))
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			probeActiveChannels(viper.GetStringSlice("probe.models"))
+		}
+	}()
+}
+
+func probeActiveChannels(models []string) {
+	defer func() {
+		if err := recover(); err != nil {
+			globals.Warn(fmt.Sprintf("caught panic from channel probe worker: %s\n%s", err, debug.Stack()))
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, channel := range ConduitInstance.GetActiveSequence() {
+		targets := utils.Filter(channel.GetHitModels(), func(model string) bool {
+			return utils.Contains(model, models)
+		})
+		if len(models) == 0 {
+			if model, err := GetProbeModel(channel, ""); err == nil {
+				targets = []string{model}
+			}
+		}
+
+		for _, model := range targets {
+			wg.Add(1)
+			go func(channel *Channel, model string) {
+				defer wg.Done()
+
+				result := ProbeChannel(context.Background(), channel, model)
+				if !result.Success {
+					globals.Warn(fmt.Sprintf("[probe] channel %s (#%d) failed to probe model %s: %s", channel.GetName(), channel.GetId(), model, result.Error))
+				}
+			}(channel, model)
+		}
+	}
+
+	wg.Wait()
+}
@@ -13,6 +13,10 @@ func Register(app *gin.RouterGroup) {
 	app.GET("/admin/channel/delete/:id", DeleteChannel)
 	app.GET("/admin/channel/activate/:id", ActivateChannel)
 	app.GET("/admin/channel/deactivate/:id", DeactivateChannel)
+	app.POST("/admin/channel/test/:id", TestChannel)
+	app.GET("/admin/channel/probe/:id", GetChannelProbe)
+	app.POST("/admin/channel/secret/enable/:id", EnableChannelSecret)
+	app.POST("/admin/channel/secret/delete/:id", DeleteChannelSecret)
 
 	app.GET("/admin/charge/list", GetChargeList)
 	app.POST("/admin/charge/set", SetCharge)
@@ -24,4 +28,7 @@ func Register(app *gin.RouterGroup) {
 
 	app.GET("/admin/plan/view", GetPlanConfig)
 	app.POST("/admin/plan/update", UpdatePlanConfig)
+
+	app.GET("/admin/routing/view", GetRoutingConfig)
+	app.POST("/admin/routing/update", UpdateRoutingConfig)
 }
@@ -0,0 +1,211 @@
+package channel
+
+import (
+	"chat/utils"
+	"fmt"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	RoutingWeighted      = "weighted"       // weighted random (default)
+	RoutingLatency       = "latency"        // lowest p50 latency of the model
+	RoutingLeastInflight = "least_inflight" // least in-flight requests
+	RoutingRoundRobin    = "round_robin"
+)
+
+var routingStrategies = []string{
+	RoutingWeighted,
+	RoutingLatency,
+	RoutingLeastInflight,
+	RoutingRoundRobin,
+}
+
+// RoutingRule sets the strategy to pick the channel among the channels of the same priority
+type RoutingRule struct {
+	Models   []string `json:"models" mapstructure:"models"` // empty for all the models
+	Groups   []string `json:"groups" mapstructure:"groups"` // user groups, empty for all the groups
+	Strategy string   `json:"strategy" mapstructure:"strategy"`
+}
+
+// RoutingConfig is the routing config stored in the `routing` key of the config file
+type RoutingConfig struct {
+	Strategy string        `json:"strategy" mapstructure:"strategy"` // default strategy if no rule is matched
+	Shared   bool          `json:"shared" mapstructure:"shared"`     // share the live stats across the instances with redis
+	Rules    []RoutingRule `json:"rules" mapstructure:"rules"`
+}
+
+// RoutingManager guards the routing config which is read by the tickers and updated by the admin api
+type RoutingManager struct {
+	mutex  sync.RWMutex
+	config RoutingConfig
+}
+
+func NewRoutingManager() *RoutingManager {
+	manager := &RoutingManager{}
+	if err := viper.UnmarshalKey("routing", &manager.config); err != nil {
+		panic(err)
+	}
+
+	return manager
+}
+
+func (m *RoutingManager) SaveConfig() error {
+	m.mutex.RLock()
+	viper.Set("routing", m.getConfig())
+	m.mutex.RUnlock()
+
+	return viper.WriteConfig()
+}
+
+// getConfig returns the copy of the routing config, the caller should hold the lock
+func (m *RoutingManager) getConfig() RoutingConfig {
+	return RoutingConfig{
+		Strategy: m.config.Strategy,
+		Shared:   m.config.Shared,
+		Rules:    append([]RoutingRule{}, m.config.Rules...),
+	}
+}
+
+// GetConfig returns the copy of the routing config
+func (m *RoutingManager) GetConfig() RoutingConfig {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.getConfig()
+}
+
+// IsShared returns whether the live stats are shared across the instances
+func (m *RoutingManager) IsShared() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.config.Shared
+}
+
+func (m *RoutingManager) UpdateConfig(data *RoutingConfig) error {
+	if data.Strategy != "" && !utils.Contains(data.Strategy, routingStrategies) {
+		return fmt.Errorf("unknown routing strategy %s", data.Strategy)
+	}
+
+	for _, rule := range data.Rules {
+		if !utils.Contains(rule.Strategy, routingStrategies) {
+			return fmt.Errorf("unknown routing strategy %s", rule.Strategy)
+		}
+	}
+
+	m.mutex.Lock()
+	m.config = RoutingConfig{
+		Strategy: data.Strategy,
+		Shared:   data.Shared,
+		Rules:    append([]RoutingRule{}, data.Rules...),
+	}
+	m.mutex.Unlock()
+
+	return m.SaveConfig()
+}
+
+func (r RoutingRule) IsHit(model, group string) bool {
+	return (len(r.Models) == 0 || utils.Contains(model, r.Models)) &&
+		(len(r.Groups) == 0 || utils.Contains(group, r.Groups))
+}
+
+// GetStrategy returns the strategy of the first matched rule of the model and the user group
+func (m *RoutingManager) GetStrategy(model, group string) string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, rule := range m.config.Rules {
+		if rule.IsHit(model, group) {
+			return rule.Strategy
+		}
+	}
+
+	if m.config.Strategy == "" {
+		return RoutingWeighted
+	}
+	return m.config.Strategy
+}
+
+// pickWeighted returns the weighted random channel of the stack
+func pickWeighted(stack Sequence) *Channel {
+	if len(stack) == 1 {
+		return stack[0]
+	}
+
+	weight := utils.Each(stack, func(channel *Channel) int {
+		return channel.GetWeight()
+	})
+	total := utils.Sum(weight)
+
+	// get random number
+	cursor := utils.Intn(total)
+
+	// get channel by weight
+	for _, channel := range stack {
+		cursor -= channel.GetWeight()
+		if cursor < 0 {
+			return channel
+		}
+	}
+
+	return stack[0]
+}
+
+// pickLowest returns the weighted random channel among the channels with the lowest score
+func pickLowest(stack Sequence, score func(channel *Channel) int64) *Channel {
+	var lowest Sequence
+	var lowestScore int64
+
+	for _, channel := range stack {
+		value := score(channel)
+		if len(lowest) == 0 || value < lowestScore {
+			lowest = Sequence{channel}
+			lowestScore = value
+		} else if value == lowestScore {
+			lowest = append(lowest, channel)
+		}
+	}
+
+	return pickWeighted(lowest)
+}
+
+// pickLatency returns the channel with the lowest p50 latency of the model,
+// the channels without latency samples are scored by the median latency of the others (neutral)
+func pickLatency(stack Sequence, model string) *Channel {
+	latency := map[int]int64{}
+	var samples []int64
+	for _, channel := range stack {
+		value := StatsInstance.GetLatency(channel.GetId(), model)
+		latency[channel.GetId()] = value
+		if value >= 0 {
+			samples = append(samples, value)
+		}
+	}
+
+	neutral := max(getMedian(samples), 0)
+	return pickLowest(stack, func(channel *Channel) int64 {
+		if value := latency[channel.GetId()]; value >= 0 {
+			return value
+		}
+		return neutral
+	})
+}
+
+// pickChannel returns the channel of the stack by the routing strategy
+func pickChannel(stack Sequence, strategy, model, group string, priority int) *Channel {
+	switch strategy {
+	case RoutingLatency:
+		return pickLatency(stack, model)
+	case RoutingLeastInflight:
+		return pickLowest(stack, func(channel *Channel) int64 {
+			return StatsInstance.GetInflight(channel.GetId())
+		})
+	case RoutingRoundRobin:
+		key := fmt.Sprintf("%s:%s:%d", model, group, priority)
+		return stack[StatsInstance.NextRound(key)%int64(len(stack))]
+	default:
+		return pickWeighted(stack)
+	}
+}
@@ -0,0 +1,213 @@
+package channel
+
+import (
+	"chat/adapter"
+	"chat/globals"
+	"chat/utils"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SecretReasonAuth    = "auth"    // the secret is invalid or revoked
+	SecretReasonBalance = "balance" // the quota of the secret is exhausted
+)
+
+var secretDisableDuration = 30 * time.Minute // the disabled secret is retried after the duration
+
+var secretAuthErrors = []string{
+	"status code: 401", "status code: 403",
+	"invalid_api_key", "invalid api key", "incorrect api key",
+	"invalid x-api-key", "api key not valid", "authentication_error",
+	"unauthorized", "permission_denied",
+}
+
+var secretBalanceErrors = []string{
+	"status code: 402",
+	"insufficient_quota", "insufficient quota",
+	"insufficient_balance", "insufficient balance", "insufficient_user_quota",
+	"exceeded your current quota", "credit balance is too low", "arrearage",
+}
+
+// SecretState is the health state of the single secret of the multi-secret channel
+type SecretState struct {
+	Index      int    `json:"index"`
+	Secret     string `json:"secret"` // the secret is hidden
+	Enabled    bool   `json:"enabled"`
+	Success    int64  `json:"success"`
+	Failure    int64  `json:"failure"`
+	LastError  string `json:"last_error,omitempty"`
+	Reason     string `json:"reason,omitempty"` // reason of the disabled secret (auth or balance)
+	DisabledAt int64  `json:"disabled_at,omitempty"`
+	RetryAt    int64  `json:"retry_at,omitempty"`
+}
+
+type SecretHealth struct {
+	success    int64
+	failure    int64
+	lastError  string
+	reason     string
+	disabledAt time.Time
+}
+
+type SecretManager struct {
+	mutex   sync.RWMutex
+	secrets map[int]map[string]*SecretHealth
+}
+
+var SecretInstance = NewSecretManager()
+
+func NewSecretManager() *SecretManager {
+	return &SecretManager{
+		secrets: map[int]map[string]*SecretHealth{},
+	}
+}
+
+// getSecretErrorReason returns the reason to disable the secret, empty if the error is not caused by the secret
+func getSecretErrorReason(err error) string {
+	content := strings.ToLower(err.Error())
+
+	for _, item := range secretBalanceErrors {
+		if strings.Contains(content, item) {
+			return SecretReasonBalance
+		}
+	}
+
+	for _, item := range secretAuthErrors {
+		if strings.Contains(content, item) {
+			return SecretReasonAuth
+		}
+	}
+
+	return ""
+}
+
+func (h *SecretHealth) isDisabled() bool {
+	return h.reason != "" && time.Since(h.disabledAt) < secretDisableDuration
+}
+
+// get returns the health of the secret, the health is created if not exists
+func (m *SecretManager) get(id int, secret string) *SecretHealth {
+	secrets, ok := m.secrets[id]
+	if !ok {
+		secrets = map[string]*SecretHealth{}
+		m.secrets[id] = secrets
+	}
+
+	health, ok := secrets[secret]
+	if !ok {
+		health = &SecretHealth{}
+		secrets[secret] = health
+	}
+	return health
+}
+
+// Record records the result of the secret used by the channel request,
+// the secret is disabled temporarily if the upstream returns the auth or insufficient balance error
+func (m *SecretManager) Record(channel *Channel, secret string, err error) {
+	if secret == "" || (adapter.IsSkipError(err) && err != nil) {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	health := m.get(channel.GetId(), secret)
+	if err == nil {
+		health.success++
+		return
+	}
+
+	health.failure++
+	health.lastError = strings.TrimSpace(err.Error())
+
+	if reason := getSecretErrorReason(err); reason != "" && !health.isDisabled() {
+		health.reason = reason
+		health.disabledAt = time.Now()
+
+		globals.Warn(fmt.Sprintf("[secret] secret %s of channel %s (#%d) is disabled for %s (reason: %s, error: %s)",
+			utils.HideSecret(secret, 8), channel.GetName(), channel.GetId(), secretDisableDuration, reason, health.lastError))
+	}
+}
+
+// IsEnabled returns whether the secret can be used by the channel requests
+func (m *SecretManager) IsEnabled(id int, secret string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if health, ok := m.secrets[id][secret]; ok {
+		return !health.isDisabled()
+	}
+	return true
+}
+
+// IsAvailable returns whether the channel has any enabled secret
+func (m *SecretManager) IsAvailable(channel *Channel) bool {
+	for _, secret := range channel.GetSecrets() {
+		if m.IsEnabled(channel.GetId(), secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enable re-enables the disabled secret of the channel
+func (m *SecretManager) Enable(id int, secret string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	health := m.get(id, secret)
+	health.reason = ""
+	health.disabledAt = time.Time{}
+}
+
+// Remove clears the health of the secret (e.g. the secret is deleted from the channel)
+func (m *SecretManager) Remove(id int, secret string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.secrets[id], secret)
+}
+
+// Reset clears the health of all the secrets of the channel (e.g. the channel is deleted)
+func (m *SecretManager) Reset(id int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.secrets, id)
+}
+
+// GetStates returns the health states of the secrets of the channel in the order of the secret list
+func (m *SecretManager) GetStates(channel *Channel) []SecretState {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	secrets := channel.GetSecrets()
+	states := make([]SecretState, 0, len(secrets))
+	for idx, secret := range secrets {
+		state := SecretState{
+			Index:   idx,
+			Secret:  utils.HideSecret(secret, 8),
+			Enabled: true,
+		}
+
+		if health, ok := m.secrets[channel.GetId()][secret]; ok {
+			state.Success = health.success
+			state.Failure = health.failure
+			state.LastError = health.lastError
+
+			if health.isDisabled() {
+				state.Enabled = false
+				state.Reason = health.reason
+				state.DisabledAt = health.disabledAt.Unix()
+				state.RetryAt = health.disabledAt.Add(secretDisableDuration).Unix()
+			}
+		}
+
+		states = append(states, state)
+	}
+
+	return states
+}
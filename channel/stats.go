@@ -0,0 +1,184 @@
+package channel
+
+import (
+	"chat/adapter"
+	"chat/connection"
+	"chat/utils"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	statsLatencySize = 100              // the latest latency samples kept for each channel model
+	statsExpiration  = 10 * time.Minute // expiration of the shared stats (e.g. leaked in-flight counters of the crashed instance)
+	statsFailure     = 60 * time.Second // latency sample recorded for the failed request, so that the failing channel is not ranked first
+)
+
+// ChannelStats collects the live stats of the channels for the routing strategies,
+// the stats are shared across the instances with redis if the routing is shared
+type ChannelStats struct {
+	mutex    sync.Mutex
+	inflight map[int]int64
+	latency  map[string][]int64 // latency samples (ms) by `channel id:model`
+	cursor   map[string]int     // ring buffer cursor of the latency samples
+	round    map[string]int64   // round-robin counters
+}
+
+var StatsInstance = NewChannelStats()
+
+func NewChannelStats() *ChannelStats {
+	return &ChannelStats{
+		inflight: map[int]int64{},
+		latency:  map[string][]int64{},
+		cursor:   map[string]int{},
+		round:    map[string]int64{},
+	}
+}
+
+func getStatsCache() *redis.Client {
+	if RoutingInstance == nil || !RoutingInstance.IsShared() {
+		return nil
+	}
+	return connection.Cache
+}
+
+func getLatencyKey(id int, model string) string {
+	return fmt.Sprintf("%d:%s", id, model)
+}
+
+// Begin increases the in-flight requests of the channel
+func (s *ChannelStats) Begin(channel *Channel) {
+	if cache := getStatsCache(); cache != nil {
+		key := fmt.Sprintf("nio:channel-inflight:%d", channel.GetId())
+		if _, err := utils.Incr(cache, key, 1); err == nil {
+			cache.Expire(context.Background(), key, statsExpiration)
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.inflight[channel.GetId()]++
+}
+
+// End decreases the in-flight requests of the channel and records the latency of the request,
+// the failed request is recorded with the penalty latency (the request aborted by the client is not recorded)
+func (s *ChannelStats) End(channel *Channel, model string, latency time.Duration, err error) {
+	record := err == nil || !adapter.IsSkipError(err)
+	if err != nil {
+		latency = max(latency, statsFailure)
+	}
+
+	if cache := getStatsCache(); cache != nil {
+		key := fmt.Sprintf("nio:channel-inflight:%d", channel.GetId())
+		if utils.DecrInt(cache, key, 1) {
+			if record {
+				s.addSharedLatency(cache, channel.GetId(), model, latency)
+			}
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.inflight[channel.GetId()] > 0 {
+		s.inflight[channel.GetId()]--
+	}
+
+	if record {
+		s.addLatency(channel.GetId(), model, latency)
+	}
+}
+
+func (s *ChannelStats) addLatency(id int, model string, latency time.Duration) {
+	key := getLatencyKey(id, model)
+	samples := s.latency[key]
+	if len(samples) < statsLatencySize {
+		s.latency[key] = append(samples, latency.Milliseconds())
+		return
+	}
+
+	samples[s.cursor[key]] = latency.Milliseconds()
+	s.cursor[key] = (s.cursor[key] + 1) % statsLatencySize
+}
+
+func (s *ChannelStats) addSharedLatency(cache *redis.Client, id int, model string, latency time.Duration) {
+	key := fmt.Sprintf("nio:channel-latency:%s", getLatencyKey(id, model))
+
+	pipe := cache.TxPipeline()
+	pipe.LPush(context.Background(), key, latency.Milliseconds())
+	pipe.LTrim(context.Background(), key, 0, int64(statsLatencySize-1))
+	pipe.Expire(context.Background(), key, statsExpiration)
+	_, _ = pipe.Exec(context.Background())
+}
+
+// GetInflight returns the in-flight requests of the channel
+func (s *ChannelStats) GetInflight(id int) int64 {
+	if cache := getStatsCache(); cache != nil {
+		if value, err := utils.GetInt(cache, fmt.Sprintf("nio:channel-inflight:%d", id)); err == nil || err == redis.Nil {
+			// the counter may be negative if it is expired during the request
+			return max(value, 0)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.inflight[id]
+}
+
+// GetLatency returns the p50 latency (ms) of the channel model, -1 if there is no sample
+func (s *ChannelStats) GetLatency(id int, model string) int64 {
+	if cache := getStatsCache(); cache != nil {
+		key := fmt.Sprintf("nio:channel-latency:%s", getLatencyKey(id, model))
+		if values, err := cache.LRange(context.Background(), key, 0, -1).Result(); err == nil {
+			samples := make([]int64, 0, len(values))
+			for _, value := range values {
+				if sample, err := strconv.ParseInt(value, 10, 64); err == nil {
+					samples = append(samples, sample)
+				}
+			}
+			return getMedian(samples)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return getMedian(append([]int64{}, s.latency[getLatencyKey(id, model)]...))
+}
+
+// NextRound returns the round-robin counter of the key
+func (s *ChannelStats) NextRound(key string) int64 {
+	if cache := getStatsCache(); cache != nil {
+		if value, err := utils.Incr(cache, fmt.Sprintf("nio:channel-round:%s", key), 1); err == nil {
+			return value
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.round[key]++
+	return s.round[key]
+}
+
+// getMedian sorts the samples in place and returns the median, -1 if there is no sample
+func getMedian(samples []int64) int64 {
+	if len(samples) == 0 {
+		return -1
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return samples[len(samples)/2]
+}
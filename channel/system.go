@@ -84,6 +84,13 @@ type commonState struct {
 	PromptStore bool     `json:"prompt_store" mapstructure:"promptstore"`
 }
 
+type moderationState struct {
+	Enabled  bool     `json:"enabled" mapstructure:"enabled"`
+	Model    string   `json:"model" mapstructure:"model"` // moderation model routed through the channels, empty to use the keywords only
+	Keywords []string `json:"keywords" mapstructure:"keywords"`
+	Groups   []string `json:"groups" mapstructure:"groups"` // user groups to moderate, empty for all the groups
+}
+
 // visionState 和 oauthState 已迁移到独立配置文件
 // 参见 utils/vision_config.go 和 utils/oauth_config.go
 
@@ -93,6 +100,8 @@ type SystemConfig struct {
 	Mail    mailState    `json:"mail" mapstructure:"mail"`
 	Search  SearchState  `json:"search" mapstructure:"search"`
 	Common  commonState  `json:"common" mapstructure:"common"`
+
+	Moderation moderationState `json:"moderation" mapstructure:"moderation"`
 	// Vision 和 OAuth 已迁移到独立配置，不再包含在此结构体中
 }
 
@@ -182,6 +191,7 @@ func (c *SystemConfig) UpdateConfig(data *SystemConfig) error {
 	c.Mail = data.Mail
 	c.Search = data.Search
 	c.Common = data.Common
+	c.Moderation = data.Moderation
 	// Vision 和 OAuth 不再在此处更新，使用独立的更新函数
 
 	utils.ApplySeo(c.General.Title, c.General.Logo)
@@ -333,3 +343,23 @@ func (c *SystemConfig) SupportRelayPlan() bool {
 func (c *SystemConfig) GetVisionModels() []string {
 	return utils.GetVisionModels()
 }
+
+func (c *SystemConfig) IsModerationEnabled() bool {
+	return c.Moderation.Enabled
+}
+
+// GetModerationGroups returns the user groups to moderate, empty for all the groups
+func (c *SystemConfig) GetModerationGroups() []string {
+	return c.Moderation.Groups
+}
+
+func (c *SystemConfig) GetModerationModel() string {
+	return strings.TrimSpace(c.Moderation.Model)
+}
+
+func (c *SystemConfig) GetModerationKeywords() []string {
+	return utils.EachNotNil(c.Moderation.Keywords, func(keyword string) *string {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		return utils.Multi(len(keyword) > 0, &keyword, nil)
+	})
+}
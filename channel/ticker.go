@@ -1,8 +1,13 @@
 package channel
 
-import "chat/utils"
-
-func NewTicker(seq Sequence, group string) *Ticker {
+import (
+	"chat/globals"
+	"chat/utils"
+	"fmt"
+	"time"
+)
+
+func NewTicker(seq Sequence, model, group string) *Ticker {
 	stack := make(Sequence, 0)
 	for _, channel := range seq {
 		if channel.IsHitGroup(group) {
@@ -14,52 +19,38 @@ func NewTicker(seq Sequence, group string) *Ticker {
 
 	return &Ticker{
 		Sequence: stack,
+		Model:    model,
+		Group:    group,
+		Strategy: RoutingInstance.GetStrategy(model, group),
 	}
 }
 
+// GetChannelByPriority returns the channel of the priority picked by the routing strategy,
+// the open channels (circuit breaker) and the channels without enabled secrets are skipped
 func (t *Ticker) GetChannelByPriority(priority int) *Channel {
 	var stack Sequence
 
-	for idx, channel := range t.Sequence {
-		if channel.GetPriority() == priority {
-			// get if the next channel has the same priority
-			if idx+1 < len(t.Sequence) && t.Sequence[idx+1].GetPriority() == priority {
-				stack = append(stack, channel)
-				continue
-			}
-
-			if len(stack) == 0 {
-				return channel
-			}
-
-			// stack is not empty
+	for _, channel := range t.Sequence {
+		if channel.GetPriority() == priority && BreakerInstance.IsAvailable(channel) && SecretInstance.IsAvailable(channel) {
 			stack = append(stack, channel)
-
-			// sort by weight and break the loop
-			if idx+1 >= len(t.Sequence) || t.Sequence[idx+1].GetPriority() != priority {
-				stack.Sort()
-				break
-			}
 		}
 	}
 
-	weight := utils.Each(stack, func(channel *Channel) int {
-		return channel.GetWeight()
-	})
-	total := utils.Sum(weight)
-
-	// get random number
-	cursor := utils.Intn(total)
+	// prefer the unsaturated channels (rate limit), the request is queued by the saturated channel if all of them are saturated
+	if free := utils.Filter(stack, func(channel *Channel) bool {
+		return !IsChannelSaturated(channel)
+	}); len(free) > 0 {
+		stack = free
+	}
 
-	// get channel by weight
-	for _, channel := range stack {
-		cursor -= channel.GetWeight()
-		if cursor < 0 {
-			return channel
-		}
+	if len(stack) == 0 {
+		// all the channels of the priority are unavailable
+		return nil
+	} else if len(stack) == 1 {
+		return stack[0]
 	}
 
-	return stack[0]
+	return pickChannel(stack, t.Strategy, t.Model, t.Group, priority)
 }
 
 func (t *Ticker) Next() *Channel {
@@ -72,9 +63,45 @@ func (t *Ticker) Next() *Channel {
 	channel := t.GetChannelByPriority(priority)
 	t.SkipPriority(priority)
 
+	if channel == nil && t.IsDone() && !t.picked {
+		// all the channels are open, fall back to the least recently opened channel instead of failing the request
+		if channel = t.GetFallbackChannel(); channel != nil {
+			globals.Info(fmt.Sprintf("[breaker] all the channels are open for model %s, falling back to channel %s (#%d)", t.Model, channel.GetName(), channel.GetId()))
+		}
+	}
+
+	if channel != nil {
+		t.picked = true
+		BreakerInstance.Begin(channel)
+	}
+
 	return channel
 }
 
+// GetFallbackChannel returns the least recently opened channel (circuit breaker) with enabled secrets
+func (t *Ticker) GetFallbackChannel() *Channel {
+	var fallback *Channel
+	var openedAt time.Time
+
+	for _, channel := range t.Sequence {
+		if !SecretInstance.IsAvailable(channel) {
+			continue
+		}
+
+		at := BreakerInstance.Get(channel.GetId()).GetOpenedAt()
+		if at.IsZero() {
+			continue
+		}
+
+		if fallback == nil || at.Before(openedAt) {
+			fallback = channel
+			openedAt = at
+		}
+	}
+
+	return fallback
+}
+
 func (t *Ticker) SkipPriority(priority int) {
 	for idx, channel := range t.Sequence {
 		if channel.GetPriority() == priority {
@@ -5,27 +5,43 @@ import (
 )
 
 type Channel struct {
-	Id            int                 `json:"id" mapstructure:"id"`
-	Name          string              `json:"name" mapstructure:"name"`
-	Type          string              `json:"type" mapstructure:"type"`
-	Priority      int                 `json:"priority" mapstructure:"priority"`
-	Weight        int                 `json:"weight" mapstructure:"weight"`
-	Models        []string            `json:"models" mapstructure:"models"`
-	Retry         int                 `json:"retry" mapstructure:"retry"`
-	Secret        string              `json:"secret" mapstructure:"secret"`
-	Endpoint      string              `json:"endpoint" mapstructure:"endpoint"`
-	Mapper        string              `json:"mapper" mapstructure:"mapper"`
-	State         bool                `json:"state" mapstructure:"state"`
-	Group         []string            `json:"group" mapstructure:"group"`
-	Proxy         globals.ProxyConfig `json:"proxy" mapstructure:"proxy"`
-	Reflect       *map[string]string  `json:"-"`
-	HitModels     *[]string           `json:"-"`
-	ExcludeModels *[]string           `json:"-"`
-	CurrentSecret *string             `json:"-"`
+	Id            int                   `json:"id" mapstructure:"id"`
+	Name          string                `json:"name" mapstructure:"name"`
+	Type          string                `json:"type" mapstructure:"type"`
+	Priority      int                   `json:"priority" mapstructure:"priority"`
+	Weight        int                   `json:"weight" mapstructure:"weight"`
+	Models        []string              `json:"models" mapstructure:"models"`
+	Retry         int                   `json:"retry" mapstructure:"retry"`
+	Secret        string                `json:"secret" mapstructure:"secret"`
+	Endpoint      string                `json:"endpoint" mapstructure:"endpoint"`
+	Mapper        string                `json:"mapper" mapstructure:"mapper"`
+	State         bool                  `json:"state" mapstructure:"state"`
+	Group         []string              `json:"group" mapstructure:"group"`
+	Proxy         globals.ProxyConfig   `json:"proxy" mapstructure:"proxy"`
+	Timeout       globals.TimeoutConfig `json:"timeout" mapstructure:"timeout"`
+	Limit         ChannelLimit          `json:"limit" mapstructure:"limit"`
+	Reflect       *map[string]string    `json:"-"`
+	HitModels     *[]string             `json:"-"`
+	ExcludeModels *[]string             `json:"-"`
+}
+
+// ChannelLimit is the rate limit of the channel shared across the instances (0 means unlimited)
+type ChannelLimit struct {
+	RPM         int `json:"rpm" mapstructure:"rpm"`                 // requests per minute
+	TPM         int `json:"tpm" mapstructure:"tpm"`                 // tokens (input and output) per minute
+	Concurrency int `json:"concurrency" mapstructure:"concurrency"` // max in-flight requests
+	Queue       int `json:"queue" mapstructure:"queue"`             // seconds to wait for the saturated channel before failing over
 }
 
 type Sequence []*Channel
 
+// ChannelState is the channel with its runtime health state (not stored in the config)
+type ChannelState struct {
+	*Channel
+	Health  BreakerState  `json:"health"`
+	Secrets []SecretState `json:"secrets"`
+}
+
 type Manager struct {
 	Sequence          Sequence            `json:"sequence"`
 	PreflightSequence map[string]Sequence `json:"preflight_sequence"`
@@ -35,6 +51,10 @@ type Manager struct {
 type Ticker struct {
 	Sequence Sequence `json:"sequence"`
 	Cursor   int      `json:"cursor"`
+	Model    string   `json:"model"`
+	Group    string   `json:"group"`
+	Strategy string   `json:"strategy"` // routing strategy to pick the channel of the same priority
+	picked   bool     // whether any channel is picked, the fallback channel is used if all the channels are open
 }
 
 type Charge struct {
@@ -45,6 +65,13 @@ type Charge struct {
 	Output    float32  `json:"output" mapstructure:"output"`
 	Anonymous bool     `json:"anonymous" mapstructure:"anonymous"`
 	Unset     bool     `json:"-" mapstructure:"-"`
+
+	// CacheRead and CacheWrite are the prices of the cached input tokens (quota / 1k tokens), 0 means the input price
+	CacheRead  float32 `json:"cache_read,omitempty" mapstructure:"cacheread"`
+	CacheWrite float32 `json:"cache_write,omitempty" mapstructure:"cachewrite"`
+
+	// BatchDiscount is the discount of the batch api requests (e.g. 0.5 for 50% off), 0 means no discount
+	BatchDiscount float32 `json:"batch_discount,omitempty" mapstructure:"batchdiscount"`
 }
 
 type ChargeSequence []*Charge
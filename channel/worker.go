@@ -5,35 +5,89 @@ import (
 	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
-func NewChatRequest(group string, props *adaptercommon.ChatProps, hook globals.Hook) error {
-	ticker := ConduitInstance.GetTicker(props.OriginalModel, group)
+func NewChatRequest(ctx context.Context, group string, props *adaptercommon.ChatProps, hook globals.Hook) error {
+	_, err := runWithTicker(ctx, props.OriginalModel, group, props.Buffer, func(channel *ChannelRequest) (struct{}, error) {
+		props.MaxRetries = utils.ToPtr(channel.GetRetry())
+		return struct{}{}, newChatRequest(ctx, channel, props, hook)
+	})
+
+	return err
+}
+
+// runWithTicker sends the request to the channels of the model in the priority order until it succeeds or is aborted by the client,
+// the result of each channel is recorded to the circuit breaker and the secret health, the saturated channel (rate limit) is not recorded
+func runWithTicker[T any](ctx context.Context, model string, group string, buffer *utils.Buffer, request func(channel *ChannelRequest) (T, error)) (T, error) {
+	var empty T
+
+	ticker := ConduitInstance.GetTicker(model, group)
 	if ticker == nil || ticker.IsEmpty() {
-		return fmt.Errorf("cannot find channel for model %s", props.OriginalModel)
+		return empty, globals.NewModelNotFoundError("cannot find channel for model %s", model)
 	}
 
 	var err error
 	for !ticker.IsDone() {
-		if channel := ticker.Next(); channel != nil {
-			props.MaxRetries = utils.ToPtr(channel.GetRetry())
-			if err = adapter.NewChatRequest(channel, props, hook); adapter.IsSkipError(err) {
-				return err
+		channel := ticker.Next()
+		if channel == nil {
+			continue
+		}
+
+		release, lerr := AcquireChannel(ctx, channel, buffer)
+		if lerr != nil {
+			// no request is sent to the channel, release the probe of the half-open channel
+			BreakerInstance.Cancel(channel)
+			if err = lerr; adapter.IsSkipError(err) {
+				return empty, err
 			}
 
-			globals.Warn(fmt.Sprintf("[channel] caught error %s for model %s at channel %s", err.Error(), props.OriginalModel, channel.GetName()))
+			globals.Info(fmt.Sprintf("[channel] %s for model %s at channel %s", err.Error(), model, channel.GetName()))
+			continue
+		}
+
+		conf := NewChannelRequest(channel)
+		resp, rerr := request(conf)
+		release()
+		BreakerInstance.Record(channel, rerr)
+		SecretInstance.Record(channel, conf.GetUsedSecret(), rerr)
+		if err = rerr; adapter.IsSkipError(err) || adapter.IsPartialError(err) {
+			return resp, err
 		}
+
+		globals.Warn(fmt.Sprintf("[channel] caught error %s for model %s at channel %s", err.Error(), model, channel.GetName()))
 	}
 
-	globals.Info(fmt.Sprintf("[channel] channels are exhausted for model %s", props.OriginalModel))
+	globals.Info(fmt.Sprintf("[channel] channels are exhausted for model %s", model))
 
 	if err == nil {
-		err = fmt.Errorf("channels are exhausted for model %s", props.OriginalModel)
+		err = fmt.Errorf("channels are exhausted for model %s", model)
+	}
+
+	return empty, err
+}
+
+// newChatRequest sends the chat request to the channel and collects the in-flight requests and the first token latency for the routing strategies
+func newChatRequest(ctx context.Context, channel *ChannelRequest, props *adaptercommon.ChatProps, hook globals.Hook) error {
+	StatsInstance.Begin(channel.Channel)
+
+	start := time.Now()
+	var latency time.Duration
+	err := adapter.NewChatRequest(ctx, channel, props, func(data *globals.Chunk) error {
+		if latency == 0 {
+			latency = time.Since(start)
+		}
+		return hook(data)
+	})
+
+	if latency == 0 {
+		latency = time.Since(start)
 	}
+	StatsInstance.End(channel.Channel, props.OriginalModel, latency, err)
 
 	return err
 }
@@ -65,11 +119,28 @@ func PreflightCache(cache *redis.Client, model string, hash string, buffer *util
 	buffer.SetToolCalls(buf.GetToolCalls())
 	buffer.SetFunctionCall(buf.GetFunctionCall())
 
-	return idx, true, hook(&globals.Chunk{
+	if err := hook(&globals.Chunk{
 		Content:      data,
+		Reasoning:    buf.GetReasoning(),
 		FunctionCall: buf.GetFunctionCall(),
 		ToolCall:     buf.GetToolCalls(),
-	})
+		Logprobs:     buf.GetLogprobs(),
+	}); err != nil {
+		return idx, true, err
+	}
+
+	// replay the extra choices (only when n > 1)
+	for i, choice := range buf.GetChoices() {
+		if err := hook(&globals.Chunk{
+			Content:  choice.Data,
+			Index:    i + 1,
+			Logprobs: utils.Multi[*globals.ChoiceLogprobs](choice.Logprobs != nil, &globals.ChoiceLogprobs{Content: choice.Logprobs}, nil),
+		}); err != nil {
+			return idx, true, err
+		}
+	}
+
+	return idx, true, nil
 }
 
 func StoreCache(cache *redis.Client, hash string, index int64, buffer *utils.Buffer) {
@@ -80,8 +151,9 @@ func StoreCache(cache *redis.Client, hash string, index int64, buffer *utils.Buf
 	cache.Set(cache.Context(), key, raw, expire)
 }
 
-func NewChatRequestWithCache(cache *redis.Client, buffer *utils.Buffer, group string, props *adaptercommon.ChatProps, hook globals.Hook) (bool, error) {
-	hash := utils.Md5Encrypt(utils.Marshal(props))
+func NewChatRequestWithCache(ctx context.Context, cache *redis.Client, buffer *utils.Buffer, group string, props *adaptercommon.ChatProps, hook globals.Hook) (bool, error) {
+	// the content parts are excluded from the props json, so that they are hashed separately
+	hash := utils.Md5Encrypt(utils.Marshal(props) + utils.Marshal(globals.GetMessagesParts(props.Message)))
 
 	if len(props.OriginalModel) == 0 {
 		props.OriginalModel = props.Model
@@ -92,7 +164,7 @@ func NewChatRequestWithCache(cache *redis.Client, buffer *utils.Buffer, group st
 		return true, err
 	}
 
-	if err = NewChatRequest(group, props, hook); err != nil {
+	if err = NewChatRequest(ctx, group, props, hook); err != nil {
 		return false, err
 	}
 
@@ -100,48 +172,197 @@ func NewChatRequestWithCache(cache *redis.Client, buffer *utils.Buffer, group st
 	return false, nil
 }
 
-func NewVideoRequestWithCache(_ *redis.Client, buffer *utils.Buffer, group string, props *adaptercommon.VideoProps, hook globals.Hook) (bool, error) {
+// NewVideoRequestWithCache creates the video job, it returns the channel which the job is created with
+func NewVideoRequestWithCache(_ *redis.Client, buffer *utils.Buffer, group string, props *adaptercommon.VideoProps, hook globals.Hook) (bool, *VideoJobChannel, error) {
 	// TODO: Implement video request with cache
 
 	if len(props.OriginalModel) == 0 {
 		props.OriginalModel = props.Model
 	}
 
+	job, err := runWithTicker(context.Background(), props.OriginalModel, group, buffer, func(channel *ChannelRequest) (*VideoJobChannel, error) {
+		props.MaxRetries = utils.ToPtr(channel.GetRetry())
+		if err := adapter.NewVideoRequest(channel, props, hook); err != nil {
+			return nil, err
+		}
+
+		globals.Debug(fmt.Sprintf(
+			"[channel] calling video request success (channel: %s, user: %s, model: %s, reflected-model: %s, secret: %s)",
+			channel.GetName(), props.User, props.OriginalModel, props.Model,
+			utils.HideSecret(channel.GetUsedSecret(), 16),
+		))
+		return &VideoJobChannel{Id: channel.GetId(), Fingerprint: GetSecretFingerprint(channel.GetUsedSecret())}, nil
+	})
+
+	return false, job, err
+}
+
+// VideoJobChannel is the channel and the secret fingerprint which the video job is created with,
+// the follow-up requests of the job (retrieve, delete and remix) are sent to them since the job only exists there
+type VideoJobChannel struct {
+	Id          int
+	Fingerprint string // fingerprint of the secret, the secret itself is not stored
+}
+
+// GetSecretFingerprint returns the non-reversible fingerprint of the secret (truncated sha256)
+func GetSecretFingerprint(secret string) string {
+	return utils.Sha2Encrypt(secret)[:16]
+}
+
+func (v *VideoJobChannel) getRequest() (*ChannelRequest, error) {
+	channel := ConduitInstance.Sequence.GetChannelById(v.Id)
+	if channel == nil || !channel.GetState() {
+		return nil, fmt.Errorf("channel #%d of the video job is not available", v.Id)
+	}
+
+	for _, secret := range channel.GetSecrets() {
+		if GetSecretFingerprint(secret) == v.Fingerprint {
+			return NewPinnedChannelRequest(channel, secret), nil
+		}
+	}
+
+	// the secret is rotated or removed from the channel
+	globals.Info(fmt.Sprintf("[channel] secret of the video job is not found at channel %s, use the random secret", channel.GetName()))
+	return NewChannelRequest(channel), nil
+}
+
+// NewVideoRemixRequest remixes the video job at the channel which the job is created with
+func NewVideoRemixRequest(job *VideoJobChannel, buffer *utils.Buffer, props *adaptercommon.VideoProps, hook globals.Hook) error {
+	conf, err := job.getRequest()
+	if err != nil {
+		return err
+	}
+
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
+	}
+
+	release, err := AcquireChannel(context.Background(), conf.Channel, buffer)
+	if err != nil {
+		return err
+	}
+
+	// the breaker is not checked since the job only exists at the channel, the request is the trial request of the open channel
+	BreakerInstance.Begin(conf.Channel)
+	props.MaxRetries = utils.ToPtr(conf.GetRetry())
+	err = adapter.NewVideoRequest(conf, props, hook)
+	release()
+	BreakerInstance.Record(conf.Channel, err)
+	SecretInstance.Record(conf.Channel, conf.GetUsedSecret(), err)
+
+	return err
+}
+
+// NewVideoRetrieveRequest returns the job json of the video job from the channel which the job is created with
+func NewVideoRetrieveRequest(job *VideoJobChannel, props *adaptercommon.VideoJobProps) (string, error) {
+	conf, err := job.getRequest()
+	if err != nil {
+		return "", err
+	}
+
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
+	}
+
+	return adapter.NewVideoRetrieveRequest(conf, props)
+}
+
+// NewVideoContentRequest returns the video file of the video job from the channel which the job is created with,
+// the jobs without the stored channel (e.g. created from the chat) are looked up from the channels of the model
+func NewVideoContentRequest(job *VideoJobChannel, group string, props *adaptercommon.VideoJobProps) ([]byte, error) {
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
+	}
+
+	if job != nil {
+		conf, err := job.getRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		return adapter.NewVideoContentRequest(conf, props)
+	}
+
 	ticker := ConduitInstance.GetTicker(props.OriginalModel, group)
 	if ticker == nil || ticker.IsEmpty() {
-		return false, fmt.Errorf("cannot find channel for model %s", props.OriginalModel)
+		return nil, globals.NewModelNotFoundError("cannot find channel for model %s", props.OriginalModel)
 	}
 
+	// the job does not exist at the other channels, so that the failures are not recorded to the channel health
 	var err error
-	var times int = 0
 	for !ticker.IsDone() {
-		if channel := ticker.Next(); channel != nil {
-			times++
-			props.MaxRetries = utils.ToPtr(channel.GetRetry())
-			if err = adapter.NewVideoRequest(channel, props, hook); adapter.IsSkipError(err) {
-				globals.Debug(fmt.Sprintf(
-					"[channel] calling video request success (channel: %s, user: %s, model: %s, reflected-model: %s, secret: %s)",
-					channel.GetName(), props.User, props.OriginalModel, props.Model,
-					utils.HideSecret(channel.GetCurrentSecretValue(), 16),
-				))
-				return false, err
-			}
+		channel := ticker.Next()
+		if channel == nil {
+			continue
+		}
 
-			globals.Warn(fmt.Sprintf(
-				"[channel] caught error: %s (channel: %s, user: %s, model: %s, reflected-model: %s, secret: %s)",
-				err.Error(), channel.GetName(), props.User, props.OriginalModel, props.Model,
-				utils.HideSecret(channel.GetCurrentSecretValue(), 16),
-			))
+		var data []byte
+		if data, err = adapter.NewVideoContentRequest(NewChannelRequest(channel), props); err == nil {
+			return data, nil
 		}
+		props.Current = 0
 	}
 
 	if err == nil {
-		err = fmt.Errorf("channels are all used up (model: %s)", props.OriginalModel)
+		err = fmt.Errorf("channels are exhausted for model %s", props.OriginalModel)
+	}
+	return nil, err
+}
+
+// NewVideoDeleteRequest deletes the video job from the channel which the job is created with
+func NewVideoDeleteRequest(job *VideoJobChannel, props *adaptercommon.VideoJobProps) error {
+	conf, err := job.getRequest()
+	if err != nil {
+		return err
+	}
+
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
+	}
+
+	return adapter.NewVideoDeleteRequest(conf, props)
+}
+
+func NewEmbeddingRequest(group string, props *adaptercommon.EmbeddingProps) (*adaptercommon.EmbeddingResponse, error) {
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
+	}
+
+	return runWithTicker(context.Background(), props.OriginalModel, group, nil, func(channel *ChannelRequest) (*adaptercommon.EmbeddingResponse, error) {
+		props.MaxRetries = utils.ToPtr(channel.GetRetry())
+		return adapter.NewEmbeddingRequest(channel, props)
+	})
+}
+
+func NewAudioRequest(group string, props *adaptercommon.AudioProps) (*adaptercommon.AudioResponse, error) {
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
+	}
+
+	return runWithTicker(context.Background(), props.OriginalModel, group, nil, func(channel *ChannelRequest) (*adaptercommon.AudioResponse, error) {
+		props.MaxRetries = utils.ToPtr(channel.GetRetry())
+		return adapter.NewAudioRequest(channel, props)
+	})
+}
+
+func NewImageRequest(group string, props *adaptercommon.ImageProps) (*adaptercommon.ImageResponse, error) {
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
 	}
 
-	if adapter.IsAvailableError(err) {
-		globals.Info(fmt.Sprintf("[channel] request failed: %s (model: %s, user: %s, attempts: %d, all channels are used up)", err.Error(), props.OriginalModel, props.User, times))
+	return runWithTicker(context.Background(), props.OriginalModel, group, nil, func(channel *ChannelRequest) (*adaptercommon.ImageResponse, error) {
+		props.MaxRetries = utils.ToPtr(channel.GetRetry())
+		return adapter.NewImageRequest(channel, props)
+	})
+}
+
+func NewModerationRequest(group string, props *adaptercommon.ModerationProps) (*adaptercommon.ModerationResponse, error) {
+	if len(props.OriginalModel) == 0 {
+		props.OriginalModel = props.Model
 	}
 
-	return false, err
+	return runWithTicker(context.Background(), props.OriginalModel, group, nil, func(channel *ChannelRequest) (*adaptercommon.ModerationResponse, error) {
+		props.MaxRetries = utils.ToPtr(channel.GetRetry())
+		return adapter.NewModerationRequest(channel, props)
+	})
 }
@@ -91,6 +91,10 @@ func ConnectDatabase() *sql.DB {
 	CreateInvitationTable(db)
 	CreateRedeemTable(db)
 	CreateBroadcastTable(db)
+	CreateModerationLogTable(db)
+	CreateVideoJobTable(db)
+	CreateRelayFileTable(db)
+	CreateRelayBatchTable(db)
 
 	if err := doMigration(db); err != nil {
 		fmt.Println(fmt.Sprintf("migration error: %s", err))
@@ -340,3 +344,76 @@ func CreateQuotaLogTable(db *sql.DB) {
 		fmt.Println(err)
 	}
 }
+
+func CreateModerationLogTable(db *sql.DB) {
+	_, err := globals.ExecDb(db, `
+		CREATE TABLE IF NOT EXISTS moderation_log (
+		  id INT PRIMARY KEY AUTO_INCREMENT,
+		  username VARCHAR(255) DEFAULT '',
+		  model VARCHAR(255) DEFAULT '',
+		  source VARCHAR(255) DEFAULT '',
+		  reason VARCHAR(255) DEFAULT '',
+		  content TEXT,
+		  created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func CreateVideoJobTable(db *sql.DB) {
+	_, err := globals.ExecDb(db, `
+		CREATE TABLE IF NOT EXISTS video_job (
+		  id INT PRIMARY KEY AUTO_INCREMENT,
+		  user_id INT,
+		  video_id VARCHAR(255) NOT NULL,
+		  model VARCHAR(255) DEFAULT '',
+		  status VARCHAR(255) DEFAULT '',
+		  data MEDIUMTEXT,
+		  channel_id INT DEFAULT 0,
+		  secret_fingerprint VARCHAR(64) DEFAULT '',
+		  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		  UNIQUE KEY (user_id, video_id)
+		);
+	`)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func CreateRelayFileTable(db *sql.DB) {
+	_, err := globals.ExecDb(db, `
+		CREATE TABLE IF NOT EXISTS relay_file (
+		  id INT PRIMARY KEY AUTO_INCREMENT,
+		  user_id INT,
+		  file_id VARCHAR(255) NOT NULL,
+		  purpose VARCHAR(255) DEFAULT '',
+		  data MEDIUMTEXT,
+		  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		  UNIQUE KEY (file_id)
+		);
+	`)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func CreateRelayBatchTable(db *sql.DB) {
+	_, err := globals.ExecDb(db, `
+		CREATE TABLE IF NOT EXISTS relay_batch (
+		  id INT PRIMARY KEY AUTO_INCREMENT,
+		  user_id INT,
+		  batch_id VARCHAR(255) NOT NULL,
+		  status VARCHAR(255) DEFAULT '',
+		  data MEDIUMTEXT,
+		  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		  UNIQUE KEY (batch_id)
+		);
+	`)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
@@ -36,6 +36,9 @@ const (
 	NonBilling   = "non-billing"
 	TimesBilling = "times-billing"
 	TokenBilling = "token-billing"
+
+	SecondBilling    = "second-billing"    // audio billing by the seconds of input audio
+	CharacterBilling = "character-billing" // audio billing by the characters of input text
 )
 
 const (
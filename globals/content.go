@@ -0,0 +1,103 @@
+package globals
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ContentTypeText       = "text"
+	ContentTypeImageUrl   = "image_url"
+	ContentTypeInputAudio = "input_audio"
+	ContentTypeFile       = "file"
+)
+
+// ContentPart is the typed content part of the multimodal messages (openai content parts format)
+type ContentPart struct {
+	Type       string             `json:"type"`
+	Text       *string            `json:"text,omitempty"`        // only `text` type
+	ImageUrl   *ContentImageUrl   `json:"image_url,omitempty"`   // only `image_url` type
+	InputAudio *ContentInputAudio `json:"input_audio,omitempty"` // only `input_audio` type
+	File       *ContentFile       `json:"file,omitempty"`        // only `file` type
+}
+
+type ContentImageUrl struct {
+	Url    string  `json:"url"`
+	Detail *string `json:"detail,omitempty"` // auto, low or high
+}
+
+type ContentInputAudio struct {
+	Data   string `json:"data"`   // base64 encoded audio
+	Format string `json:"format"` // wav or mp3
+}
+
+type ContentFile struct {
+	FileId   *string `json:"file_id,omitempty"`
+	FileData *string `json:"file_data,omitempty"` // data url of the file
+	Filename *string `json:"filename,omitempty"`
+}
+
+// GetPartsContent returns the string view of the content parts (the text with the embedded image urls),
+// which is used for tokenizing and the adapters without the content parts support
+func GetPartsContent(parts []ContentPart) string {
+	var result strings.Builder
+	for _, part := range parts {
+		switch part.Type {
+		case ContentTypeText:
+			if part.Text != nil {
+				result.WriteString(*part.Text)
+			}
+		case ContentTypeImageUrl:
+			if part.ImageUrl != nil {
+				result.WriteString(fmt.Sprintf(" %s ", part.ImageUrl.Url))
+			}
+		}
+	}
+
+	return result.String()
+}
+
+// HasContentParts returns whether any of the messages carries the content parts
+func HasContentParts(messages []Message) bool {
+	for _, message := range messages {
+		if len(message.Parts) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StoredMessage is the message with the serialized content parts, which is used to persist the multimodal messages
+// (e.g. the conversations and the responses history) since the parts are excluded from the message json sent to the upstreams
+type StoredMessage struct {
+	Message
+	Parts []ContentPart `json:"parts,omitempty"`
+}
+
+func ToStoredMessages(messages []Message) []StoredMessage {
+	result := make([]StoredMessage, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, StoredMessage{Message: message, Parts: message.Parts})
+	}
+	return result
+}
+
+func FromStoredMessages(messages []StoredMessage) []Message {
+	result := make([]Message, 0, len(messages))
+	for _, message := range messages {
+		message.Message.Parts = message.Parts
+		result = append(result, message.Message)
+	}
+	return result
+}
+
+// GetMessagesParts returns the content parts of the messages in order, which is used to tell the multimodal requests apart
+// (e.g. the cache key of the chat requests)
+func GetMessagesParts(messages []Message) [][]ContentPart {
+	parts := make([][]ContentPart, 0, len(messages))
+	for _, message := range messages {
+		parts = append(parts, message.Parts)
+	}
+	return parts
+}
@@ -0,0 +1,109 @@
+package globals
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RelayError is the typed error of the relay api, it carries the http status and the openai error fields
+type RelayError struct {
+	Status     int
+	Type       string
+	Code       string
+	Param      string
+	Message    string
+	RetryAfter int // seconds before retrying (only for the throttled errors)
+}
+
+func (e *RelayError) Error() string {
+	return e.Message
+}
+
+func (e *RelayError) WithParam(param string) *RelayError {
+	e.Param = param
+	return e
+}
+
+func (e *RelayError) WithRetryAfter(seconds int) *RelayError {
+	e.RetryAfter = seconds
+	return e
+}
+
+func NewRelayError(status int, errType string, code string, message string) *RelayError {
+	return &RelayError{
+		Status:  status,
+		Type:    errType,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func NewInvalidRequestError(param string, format string, args ...interface{}) *RelayError {
+	return NewRelayError(http.StatusBadRequest, "invalid_request_error", "", fmt.Sprintf(format, args...)).WithParam(param)
+}
+
+func NewAuthenticationError(message string) *RelayError {
+	return NewRelayError(http.StatusUnauthorized, "authentication_error", "invalid_api_key", message)
+}
+
+func NewPermissionError(message string) *RelayError {
+	return NewRelayError(http.StatusForbidden, "access_denied_error", "permission_denied", message)
+}
+
+func NewModelNotFoundError(format string, args ...interface{}) *RelayError {
+	return NewRelayError(http.StatusNotFound, "invalid_request_error", "model_not_found", fmt.Sprintf(format, args...)).WithParam("model")
+}
+
+func NewInsufficientQuotaError(format string, args ...interface{}) *RelayError {
+	return NewRelayError(http.StatusPaymentRequired, "quota_exceeded_error", "insufficient_quota", fmt.Sprintf(format, args...))
+}
+
+func NewRateLimitError(retryAfter int, format string, args ...interface{}) *RelayError {
+	return NewRelayError(http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded", fmt.Sprintf(format, args...)).WithRetryAfter(retryAfter)
+}
+
+// NewUpstreamError converts the untyped error of the upstream channels to the relay error,
+// the timeout errors are regarded as the gateway timeout and the others as the bad gateway
+func NewUpstreamError(err error) *RelayError {
+	message := err.Error()
+	lower := strings.ToLower(message)
+
+	switch {
+	case strings.Contains(lower, "timeout") || strings.Contains(lower, "deadline exceeded"):
+		return NewRelayError(http.StatusGatewayTimeout, "chatnio_api_error", "upstream_timeout", message)
+	case strings.Contains(lower, "rate limit") || strings.Contains(lower, "too many requests"):
+		return NewRelayError(http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded", message)
+	default:
+		return NewRelayError(http.StatusBadGateway, "chatnio_api_error", "upstream_error", message)
+	}
+}
+
+var clientErrors = []string{
+	"status code: 400", "status code: 413", "status code: 422",
+	"invalid_request_error", "context_length_exceeded", "maximum context length",
+	"context length", "prompt is too long", "too many tokens",
+}
+
+// IsClientError returns whether the error is caused by the client request (e.g. invalid request, context length exceeded)
+// rather than the upstream channel, the throttled and the auth errors are not regarded as the client errors
+func IsClientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if relay, ok := err.(*RelayError); ok {
+		return relay.Status >= 400 && relay.Status < 500 &&
+			relay.Status != http.StatusUnauthorized && relay.Status != http.StatusForbidden &&
+			relay.Status != http.StatusPaymentRequired && relay.Status != http.StatusTooManyRequests &&
+			relay.Status != http.StatusRequestTimeout
+	}
+
+	lower := strings.ToLower(err.Error())
+	for _, item := range clientErrors {
+		if strings.Contains(lower, item) {
+			return true
+		}
+	}
+	return false
+}
@@ -12,6 +12,7 @@ type ChannelConfig interface {
 	ProcessError(err error) error
 	GetId() int
 	GetProxy() ProxyConfig
+	GetTimeout() TimeoutConfig
 }
 
 type AuthLike interface {
@@ -1,5 +1,19 @@
 package globals
 
+import "time"
+
 func (c *Chunk) IsEmpty() bool {
-	return len(c.Content) == 0 && c.ToolCall == nil && c.FunctionCall == nil
+	return len(c.Content) == 0 && len(c.Reasoning) == 0 && c.ToolCall == nil && c.FunctionCall == nil
+}
+
+func (c TimeoutConfig) GetConnect() time.Duration {
+	return time.Duration(c.Connect) * time.Second
+}
+
+func (c TimeoutConfig) GetFirstToken() time.Duration {
+	return time.Duration(c.FirstToken) * time.Second
+}
+
+func (c TimeoutConfig) GetIdle() time.Duration {
+	return time.Duration(c.Idle) * time.Second
 }
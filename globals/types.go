@@ -9,13 +9,43 @@ type Message struct {
 	FunctionCall     *FunctionCall `json:"function_call,omitempty"`     // only `function` role
 	ToolCallId       *string       `json:"tool_call_id,omitempty"`      // only `tool` role
 	ToolCalls        *ToolCalls    `json:"tool_calls,omitempty"`        // only `assistant` role
-	ReasoningContent *string       `json:"reasoning_content,omitempty"` // only for deepseek reasoner models
+	ReasoningContent *string       `json:"reasoning_content,omitempty"` // only for reasoning models
+	CacheControl     *CacheControl `json:"-"`                           // prompt caching breakpoint (only claude)
+
+	// Parts are the typed content parts of the multimodal messages, the content is kept as the string view of the parts
+	Parts []ContentPart `json:"-"`
+}
+
+// CacheControl is the prompt caching breakpoint of the anthropic api, the prefix before the breakpoint is cached
+type CacheControl struct {
+	Type string `json:"type"`          // ephemeral
+	Ttl  string `json:"ttl,omitempty"` // 5m or 1h
 }
 
 type Chunk struct {
-	Content      string        `json:"content"`
-	ToolCall     *ToolCalls    `json:"tool_call,omitempty"`
-	FunctionCall *FunctionCall `json:"function_call,omitempty"`
+	Content      string          `json:"content"`
+	Reasoning    string          `json:"reasoning,omitempty"` // reasoning content of the reasoning models
+	ToolCall     *ToolCalls      `json:"tool_call,omitempty"`
+	FunctionCall *FunctionCall   `json:"function_call,omitempty"`
+	Index        int             `json:"index,omitempty"`    // choice index (only when n > 1)
+	Logprobs     *ChoiceLogprobs `json:"logprobs,omitempty"` // only when logprobs is enabled
+	Usage        *ChunkUsage     `json:"usage,omitempty"`    // upstream reported usage (only when provided)
+}
+
+// ChunkUsage is the token usage reported by the upstream, zero value means not reported
+type ChunkUsage struct {
+	InputTokens     int `json:"input_tokens"`
+	OutputTokens    int `json:"output_tokens"`    // includes the reasoning tokens
+	ReasoningTokens int `json:"reasoning_tokens"` // only for reasoning models
+
+	// the cached input tokens are included in the input tokens
+	CacheReadTokens  int `json:"cache_read_tokens"`
+	CacheWriteTokens int `json:"cache_write_tokens"` // only for the upstreams billing the cache creation (claude)
+}
+
+type ChoiceLogprobs struct {
+	Content []interface{} `json:"content"`
+	Refusal []interface{} `json:"refusal,omitempty"`
 }
 
 type ChatSegmentResponse struct {
@@ -23,6 +53,7 @@ type ChatSegmentResponse struct {
 	Quota        float32 `json:"quota"`
 	Keyword      string  `json:"keyword"`
 	Message      string  `json:"message"`
+	Reasoning    string  `json:"reasoning,omitempty"`
 	End          bool    `json:"end"`
 	Plan         bool    `json:"plan"`
 }
@@ -45,6 +76,31 @@ type ListModelsItem struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	// extended model metadata (only for `/v1/models/:id` and `/v1/models?extended=true`)
+	Name          string             `json:"name,omitempty"`
+	Description   string             `json:"description,omitempty"`
+	Tags          []string           `json:"tags,omitempty"`
+	ContextLength int                `json:"context_length,omitempty"`
+	Capabilities  *ModelCapabilities `json:"capabilities,omitempty"`
+	Pricing       *ModelPricing      `json:"pricing,omitempty"`
+}
+
+type ModelCapabilities struct {
+	Vision      bool `json:"vision"`
+	Tools       bool `json:"tools"`
+	Reasoning   bool `json:"reasoning"`
+	HighContext bool `json:"high_context"`
+}
+
+// ModelPricing is the price of the model (per 1k tokens for token billing, per request for times billing)
+type ModelPricing struct {
+	Type       string   `json:"type"`
+	Input      float32  `json:"input"`
+	Output     float32  `json:"output"`
+	CacheRead  *float32 `json:"cache_read,omitempty"`
+	CacheWrite *float32 `json:"cache_write,omitempty"`
+	Anonymous  bool     `json:"anonymous"`
 }
 
 type ProxyConfig struct {
@@ -53,3 +109,10 @@ type ProxyConfig struct {
 	Username  string `json:"username" mapstructure:"username"`
 	Password  string `json:"password" mapstructure:"password"`
 }
+
+// TimeoutConfig is the stream timeouts of the channel (in seconds), 0 means no limit
+type TimeoutConfig struct {
+	Connect    int `json:"connect" mapstructure:"connect"`        // until the response headers are received
+	FirstToken int `json:"first_token" mapstructure:"firsttoken"` // until the first chunk is received
+	Idle       int `json:"idle" mapstructure:"idle"`              // between the chunks
+}
@@ -12,6 +12,7 @@ const ChatMaxThread = 5
 const AnonymousMaxThread = 1
 
 var HttpMaxTimeout = 30 * time.Minute
+var StreamHeartbeat = 15 * time.Second // the interval of the sse heartbeats, 0 to disable
 
 var AllowedOrigins []string
 
@@ -265,3 +266,17 @@ func IsVisionModel(model string) bool {
 func IsVideoModel(model string) bool {
 	return in(model, VideoModels)
 }
+
+// ReasoningModels are the keywords of the reasoning (thinking) models
+var ReasoningModels = []string{
+	"gpt-5", "reasoner", "thinking", "deepseek-r1", "qwq",
+}
+
+func IsReasoningModel(model string) bool {
+	// openai o-series reasoning models (o1, o3, o4-mini, ...)
+	if len(model) >= 2 && model[0] == 'o' && model[1] >= '1' && model[1] <= '9' {
+		return true
+	}
+
+	return in(model, ReasoningModels)
+}
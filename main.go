@@ -64,6 +64,8 @@ func main() {
 	app := utils.NewEngine()
 	worker := middleware.RegisterMiddleware(app)
 	defer worker()
+	manager.StartBatchWorker()
+	channel.StartProbeWorker()
 
 	utils.RegisterStaticRoute(app)
 	registerApiRouter(app)
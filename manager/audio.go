@@ -0,0 +1,213 @@
+package manager
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getPostFormPtr(c *gin.Context, key string) *string {
+	if value, ok := c.GetPostForm(key); ok && len(strings.TrimSpace(value)) > 0 {
+		return utils.ToPtr(strings.TrimSpace(value))
+	}
+
+	return nil
+}
+
+func getPostFormFloat(c *gin.Context, key string) *float32 {
+	value := getPostFormPtr(c, key)
+	if value == nil {
+		return nil
+	}
+
+	if f, err := strconv.ParseFloat(*value, 32); err == nil {
+		return utils.ToPtr(float32(f))
+	}
+
+	return nil
+}
+
+// getAudioDuration returns the duration (in seconds) of the transcribed audio
+func getAudioDuration(props *adaptercommon.AudioProps, resp *adaptercommon.AudioResponse) float32 {
+	if resp.Duration > 0 {
+		return resp.Duration
+	}
+
+	switch utils.GetPtrVal(props.ResponseFormat, "") {
+	case "srt", "vtt":
+		if duration := utils.GetSubtitleDuration(resp.Text); duration > 0 {
+			return duration
+		}
+	}
+
+	return utils.EstimateAudioDuration(props.File)
+}
+
+func checkRelayState(c *gin.Context) string {
+	if globals.CloseRelay {
+		abortWithErrorResponse(c, globals.NewPermissionError("relay api is denied of access"))
+		return ""
+	}
+
+	username := utils.GetUserFromContext(c)
+	if username == "" {
+		abortWithErrorResponse(c, globals.NewAuthenticationError("access denied for invalid api key"))
+		return ""
+	}
+
+	if utils.GetAgentFromContext(c) != "api" {
+		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "authentication_error")
+		return ""
+	}
+
+	return username
+}
+
+func audioTranscriptionRelayAPI(c *gin.Context, translate bool) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	model := strings.TrimSuffix(strings.TrimSpace(c.PostForm("model")), "-official")
+	if model == "" {
+		abortWithErrorResponse(c, globals.NewInvalidRequestError("model", "model is required"))
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	file, name, err := utils.ReadFormFile(header)
+	if err != nil || len(file) == 0 {
+		abortWithErrorResponse(c, globals.NewInvalidRequestError("file", "cannot read the audio file"))
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+
+	props := adaptercommon.CreateAudioProps(&adaptercommon.AudioProps{
+		Model:          model,
+		Translate:      translate,
+		File:           file,
+		FileName:       name,
+		Language:       getPostFormPtr(c, "language"),
+		Prompt:         getPostFormPtr(c, "prompt"),
+		ResponseFormat: getPostFormPtr(c, "response_format"),
+		Temperature:    getPostFormFloat(c, "temperature"),
+	})
+	props.User = auth.GetUsernameString(db, user)
+
+	check, plan := checkEnableState(db, cache, user, model, []globals.Message{})
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	buffer := utils.NewBuffer(model, []globals.Message{}, channel.ChargeInstance.GetCharge(model))
+	buffer.SetTokenName(globals.ApiTokenType)
+
+	resp, err := channel.NewAudioRequest(auth.GetGroup(db, user), props)
+	if resp != nil {
+		buffer.Write(resp.Text)
+		buffer.AddAudioUsage(getAudioDuration(props, resp), 0)
+	}
+
+	admin.AnalyseRequest(model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, model)
+		globals.Warn(fmt.Sprintf("error from audio transcription api: %s (instance: %s, client: %s)", err, model, c.ClientIP()))
+
+		sendErrorResponse(c, err)
+		return
+	}
+
+	CollectInputQuota(c, user, buffer, plan)
+
+	c.Data(http.StatusOK, resp.ContentType, resp.Data)
+}
+
+func AudioTranscriptionsRelayAPI(c *gin.Context) {
+	audioTranscriptionRelayAPI(c, false)
+}
+
+func AudioTranslationsRelayAPI(c *gin.Context) {
+	audioTranscriptionRelayAPI(c, true)
+}
+
+func AudioSpeechRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	var form RelaySpeechForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	if len(strings.TrimSpace(form.Input)) == 0 {
+		sendErrorResponse(c, globals.NewInvalidRequestError("input", "input is required"))
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+
+	form.Model = strings.TrimSuffix(form.Model, "-official")
+
+	props := adaptercommon.CreateAudioProps(&adaptercommon.AudioProps{
+		Model:          form.Model,
+		Input:          form.Input,
+		Voice:          utils.Multi(len(form.Voice) > 0, form.Voice, "alloy"),
+		ResponseFormat: form.ResponseFormat,
+		Speed:          form.Speed,
+	})
+	props.User = auth.GetUsernameString(db, user)
+
+	messages := []globals.Message{{Role: globals.User, Content: form.Input}}
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
+	buffer.SetTokenName(globals.ApiTokenType)
+	buffer.AddAudioUsage(0, len([]rune(form.Input)))
+
+	resp, err := channel.NewAudioRequest(auth.GetGroup(db, user), props)
+
+	admin.AnalyseRequest(form.Model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+		globals.Warn(fmt.Sprintf("error from audio speech api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+
+		sendErrorResponse(c, err)
+		return
+	}
+
+	CollectInputQuota(c, user, buffer, plan)
+
+	c.Data(http.StatusOK, resp.ContentType, resp.Data)
+}
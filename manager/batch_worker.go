@@ -0,0 +1,711 @@
+package manager
+
+import (
+	"bufio"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/connection"
+	"chat/globals"
+	"chat/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultBatchWorkers  = 4
+	maxBatchRequests     = 50000
+	maxBatchLineSize     = 16 * 1024 * 1024 // 16 MiB
+	maxBatchErrors       = 100
+	batchProgressDir     = "storage/batches"
+	batchOutputFilename  = "output.jsonl"
+	batchErrorFilename   = "error.jsonl"
+	batchRequestIdPrefix = "batch_req_"
+
+	batchLeaseExpiration = 2 * time.Minute  // the lease of the crashed instance is taken over by the others after the expiration
+	batchLeaseRenewal    = 30 * time.Second // interval to renew the lease and to sync the status changed by the other instances
+	batchSaveInterval    = 2 * time.Second  // the progress is stored at most once per interval
+)
+
+// batchInstanceId identifies the instance holding the batch leases
+var batchInstanceId = utils.GenerateChar(16)
+
+// renewBatchLeaseScript renews the lease only if it is held by the instance
+var renewBatchLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseBatchLeaseScript deletes the lease only if it is held by the instance
+var releaseBatchLeaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// BatchWorker executes the lines of the batches with a shared pool of workers,
+// the progress is appended to the output files of the batch so that the unfinished batches can be resumed after restart.
+// each batch is claimed with the redis lease before running, so that it is run by only one instance at the same time
+type BatchWorker struct {
+	mu      sync.Mutex
+	runners map[string]*batchRunner
+	slots   chan struct{}
+}
+
+type batchRunner struct {
+	mu     sync.Mutex
+	userId int64
+	batch  *RelayBatch
+	stored string    // the stored status of the batch, which is used as the optimistic lock of the updates
+	saved  time.Time // the last time the progress is stored
+	lost   bool      // the lease is lost (e.g. expired while the instance is stalled), the runner stops without finalizing
+}
+
+var BatchWorkerInstance = &BatchWorker{
+	runners: map[string]*batchRunner{},
+	slots:   make(chan struct{}, defaultBatchWorkers),
+}
+
+// StartBatchWorker sets the worker pool size (`batch.workers`) and resumes the unfinished batches,
+// the unfinished batches are rescanned periodically to take over the batches of the crashed instances
+func StartBatchWorker() {
+	if size := viper.GetInt("batch.workers"); size > 0 {
+		BatchWorkerInstance.slots = make(chan struct{}, size)
+	}
+
+	go func() {
+		ticker := time.NewTicker(batchLeaseExpiration)
+		defer ticker.Stop()
+
+		for {
+			resumeBatches()
+			<-ticker.C
+		}
+	}()
+}
+
+func resumeBatches() {
+	rows, err := globals.QueryDb(connection.DB, `
+		SELECT user_id, data FROM relay_batch WHERE status IN (?, ?, ?, ?)
+	`, BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling)
+	if err != nil {
+		globals.Warn(fmt.Sprintf("[batch] failed to query unfinished batches: %s", err.Error()))
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userId int64
+		var data string
+		if err := rows.Scan(&userId, &data); err != nil {
+			continue
+		}
+
+		if batch, err := utils.UnmarshalString[RelayBatch](data); err == nil && isBatchRunning(&batch) {
+			if BatchWorkerInstance.Run(userId, batch) {
+				globals.Info(fmt.Sprintf("[batch] resume batch %s (status: %s)", batch.Id, batch.Status))
+			}
+		}
+	}
+}
+
+func getBatchLeaseKey(id string) string {
+	return fmt.Sprintf("nio:batch-lease:%s", id)
+}
+
+// claimBatchLease claims the lease of the batch, the lease is always claimed if the redis is not configured (single instance)
+func claimBatchLease(cache *redis.Client, id string) bool {
+	if cache == nil {
+		return true
+	}
+
+	ok, err := cache.SetNX(context.Background(), getBatchLeaseKey(id), batchInstanceId, batchLeaseExpiration).Result()
+	if err != nil {
+		globals.Warn(fmt.Sprintf("[batch] failed to claim batch %s: %s", id, err.Error()))
+		return false
+	}
+	return ok
+}
+
+func renewBatchLease(cache *redis.Client, id string) bool {
+	if cache == nil {
+		return true
+	}
+
+	value, err := renewBatchLeaseScript.Run(context.Background(), cache, []string{getBatchLeaseKey(id)}, batchInstanceId, batchLeaseExpiration.Milliseconds()).Int()
+	if err != nil {
+		globals.Warn(fmt.Sprintf("[batch] failed to renew batch %s: %s", id, err.Error()))
+		// the lease is still valid until the expiration, retry at the next renewal
+		return true
+	}
+	return value == 1
+}
+
+func releaseBatchLease(cache *redis.Client, id string) {
+	if cache == nil {
+		return
+	}
+
+	releaseBatchLeaseScript.Run(context.Background(), cache, []string{getBatchLeaseKey(id)}, batchInstanceId)
+}
+
+// Run starts the runner of the batch if it is not running and the lease of the batch is claimed,
+// it returns whether the runner is started
+func (w *BatchWorker) Run(userId int64, batch RelayBatch) bool {
+	w.mu.Lock()
+	if _, ok := w.runners[batch.Id]; ok {
+		w.mu.Unlock()
+		return false
+	}
+
+	if !claimBatchLease(connection.Cache, batch.Id) {
+		// the batch is running on the other instance
+		w.mu.Unlock()
+		return false
+	}
+
+	runner := &batchRunner{
+		userId: userId,
+		batch:  &batch,
+		stored: batch.Status,
+	}
+	w.runners[batch.Id] = runner
+	w.mu.Unlock()
+
+	go func() {
+		done := make(chan struct{})
+		defer func() {
+			if err := recover(); err != nil {
+				globals.Warn(fmt.Sprintf("caught panic from batch worker: %s (batch: %s)\n%s", err, batch.Id, debug.Stack()))
+			}
+
+			close(done)
+			releaseBatchLease(connection.Cache, batch.Id)
+
+			w.mu.Lock()
+			delete(w.runners, batch.Id)
+			w.mu.Unlock()
+		}()
+
+		go runner.keepalive(done)
+		runner.run(w.slots)
+	}()
+
+	return true
+}
+
+func (w *BatchWorker) getRunner(id string) *batchRunner {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.runners[id]
+}
+
+// Get returns the latest state of the running batch of the user
+func (w *BatchWorker) Get(userId int64, id string) *RelayBatch {
+	runner := w.getRunner(id)
+	if runner == nil || runner.userId != userId {
+		return nil
+	}
+
+	return runner.snapshot()
+}
+
+// Cancel marks the running batch as cancelling, the in-flight requests are finished before it is cancelled
+func (w *BatchWorker) Cancel(id string) (*RelayBatch, bool) {
+	runner := w.getRunner(id)
+	if runner == nil {
+		return nil, false
+	}
+
+	return runner.cancel(), true
+}
+
+func getBatchProgressPath(id string, filename string) string {
+	return fmt.Sprintf("%s/%s/%s", batchProgressDir, id, filename)
+}
+
+func (r *batchRunner) snapshot() *RelayBatch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batch := *r.batch
+	return &batch
+}
+
+// update modifies the batch and stores it, the caller must not hold the lock
+func (r *batchRunner) update(fn func(batch *RelayBatch)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fn(r.batch)
+	r.save()
+}
+
+// save stores the batch with the optimistic lock on the stored status, the caller must hold the lock.
+// the status changed by the other instances (e.g. cancelled) is merged before writing instead of being overwritten
+func (r *batchRunner) save() {
+	if r.lost {
+		// the batch is owned or finished by the other instance
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		ok, err := updateRelayBatch(connection.DB, r.batch, r.stored)
+		if err != nil {
+			globals.Warn(fmt.Sprintf("[batch] failed to save batch %s: %s", r.batch.Id, err.Error()))
+			return
+		}
+
+		if ok || !r.merge() {
+			r.stored = r.batch.Status
+			r.saved = time.Now()
+			return
+		}
+	}
+}
+
+// merge reads the stored status of the batch and applies the cancellation made by the other instances,
+// it returns whether the stored status is changed, the caller must hold the lock
+func (r *batchRunner) merge() bool {
+	stored, err := getRelayBatch(connection.DB, r.userId, r.batch.Id)
+	if err != nil || stored.Status == r.stored {
+		return false
+	}
+
+	if !isBatchRunning(stored) {
+		// the batch is finished by the other instance, stop running without overwriting it
+		r.batch.Status = stored.Status
+		r.stored = stored.Status
+		r.lost = true
+		return false
+	}
+
+	if stored.Status == BatchStatusCancelling && isBatchCancellable(r.batch) {
+		r.batch.Status = BatchStatusCancelling
+		r.batch.CancellingAt = stored.CancellingAt
+	}
+
+	r.stored = stored.Status
+	return true
+}
+
+// keepalive renews the lease and syncs the stored status until the runner is done
+func (r *batchRunner) keepalive(done chan struct{}) {
+	ticker := time.NewTicker(batchLeaseRenewal)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if !renewBatchLease(connection.Cache, r.batch.Id) {
+				globals.Warn(fmt.Sprintf("[batch] lease of batch %s is lost, stop running", r.batch.Id))
+				r.lost = true
+				r.mu.Unlock()
+				return
+			}
+
+			r.save()
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *batchRunner) cancel() *RelayBatch {
+	r.update(func(batch *RelayBatch) {
+		if isBatchCancellable(batch) {
+			batch.Status = BatchStatusCancelling
+			batch.CancellingAt = utils.ToPtr(time.Now().Unix())
+		}
+	})
+
+	return r.snapshot()
+}
+
+func (r *batchRunner) fail(errors []RelayBatchError) {
+	r.update(func(batch *RelayBatch) {
+		batch.Status = BatchStatusFailed
+		batch.FailedAt = utils.ToPtr(time.Now().Unix())
+		batch.Errors = &RelayBatchErrors{
+			Object: "list",
+			Data:   errors,
+		}
+	})
+}
+
+// isStopped returns whether the remaining lines should be skipped (cancelled, expired or the lease is lost)
+func (r *batchRunner) isStopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.batch.Status == BatchStatusCancelling || r.isExpired() || r.lost
+}
+
+func (r *batchRunner) isLost() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lost
+}
+
+func (r *batchRunner) isExpired() bool {
+	return r.batch.ExpiresAt != nil && time.Now().Unix() >= *r.batch.ExpiresAt
+}
+
+func (r *batchRunner) run(slots chan struct{}) {
+	db := connection.DB
+	batch := r.snapshot()
+
+	if batch.Status == BatchStatusFinalizing {
+		r.finalize()
+		return
+	}
+
+	user := auth.GetUserById(db, r.userId)
+	if user == nil {
+		r.fail([]RelayBatchError{{Code: "user_not_found", Message: "the owner of the batch does not exist"}})
+		return
+	}
+
+	lines, errors := readBatchLines(db, r.userId, batch)
+	if len(errors) > 0 {
+		r.fail(errors)
+		return
+	}
+
+	r.update(func(batch *RelayBatch) {
+		if batch.Status == BatchStatusValidating {
+			batch.Status = BatchStatusInProgress
+			batch.InProgressAt = utils.ToPtr(time.Now().Unix())
+		}
+		batch.RequestCounts.Total = len(lines)
+	})
+
+	r.process(user, lines, slots)
+	if r.isLost() {
+		// the batch is taken over by the other instance
+		return
+	}
+
+	r.finalize()
+}
+
+// process executes the lines which are not in the output files yet
+func (r *batchRunner) process(user *auth.User, lines []BatchRequestLine, slots chan struct{}) {
+	id := r.batch.Id
+	utils.CreateFolder(fmt.Sprintf("%s/%s", batchProgressDir, id))
+
+	completed := loadBatchProgress(getBatchProgressPath(id, batchOutputFilename))
+	failed := loadBatchProgress(getBatchProgressPath(id, batchErrorFilename))
+	r.update(func(batch *RelayBatch) {
+		batch.RequestCounts.Completed = len(completed)
+		batch.RequestCounts.Failed = len(failed)
+	})
+
+	var wg sync.WaitGroup
+	for _, line := range lines {
+		if completed[line.CustomId] || failed[line.CustomId] {
+			continue
+		}
+
+		if r.isStopped() {
+			break
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(line BatchRequestLine) {
+			defer func() {
+				if err := recover(); err != nil {
+					globals.Warn(fmt.Sprintf("caught panic from batch request: %s (batch: %s, custom id: %s)\n%s", err, id, line.CustomId, debug.Stack()))
+				}
+
+				<-slots
+				wg.Done()
+			}()
+
+			resp, ok := executeBatchLine(connection.DB, connection.Cache, user, id, line)
+			r.write(resp, ok)
+		}(line)
+	}
+
+	wg.Wait()
+}
+
+// write appends the response to the output (or error) file and updates the progress
+func (r *batchRunner) write(resp *BatchResponseLine, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := getBatchProgressPath(r.batch.Id, utils.Multi(ok, batchOutputFilename, batchErrorFilename))
+	if err := appendBatchLine(path, resp); err != nil {
+		globals.Warn(fmt.Sprintf("[batch] failed to write batch %s progress: %s", r.batch.Id, err.Error()))
+		return
+	}
+
+	if ok {
+		r.batch.RequestCounts.Completed++
+	} else {
+		r.batch.RequestCounts.Failed++
+	}
+
+	// the progress writes are batched, the latest progress is stored by the keepalive or the finalization
+	if time.Since(r.saved) >= batchSaveInterval {
+		r.save()
+	}
+}
+
+// finalize registers the output files of the batch and sets the final status
+func (r *batchRunner) finalize() {
+	r.update(func(batch *RelayBatch) {
+		if batch.Status != BatchStatusFinalizing {
+			if batch.Status != BatchStatusCancelling && !r.isExpired() {
+				batch.Status = BatchStatusFinalizing
+			}
+			batch.FinalizingAt = utils.ToPtr(time.Now().Unix())
+		}
+	})
+
+	db := connection.DB
+	id := r.batch.Id
+
+	output := createBatchOutputFile(db, r.userId, id, batchOutputFilename)
+	errors := createBatchOutputFile(db, r.userId, id, batchErrorFilename)
+
+	r.update(func(batch *RelayBatch) {
+		batch.OutputFileId = output
+		batch.ErrorFileId = errors
+
+		now := utils.ToPtr(time.Now().Unix())
+		switch {
+		case batch.Status == BatchStatusCancelling:
+			batch.Status = BatchStatusCancelled
+			batch.CancelledAt = now
+		case batch.Status != BatchStatusFinalizing:
+			batch.Status = BatchStatusExpired
+			batch.ExpiredAt = now
+		default:
+			batch.Status = BatchStatusCompleted
+			batch.CompletedAt = now
+		}
+	})
+
+	if err := os.RemoveAll(fmt.Sprintf("%s/%s", batchProgressDir, id)); err != nil {
+		globals.Warn(fmt.Sprintf("[batch] failed to clean batch %s progress: %s", id, err.Error()))
+	}
+}
+
+func createBatchOutputFile(db *sql.DB, userId int64, id string, filename string) *string {
+	path := getBatchProgressPath(id, filename)
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return nil
+	}
+
+	file, err := createRelayFile(db, userId, path, fmt.Sprintf("%s_%s", id, filename), FilePurposeBatchOutput)
+	if err != nil {
+		globals.Warn(fmt.Sprintf("[batch] failed to create batch %s output file: %s", id, err.Error()))
+		return nil
+	}
+
+	return &file.Id
+}
+
+// readBatchLines reads and validates the lines of the batch input file
+func readBatchLines(db *sql.DB, userId int64, batch *RelayBatch) ([]BatchRequestLine, []RelayBatchError) {
+	if _, err := getRelayFile(db, userId, batch.InputFileId); err != nil {
+		return nil, []RelayBatchError{{Code: "file_not_found", Message: err.Error(), Param: utils.ToPtr("input_file_id")}}
+	}
+
+	file, err := os.Open(getRelayFilePath(batch.InputFileId))
+	if err != nil {
+		return nil, []RelayBatchError{{Code: "file_not_found", Message: fmt.Sprintf("cannot read input file %s", batch.InputFileId), Param: utils.ToPtr("input_file_id")}}
+	}
+	defer file.Close()
+
+	var lines []BatchRequestLine
+	var errors []RelayBatchError
+	ids := map[string]bool{}
+
+	reject := func(index int, code string, param string, format string, args ...interface{}) {
+		if len(errors) < maxBatchErrors {
+			errors = append(errors, RelayBatchError{
+				Code:    code,
+				Message: fmt.Sprintf(format, args...),
+				Param:   utils.Multi[*string](param == "", nil, utils.ToPtr(param)),
+				Line:    utils.ToPtr(index),
+			})
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLineSize)
+
+	index := 0
+	for scanner.Scan() {
+		index++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var line BatchRequestLine
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			reject(index, "invalid_json_line", "", "line %d is not a valid json object: %s", index, err.Error())
+			continue
+		}
+
+		switch {
+		case line.CustomId == "":
+			reject(index, "missing_custom_id", "custom_id", "line %d is missing the custom_id", index)
+		case ids[line.CustomId]:
+			reject(index, "duplicate_custom_id", "custom_id", "the custom_id `%s` of line %d is duplicated", line.CustomId, index)
+		case strings.ToUpper(line.Method) != http.MethodPost:
+			reject(index, "invalid_method", "method", "line %d must use the POST method", index)
+		case line.Url != batch.Endpoint:
+			reject(index, "mismatched_endpoint", "url", "the url `%s` of line %d does not match the batch endpoint `%s`", line.Url, index, batch.Endpoint)
+		case line.Body == nil || line.Body.Model == "":
+			reject(index, "missing_model", "body.model", "line %d is missing the model", index)
+		case len(line.Body.Messages) == 0:
+			reject(index, "invalid_request", "body.messages", "line %d is missing the messages", index)
+		default:
+			ids[line.CustomId] = true
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		reject(index+1, "invalid_json_line", "", "failed to read line %d: %s", index+1, err.Error())
+	}
+
+	if len(errors) == 0 && len(lines) == 0 {
+		errors = append(errors, RelayBatchError{Code: "empty_file", Message: "the input file does not contain any request"})
+	} else if len(lines) > maxBatchRequests {
+		errors = append(errors, RelayBatchError{Code: "too_many_requests", Message: fmt.Sprintf("the input file contains more than %d requests", maxBatchRequests)})
+	}
+
+	return lines, errors
+}
+
+// loadBatchProgress returns the custom ids in the progress file,
+// the file is rewritten without the broken lines (e.g. the process was killed while writing)
+func loadBatchProgress(path string) map[string]bool {
+	ids := map[string]bool{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ids
+	}
+
+	var valid []string
+	for _, text := range strings.Split(string(data), "\n") {
+		if line, err := utils.UnmarshalString[BatchResponseLine](text); err == nil && line.CustomId != "" {
+			ids[line.CustomId] = true
+			valid = append(valid, text)
+		}
+	}
+
+	content := strings.Join(valid, "\n")
+	if len(valid) > 0 {
+		content += "\n"
+	}
+
+	if len(content) != len(data) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			globals.Warn(fmt.Sprintf("[batch] failed to repair batch progress %s: %s", path, err.Error()))
+		}
+	}
+
+	return ids
+}
+
+func appendBatchLine(path string, line *BatchResponseLine) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(utils.Marshal(line) + "\n")
+	return err
+}
+
+// executeBatchLine sends the chat request of the line and returns the response line and whether it succeeded,
+// the quota of the line is collected with the batch discount of the model
+func executeBatchLine(db *sql.DB, cache *redis.Client, user *auth.User, batchId string, line BatchRequestLine) (*BatchResponseLine, bool) {
+	id := utils.Md5Encrypt(batchId + line.CustomId)
+	result := &BatchResponseLine{
+		Id:       fmt.Sprintf("%s%s", batchRequestIdPrefix, id),
+		CustomId: line.CustomId,
+	}
+
+	resp, err := requestBatchChat(db, cache, user, id, *line.Body)
+	if err != nil {
+		relayErr := getRelayError(err)
+		result.Response = &BatchResponse{
+			StatusCode: relayErr.Status,
+			RequestId:  id,
+			Body:       getRelayErrorResponse(relayErr),
+		}
+		return result, false
+	}
+
+	result.Response = &BatchResponse{
+		StatusCode: http.StatusOK,
+		RequestId:  id,
+		Body:       resp,
+	}
+	return result, true
+}
+
+func requestBatchChat(db *sql.DB, cache *redis.Client, user *auth.User, id string, form RelayForm) (*RelayResponse, error) {
+	form.Stream = false
+	messages := getRelayMessages(&form)
+
+	if err := checkModeration(db, user, form.Model, messages, ModerationSourceRelay); err != nil {
+		return nil, getRelayError(err, "moderation_error")
+	}
+
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		return nil, getRelayError(check, "quota_exceeded_error")
+	}
+
+	charge := channel.ChargeInstance.GetCharge(form.Model)
+	buffer := utils.NewBuffer(form.Model, messages, charge)
+	err := channel.NewChatRequest(context.Background(), auth.GetGroup(db, user), getChatProps(form, messages, buffer, user, nil), func(data *globals.Chunk) error {
+		buffer.WriteChunk(data)
+		return nil
+	})
+
+	admin.AnalyseRequest(form.Model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+		globals.Warn(fmt.Sprintf("error from batch request: %s (instance: %s, user: %s)", err.Error(), form.Model, user.Username))
+		return nil, err
+	}
+
+	quota := buffer.GetQuota() * charge.GetBatchRatio()
+	if !plan && quota > 0 && !(buffer.IsEmpty() && buffer.GetUsage() == nil) {
+		user.UseQuota(db, quota, form.Model)
+	}
+
+	resp := getTranshipmentResponse(form, id, time.Now().Unix(), buffer, quota)
+	return &resp, nil
+}
@@ -0,0 +1,312 @@
+package manager
+
+import (
+	"chat/auth"
+	"chat/globals"
+	"chat/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+
+	BatchCompletionWindow = "24h"
+
+	defaultBatchListLimit = 20
+	maxBatchListLimit     = 100
+)
+
+// batchEndpoints are the endpoints supported by the batch api
+var batchEndpoints = []string{"/v1/chat/completions"}
+
+func getBatchIdParam(c *gin.Context) string {
+	id := strings.TrimSpace(c.Param("id"))
+	if id == "" {
+		abortWithErrorResponse(c, globals.NewInvalidRequestError("id", "batch id is required"))
+	}
+
+	return id
+}
+
+func newBatchNotFoundError(id string) *globals.RelayError {
+	return globals.NewRelayError(http.StatusNotFound, "invalid_request_error", "batch_not_found", fmt.Sprintf("no such batch object: %s", id)).WithParam("id")
+}
+
+// isBatchRunning returns whether the batch is still processed by the batch worker
+func isBatchRunning(batch *RelayBatch) bool {
+	return utils.Contains(batch.Status, []string{
+		BatchStatusValidating, BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling,
+	})
+}
+
+func isBatchCancellable(batch *RelayBatch) bool {
+	return batch.Status == BatchStatusValidating || batch.Status == BatchStatusInProgress
+}
+
+// saveRelayBatch stores the batch of the user, the stored batch is updated if it already exists
+func saveRelayBatch(db *sql.DB, userId int64, batch *RelayBatch) error {
+	var count int
+	if err := globals.QueryRowDb(db, `
+		SELECT COUNT(*) FROM relay_batch WHERE batch_id = ?
+	`, batch.Id).Scan(&count); err != nil {
+		return err
+	}
+
+	var err error
+	if count > 0 {
+		_, err = globals.ExecDb(db, `
+			UPDATE relay_batch SET status = ?, data = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND batch_id = ?
+		`, batch.Status, utils.Marshal(batch), userId, batch.Id)
+	} else {
+		_, err = globals.ExecDb(db, `
+			INSERT INTO relay_batch (user_id, batch_id, status, data) VALUES (?, ?, ?, ?)
+		`, userId, batch.Id, batch.Status, utils.Marshal(batch))
+	}
+
+	return err
+}
+
+// updateRelayBatch stores the batch only if the stored status is not changed since it is read (optimistic lock),
+// it returns whether the batch is updated
+func updateRelayBatch(db *sql.DB, batch *RelayBatch, status string) (bool, error) {
+	result, err := globals.ExecDb(db, `
+		UPDATE relay_batch SET status = ?, data = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE batch_id = ? AND status = ?
+	`, batch.Status, utils.Marshal(batch), batch.Id, status)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return err == nil && affected > 0, nil
+}
+
+func getRelayBatch(db *sql.DB, userId int64, id string) (*RelayBatch, error) {
+	var data string
+	if err := globals.QueryRowDb(db, `
+		SELECT data FROM relay_batch WHERE user_id = ? AND batch_id = ?
+	`, userId, id).Scan(&data); err != nil {
+		return nil, newBatchNotFoundError(id)
+	}
+
+	batch, err := utils.UnmarshalString[RelayBatch](data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse batch object for batch id %s", id)
+	}
+
+	return &batch, nil
+}
+
+// getRelayBatches returns the batches of the user after the cursor (newest first) and whether there are more batches
+func getRelayBatches(db *sql.DB, userId int64, after string, limit int) ([]RelayBatch, bool, error) {
+	var cursor int64
+	if after != "" {
+		if err := globals.QueryRowDb(db, `
+			SELECT id FROM relay_batch WHERE user_id = ? AND batch_id = ?
+		`, userId, after).Scan(&cursor); err != nil {
+			return nil, false, newBatchNotFoundError(after).WithParam("after")
+		}
+	}
+
+	rows, err := globals.QueryDb(db, `
+		SELECT data FROM relay_batch
+		WHERE user_id = ? AND (? = 0 OR id < ?)
+		ORDER BY id DESC LIMIT ?
+	`, userId, cursor, cursor, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	batches := make([]RelayBatch, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, false, err
+		}
+
+		if batch, err := utils.UnmarshalString[RelayBatch](data); err == nil {
+			batches = append(batches, batch)
+		}
+	}
+
+	if len(batches) > limit {
+		return batches[:limit], true, nil
+	}
+	return batches, false, nil
+}
+
+func BatchesCreateRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	var form RelayBatchForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	if !utils.Contains(form.Endpoint, batchEndpoints) {
+		sendErrorResponse(c, globals.NewInvalidRequestError("endpoint", "unsupported endpoint `%s`, supported endpoints: %s", form.Endpoint, strings.Join(batchEndpoints, ", ")))
+		return
+	}
+
+	if form.CompletionWindow != BatchCompletionWindow {
+		sendErrorResponse(c, globals.NewInvalidRequestError("completion_window", "unsupported completion window `%s`, only `%s` is supported", form.CompletionWindow, BatchCompletionWindow))
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+	userId := user.GetID(db)
+
+	file, err := getRelayFile(db, userId, form.InputFileId)
+	if err != nil {
+		sendErrorResponse(c, getRelayError(err, "invalid_request_error").WithParam("input_file_id"))
+		return
+	}
+
+	if file.Purpose != FilePurposeBatch {
+		sendErrorResponse(c, globals.NewInvalidRequestError("input_file_id", "file %s must be uploaded with purpose `%s`", file.Id, FilePurposeBatch))
+		return
+	}
+
+	created := time.Now()
+	batch := &RelayBatch{
+		Id:               fmt.Sprintf("batch_%s", utils.Md5Encrypt(username+file.Id+created.String())),
+		Object:           "batch",
+		Endpoint:         form.Endpoint,
+		InputFileId:      file.Id,
+		CompletionWindow: form.CompletionWindow,
+		Status:           BatchStatusValidating,
+		CreatedAt:        created.Unix(),
+		ExpiresAt:        utils.ToPtr(created.Add(24 * time.Hour).Unix()),
+		Metadata:         form.Metadata,
+	}
+
+	if err := saveRelayBatch(db, userId, batch); err != nil {
+		globals.Warn(fmt.Sprintf("[batch] failed to store batch %s: %s", batch.Id, err.Error()))
+		sendErrorResponse(c, newRelayInternalError("failed to store the batch object"))
+		return
+	}
+
+	BatchWorkerInstance.Run(userId, *batch)
+	c.JSON(http.StatusOK, batch)
+}
+
+func BatchesListRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+
+	batches, more, err := getRelayBatches(db, user.GetID(db), c.Query("after"), getListLimit(c, defaultBatchListLimit, maxBatchListLimit))
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	list := RelayBatchList{
+		Object:  "list",
+		Data:    batches,
+		HasMore: more,
+	}
+	if len(batches) > 0 {
+		list.FirstId = &batches[0].Id
+		list.LastId = &batches[len(batches)-1].Id
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func BatchesRetrieveRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getBatchIdParam(c)
+	if id == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+	userId := user.GetID(db)
+
+	if batch := BatchWorkerInstance.Get(userId, id); batch != nil {
+		// the running batch is served from the worker to get the latest progress
+		c.JSON(http.StatusOK, batch)
+		return
+	}
+
+	batch, err := getRelayBatch(db, userId, id)
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+func BatchesCancelRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getBatchIdParam(c)
+	if id == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+	userId := user.GetID(db)
+
+	batch, err := getRelayBatch(db, userId, id)
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	if current, ok := BatchWorkerInstance.Cancel(id); ok {
+		batch = current
+	} else if isBatchCancellable(batch) {
+		// the batch is not running on this instance, the worker finalizes the cancelled batch
+		batch.Status = BatchStatusCancelling
+		batch.CancellingAt = utils.ToPtr(time.Now().Unix())
+		if err := saveRelayBatch(db, userId, batch); err != nil {
+			sendErrorResponse(c, err)
+			return
+		}
+
+		BatchWorkerInstance.Run(userId, *batch)
+	}
+
+	if batch.Status != BatchStatusCancelling && batch.Status != BatchStatusCancelled {
+		sendErrorResponse(c, globals.NewInvalidRequestError("id", "batch %s cannot be cancelled in status `%s`", id, batch.Status))
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
@@ -14,7 +14,6 @@ import (
 	"time"
 
 	"database/sql"
-	"errors"
 	"fmt"
 	"runtime/debug"
 	"strings"
@@ -24,7 +23,6 @@ import (
 )
 
 const defaultMessage = "empty response"
-const interruptMessage = "interrupted"
 
 func CollectQuota(c *gin.Context, user *auth.User, buffer *utils.Buffer, uncountable bool, err error, modelName ...string) {
 	db := utils.GetDBFromContext(c)
@@ -34,7 +32,7 @@ func CollectQuota(c *gin.Context, user *auth.User, buffer *utils.Buffer, uncount
 		return
 	}
 
-	if buffer.IsEmpty() || err != nil {
+	if (buffer.IsEmpty() && buffer.GetUsage() == nil) || err != nil {
 		return
 	}
 
@@ -50,47 +48,17 @@ type partialChunk struct {
 	Error error
 }
 
-func createStopSignal(conn *Connection) chan bool {
-	stopSignal := make(chan bool, 1)
-	go func(conn *Connection, stopSignal chan bool) {
-		ticker := time.NewTicker(100 * time.Millisecond)
-		defer func() {
-			ticker.Stop()
-			if r := recover(); r != nil && !strings.Contains(fmt.Sprintf("%s", r), "closed channel") {
-				stack := debug.Stack()
-				globals.Warn(fmt.Sprintf("caught panic from stop signal: %s\n%s", r, stack))
-			}
-		}()
-
-		for {
-			select {
-			case <-ticker.C:
-				state := conn.PeekStop() != nil // check the stop state
-				stopSignal <- state
-
-				if state {
-					break
-				}
-			}
-		}
-	}(conn, stopSignal)
-
-	return stopSignal
-}
-
 func createChatTask(
 	conn *Connection, user *auth.User, buffer *utils.Buffer, db *sql.DB, cache *redis.Client,
 	model string, instance *conversation.Conversation, segment []globals.Message, plan bool,
 	ip string,
 ) (hit bool, err error) {
 	chunkChan := make(chan partialChunk, 24) // the channel to send the chunk data
-	interruptSignal := make(chan error, 1)   // the signal to interrupt the chat task routine
-	stopSignal := createStopSignal(conn)     // the signal to stop from the client
+	ctx, cancel := conn.WithCancel()         // the context is canceled once the client stops or disconnects
 
 	defer func() {
-		// close all channels
-		close(interruptSignal)
-		close(stopSignal)
+		// abort the upstream request and close the channel
+		cancel()
 		close(chunkChan)
 	}()
 
@@ -117,7 +85,7 @@ func createChatTask(
 			props.User = auth.GetUsernameString(db, user)
 
 			var finalJobJson string
-			hit, err := channel.NewVideoRequestWithCache(
+			hit, _, err := channel.NewVideoRequestWithCache(
 				cache, buffer,
 				auth.GetGroup(db, user),
 				props,
@@ -171,7 +139,7 @@ func createChatTask(
 		}
 
 		hit, err := channel.NewChatRequestWithCache(
-			cache, buffer,
+			ctx, cache, buffer,
 			auth.GetGroup(db, user),
 			adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
 				Model:             model,
@@ -189,9 +157,9 @@ func createChatTask(
 
 			// the function to handle the chunk data
 			func(data *globals.Chunk) error {
-				// if interrupt signal is received
-				if len(interruptSignal) > 0 {
-					return errors.New(interruptMessage)
+				// if the chat task is interrupted
+				if ctx.Err() != nil {
+					return ctx.Err()
 				}
 
 				// send the chunk data to the channel
@@ -217,9 +185,9 @@ func createChatTask(
 	for {
 		select {
 		case data := <-chunkChan:
-			if data.Error != nil && data.Error.Error() == interruptMessage {
-				// skip the interrupt message
-				continue
+			if ctx.Err() != nil {
+				// the upstream is aborted by the client, the chunk is dropped
+				return stopChatTask(conn, buffer, model, plan)
 			}
 
 			hit = data.Hit
@@ -230,33 +198,37 @@ func createChatTask(
 			}
 
 			if err := conn.SendClient(globals.ChatSegmentResponse{
-				Message: buffer.WriteChunk(data.Chunk),
-				Quota:   buffer.GetQuota(),
-				End:     false,
-				Plan:    plan,
+				Message:   buffer.WriteChunk(data.Chunk),
+				Reasoning: data.Chunk.Reasoning,
+				Quota:     buffer.GetQuota(),
+				End:       false,
+				Plan:      plan,
 			}); err != nil {
 				globals.Warn(fmt.Sprintf("failed to send message to client: %s", err.Error()))
-				interruptSignal <- err
 				return hit, nil
 			}
 
-		case signal := <-stopSignal:
-			// if stop signal is received
-			if signal {
-				globals.Info(fmt.Sprintf("client stopped the chat request (model: %s, client: %s)", model, conn.GetCtx().ClientIP()))
-				_ = conn.SendClient(globals.ChatSegmentResponse{
-					Quota: buffer.GetQuota(),
-					End:   true,
-					Plan:  plan,
-				})
-				interruptSignal <- errors.New("signal")
-
-				return
-			}
+		case <-ctx.Done():
+			return stopChatTask(conn, buffer, model, plan)
 		}
 	}
 }
 
+// stopChatTask ends the chat task stopped by the client, only the produced tokens are billed
+func stopChatTask(conn *Connection, buffer *utils.Buffer, model string, plan bool) (bool, error) {
+	// skip the stop signal of the client
+	conn.PeekStop()
+
+	globals.Info(fmt.Sprintf("client stopped the chat request (model: %s, client: %s)", model, conn.GetCtx().ClientIP()))
+	_ = conn.SendClient(globals.ChatSegmentResponse{
+		Quota: buffer.GetQuota(),
+		End:   true,
+		Plan:  plan,
+	})
+
+	return false, nil
+}
+
 func ChatHandler(conn *Connection, user *auth.User, instance *conversation.Conversation, restart bool, ip string) string {
 	defer func() {
 		if err := recover(); err != nil {
@@ -273,6 +245,16 @@ func ChatHandler(conn *Connection, user *auth.User, instance *conversation.Conve
 	model := instance.GetModel()
 	segment := adapter.ClearMessages(model, web.ToChatSearched(instance, restart))
 
+	if err := checkModeration(db, user, model, segment, ModerationSourceChat); err != nil {
+		message := err.Error()
+		conn.Send(globals.ChatSegmentResponse{
+			Conversation: instance.GetId(),
+			Message:      message,
+			End:          true,
+		})
+		return message
+	}
+
 	check, plan := auth.CanEnableModelWithSubscription(db, cache, user, model, segment)
 	conn.Send(globals.ChatSegmentResponse{
 		Conversation: instance.GetId(),
@@ -295,7 +277,12 @@ func ChatHandler(conn *Connection, user *auth.User, instance *conversation.Conve
 	if adapter.IsAvailableError(err) {
 		globals.Warn(fmt.Sprintf("%s (model: %s, client: %s)", err, model, conn.GetCtx().ClientIP()))
 
-		auth.RevertSubscriptionUsage(db, cache, user, model)
+		if adapter.IsPartialError(err) {
+			// the stream is failed halfway without retrying, the content delivered to the client is billed
+			CollectQuota(conn.GetCtx(), user, buffer, plan, nil, model)
+		} else {
+			auth.RevertSubscriptionUsage(db, cache, user, model)
+		}
 		conn.Send(globals.ChatSegmentResponse{
 			Message: err.Error(),
 			End:     true,
@@ -321,5 +308,6 @@ func ChatHandler(conn *Connection, user *auth.User, instance *conversation.Conve
 		Plan:  plan,
 	})
 
-	return buffer.ReadWithDefault(defaultMessage)
+	// the reasoning content is stored in the think block of the message
+	return buffer.ReadWithReasoning(defaultMessage)
 }
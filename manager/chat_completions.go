@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"chat/adapter"
 	adaptercommon "chat/adapter/common"
 	"chat/addition/web"
 	"chat/admin"
@@ -8,6 +9,7 @@ import (
 	"chat/channel"
 	"chat/globals"
 	"chat/utils"
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
@@ -38,13 +40,13 @@ func checkEnableState(db *sql.DB, cache *redis.Client, user *auth.User, model st
 
 func ChatRelayAPI(c *gin.Context) {
 	if globals.CloseRelay {
-		abortWithErrorResponse(c, fmt.Errorf("relay api is denied of access"), "access_denied_error")
+		abortWithErrorResponse(c, globals.NewPermissionError("relay api is denied of access"))
 		return
 	}
 
 	username := utils.GetUserFromContext(c)
 	if username == "" {
-		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid api key"), "authentication_error")
+		abortWithErrorResponse(c, globals.NewAuthenticationError("access denied for invalid api key"))
 		return
 	}
 
@@ -67,6 +69,27 @@ func ChatRelayAPI(c *gin.Context) {
 	id := utils.Md5Encrypt(username + form.Model + time.Now().String())
 	created := time.Now().Unix()
 
+	messages := getRelayMessages(&form)
+	if err := checkModeration(db, user, form.Model, messages, ModerationSourceRelay); err != nil {
+		sendErrorResponse(c, err, "moderation_error")
+		return
+	}
+
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	if form.Stream {
+		sendStreamTranshipmentResponse(c, form, messages, id, created, user, plan)
+	} else {
+		sendTranshipmentResponse(c, form, messages, id, created, user, plan)
+	}
+}
+
+// getRelayMessages returns the messages of the relay form, the `web-` and `-official` model prefixes are resolved
+func getRelayMessages(form *RelayForm) []globals.Message {
 	messages := transform(form.Messages)
 	if strings.HasPrefix(form.Model, "web-") {
 		suffix := strings.TrimPrefix(form.Model, "web-")
@@ -80,17 +103,38 @@ func ChatRelayAPI(c *gin.Context) {
 		form.Official = true
 	}
 
-	check, plan := checkEnableState(db, cache, user, form.Model, messages)
-	if check != nil {
-		sendErrorResponse(c, check, "quota_exceeded_error")
-		return
+	return messages
+}
+
+// getStopSequences converts the stop param (string or string array) to the stop sequences
+func getStopSequences(stop interface{}) []string {
+	switch v := stop.(type) {
+	case string:
+		if len(v) > 0 {
+			return []string{v}
+		}
+	case []interface{}:
+		return utils.EachNotNil(v, func(item interface{}) *string {
+			if value, ok := item.(string); ok && len(value) > 0 {
+				return &value
+			}
+			return nil
+		})
 	}
 
-	if form.Stream {
-		sendStreamTranshipmentResponse(c, form, messages, id, created, user, plan)
-	} else {
-		sendTranshipmentResponse(c, form, messages, id, created, user, plan)
+	return nil
+}
+
+// getThinkingBudget returns the reasoning token budget of the thinking param, nil if the thinking param is not set
+func getThinkingBudget(thinking *RelayThinking) *int {
+	if thinking == nil {
+		return nil
 	}
+
+	if thinking.Type != "enabled" {
+		return utils.ToPtr(0)
+	}
+	return utils.ToPtr(thinking.BudgetTokens)
 }
 
 func getChatProps(form RelayForm, messages []globals.Message, buffer *utils.Buffer, user *auth.User, c *gin.Context) *adaptercommon.ChatProps {
@@ -114,6 +158,18 @@ func getChatProps(form RelayForm, messages []globals.Message, buffer *utils.Buff
 		TopK:              form.TopK,
 		Tools:             form.Tools,
 		ToolChoice:        form.ToolChoice,
+		ParallelToolCalls: form.ParallelToolCalls,
+		ResponseFormat:    form.ResponseFormat,
+		Stop:              getStopSequences(form.Stop),
+		Seed:              form.Seed,
+		N:                 form.N,
+		LogitBias:         form.LogitBias,
+		Logprobs:          form.Logprobs,
+		TopLogprobs:       form.TopLogprobs,
+		ReasoningEffort:   form.ReasoningEffort,
+		ThinkingBudget:    getThinkingBudget(form.Thinking),
+		CacheControl:      form.CacheControl,
+		IncludeUsage:      form.StreamOptions != nil && form.StreamOptions.IncludeUsage,
 		User:              username, // Use username here if needed
 		Ip:                getClientIP(c),
 	}, buffer)
@@ -124,7 +180,7 @@ func sendTranshipmentResponse(c *gin.Context, form RelayForm, messages []globals
 	cache := utils.GetCacheFromContext(c)
 
 	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
-	hit, err := channel.NewChatRequestWithCache(cache, buffer, auth.GetGroup(db, user), getChatProps(form, messages, buffer, user, c), func(data *globals.Chunk) error {
+	hit, err := channel.NewChatRequestWithCache(c.Request.Context(), cache, buffer, auth.GetGroup(db, user), getChatProps(form, messages, buffer, user, c), func(data *globals.Chunk) error {
 		buffer.WriteChunk(data)
 		return nil
 	})
@@ -142,32 +198,78 @@ func sendTranshipmentResponse(c *gin.Context, form RelayForm, messages []globals
 		CollectQuota(c, user, buffer, plan, err)
 	}
 
+	c.JSON(http.StatusOK, getTranshipmentResponse(form, id, created, buffer, buffer.GetQuota()))
+}
+
+func getTranshipmentResponse(form RelayForm, id string, created int64, buffer *utils.Buffer, quota float32) RelayResponse {
 	tools := buffer.GetToolCalls()
 
-	c.JSON(http.StatusOK, RelayResponse{
+	choices := []Choice{
+		{
+			Index: 0,
+			Message: globals.Message{
+				Role:             globals.Assistant,
+				Content:          buffer.Read(),
+				ToolCalls:        tools,
+				FunctionCall:     buffer.GetFunctionCall(),
+				ReasoningContent: utils.Multi[*string](buffer.GetReasoning() != "", utils.ToPtr(buffer.GetReasoning()), nil),
+			},
+			FinishReason: utils.Multi(tools != nil, ReasonToolCalls, ReasonStop),
+			Logprobs:     buffer.GetLogprobs(),
+		},
+	}
+
+	// extra choices (only when n > 1)
+	for i, choice := range buffer.GetChoices() {
+		choices = append(choices, Choice{
+			Index: i + 1,
+			Message: globals.Message{
+				Role:    globals.Assistant,
+				Content: choice.Data,
+			},
+			FinishReason: ReasonStop,
+			Logprobs:     utils.Multi[*globals.ChoiceLogprobs](choice.Logprobs != nil, &globals.ChoiceLogprobs{Content: choice.Logprobs}, nil),
+		})
+	}
+
+	return RelayResponse{
 		Id:      fmt.Sprintf("chatcmpl-%s", id),
 		Object:  "chat.completion",
 		Created: created,
 		Model:   form.Model,
-		Choices: []Choice{
-			{
-				Index: 0,
-				Message: globals.Message{
-					Role:         globals.Assistant,
-					Content:      buffer.Read(),
-					ToolCalls:    tools,
-					FunctionCall: buffer.GetFunctionCall(),
-				},
-				FinishReason: utils.Multi(tools != nil, ReasonToolCalls, ReasonStop),
-			},
-		},
-		Usage: Usage{
-			PromptTokens:     buffer.CountInputToken(),
-			CompletionTokens: buffer.CountOutputToken(false),
-			TotalTokens:      buffer.CountToken(),
-		},
-		Quota: utils.Multi[*float32](form.Official, nil, utils.ToPtr(buffer.GetQuota())),
-	})
+		Choices: choices,
+		Usage:   getRelayUsage(buffer, false),
+		Quota:   utils.Multi[*float32](form.Official, nil, utils.ToPtr(quota)),
+	}
+}
+
+// getRelayUsage returns the usage of the buffer, the upstream reported usage is preferred
+func getRelayUsage(buffer *utils.Buffer, running bool) Usage {
+	output := buffer.CountOutputToken(running)
+	usage := Usage{
+		PromptTokens:     buffer.CountInputToken(),
+		CompletionTokens: output,
+		TotalTokens:      buffer.CountInputToken() + output,
+	}
+
+	if upstream := buffer.GetUsage(); upstream != nil && upstream.ReasoningTokens > 0 {
+		usage.CompletionTokensDetails = &CompletionTokensDetails{
+			ReasoningTokens: upstream.ReasoningTokens,
+		}
+	} else if !running && buffer.GetReasoning() != "" {
+		// the reasoning tokens are estimated if the upstream does not report them
+		usage.CompletionTokensDetails = &CompletionTokensDetails{
+			ReasoningTokens: buffer.CountReasoningToken(),
+		}
+	}
+
+	if upstream := buffer.GetUsage(); upstream != nil && upstream.CacheReadTokens > 0 {
+		usage.PromptTokensDetails = &PromptTokensDetails{
+			CachedTokens: upstream.CacheReadTokens,
+		}
+	}
+
+	return usage
 }
 
 func getFinishReason(buffer *utils.Buffer, end bool) interface{} {
@@ -183,7 +285,7 @@ func getFinishReason(buffer *utils.Buffer, end bool) interface{} {
 }
 
 func getRole(data *globals.Chunk) string {
-	if data.Content != "" {
+	if data.Content != "" || data.Reasoning != "" {
 		return globals.Assistant
 	} else if data.ToolCall != nil {
 		return globals.Tool
@@ -195,6 +297,12 @@ func getRole(data *globals.Chunk) string {
 }
 
 func getStreamTranshipmentForm(id string, created int64, form RelayForm, data *globals.Chunk, buffer *utils.Buffer, end bool, err error) RelayStreamResponse {
+	reason := getFinishReason(buffer, end)
+	if end && data.Index > 0 {
+		// the tool calls of the extra choices are not supported
+		reason = ReasonStop
+	}
+
 	return RelayStreamResponse{
 		Id:      fmt.Sprintf("chatcmpl-%s", id),
 		Object:  "chat.completion.chunk",
@@ -202,26 +310,37 @@ func getStreamTranshipmentForm(id string, created int64, form RelayForm, data *g
 		Model:   form.Model,
 		Choices: []ChoiceDelta{
 			{
-				Index: 0,
+				Index: data.Index,
 				Delta: Message{
-					Role:         getRole(data),
-					Content:      data.Content,
-					ToolCalls:    data.ToolCall,
-					FunctionCall: data.FunctionCall,
+					Role:             getRole(data),
+					Content:          data.Content,
+					ToolCalls:        data.ToolCall,
+					FunctionCall:     data.FunctionCall,
+					ReasoningContent: utils.Multi[*string](data.Reasoning != "", &data.Reasoning, nil),
 				},
-				FinishReason: getFinishReason(buffer, end),
+				FinishReason: reason,
+				Logprobs:     data.Logprobs,
 			},
 		},
-		Usage: Usage{
-			PromptTokens:     buffer.CountInputToken(),
-			CompletionTokens: buffer.CountOutputToken(true),
-			TotalTokens:      buffer.CountToken(),
-		},
+		Usage: getRelayUsage(buffer, true),
 		Quota: utils.Multi[*float32](form.Official, nil, utils.ToPtr(buffer.GetQuota())),
 		Error: err,
 	}
 }
 
+// getStreamUsageForm returns the final usage-only chunk (only when stream_options.include_usage is enabled)
+func getStreamUsageForm(id string, created int64, form RelayForm, buffer *utils.Buffer) RelayStreamResponse {
+	return RelayStreamResponse{
+		Id:      fmt.Sprintf("chatcmpl-%s", id),
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   form.Model,
+		Choices: []ChoiceDelta{},
+		Usage:   getRelayUsage(buffer, false),
+		Quota:   utils.Multi[*float32](form.Official, nil, utils.ToPtr(buffer.GetRecordQuota())),
+	}
+}
+
 func sendStreamTranshipmentResponse(c *gin.Context, form RelayForm, messages []globals.Message, id string, created int64, user *auth.User, plan bool) {
 	partial := make(chan RelayStreamResponse)
 	db := utils.GetDBFromContext(c)
@@ -230,43 +349,62 @@ func sendStreamTranshipmentResponse(c *gin.Context, form RelayForm, messages []g
 	group := auth.GetGroup(db, user)
 	charge := channel.ChargeInstance.GetCharge(form.Model)
 
-	go func() {
+	relay := newRelayStream(c)
+	defer relay.wait()
+
+	relay.run(func(ctx context.Context) {
+		defer close(partial)
+
 		buffer := utils.NewBuffer(form.Model, messages, charge)
 		hit, err := channel.NewChatRequestWithCache(
-			cache, buffer, group, getChatProps(form, messages, buffer, user, c),
+			ctx, cache, buffer, group, getChatProps(form, messages, buffer, user, c),
 			func(data *globals.Chunk) error {
 				buffer.WriteChunk(data)
 
-				if !data.IsEmpty() {
-					partial <- getStreamTranshipmentForm(id, created, form, data, buffer, false, nil)
+				if !data.IsEmpty() && !sendPartial(ctx, partial, getStreamTranshipmentForm(id, created, form, data, buffer, false, nil)) {
+					return ctx.Err()
 				}
 				return nil
 			},
 		)
 
 		admin.AnalyseRequest(form.Model, buffer, err)
+		if adapter.IsCanceledError(err) {
+			// the client is gone, only the produced tokens are billed
+			CollectQuota(c, user, buffer, plan, nil)
+			return
+		}
+
 		if err != nil {
-			auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+			if adapter.IsPartialError(err) {
+				// the stream is failed halfway without retrying, the content delivered to the client is billed
+				CollectQuota(c, user, buffer, plan, nil)
+			} else {
+				auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+			}
 			globals.Warn(fmt.Sprintf("error from chat request api: %s (instance: %s, client: %s)", err.Error(), form.Model, c.ClientIP()))
-			partial <- getStreamTranshipmentForm(id, created, form, &globals.Chunk{Content: err.Error()}, buffer, true, err)
-			close(partial)
+			sendPartial(ctx, partial, getStreamTranshipmentForm(id, created, form, &globals.Chunk{Content: err.Error()}, buffer, true, err))
 			return
 		}
 
-		partial <- getStreamTranshipmentForm(id, created, form, &globals.Chunk{Content: ""}, buffer, true, nil)
+		sendPartial(ctx, partial, getStreamTranshipmentForm(id, created, form, &globals.Chunk{Content: ""}, buffer, true, nil))
+		for i := 1; i < utils.GetPtrVal(form.N, 1); i++ {
+			sendPartial(ctx, partial, getStreamTranshipmentForm(id, created, form, &globals.Chunk{Content: "", Index: i}, buffer, true, nil))
+		}
+
+		if form.StreamOptions != nil && form.StreamOptions.IncludeUsage {
+			sendPartial(ctx, partial, getStreamUsageForm(id, created, form, buffer))
+		}
 
 		if !hit {
 			CollectQuota(c, user, buffer, plan, err)
 		}
-
-		close(partial)
-		return
-	}()
+	})
 
 	c.Stream(func(w io.Writer) bool {
-		if resp, ok := <-partial; ok {
+		if resp, ok := receive(relay, c, partial); ok {
 			if resp.Error != nil {
-				sendErrorResponse(c, resp.Error)
+				sendStreamErrorResponse(c, resp.Error)
 				return false
 			}
 
@@ -36,7 +36,7 @@ func NativeChatHandler(c *gin.Context, user *auth.User, model string, message []
 
 	buffer := utils.NewBuffer(model, segment, channel.ChargeInstance.GetCharge(model))
 	hit, err := channel.NewChatRequestWithCache(
-		cache, buffer,
+		c.Request.Context(), cache, buffer,
 		auth.GetGroup(db, user),
 		adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
 			Model:   model,
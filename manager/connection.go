@@ -4,10 +4,12 @@ import (
 	"chat/globals"
 	"chat/manager/conversation"
 	"chat/utils"
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
+	"sync"
 )
 
 const (
@@ -27,6 +29,9 @@ type Connection struct {
 	stack Stack
 	auth  bool
 	hash  string
+
+	cancel context.CancelFunc // cancels the running chat task
+	mutex  sync.Mutex
 }
 
 func NewConnection(conn *utils.WebSocket, auth bool, hash string, bufferSize int) *Connection {
@@ -66,11 +71,37 @@ func (c *Connection) ReadWorker() {
 		}
 
 		c.Write(form)
+		if form.Type == StopType || form.Type == RemoveType {
+			// abort the upstream of the running chat task immediately
+			c.Cancel()
+		}
 	}
 
+	c.Cancel()
 	c.Stop()
 }
 
+// WithCancel creates the context of the chat task, which is canceled once the client stops or disconnects
+func (c *Connection) WithCancel() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.GetCtx().Request.Context())
+
+	c.mutex.Lock()
+	c.cancel = cancel
+	c.mutex.Unlock()
+
+	return ctx, cancel
+}
+
+func (c *Connection) Cancel() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+}
+
 func (c *Connection) Write(data *conversation.FormMessage) {
 	if len(c.stack) == cap(c.stack) {
 		c.Skip()
@@ -14,7 +14,7 @@ func (c *Conversation) SaveConversation(db *sql.DB) bool {
 		return true
 	}
 
-	data := utils.ToJson(c.GetMessage())
+	data := utils.ToJson(globals.ToStoredMessages(c.GetMessage()))
 	query := `
 		INSERT INTO conversation (user_id, conversation_id, conversation_name, data, model, task_id) VALUES (?, ?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE conversation_name = VALUES(conversation_name), data = VALUES(data), task_id = VALUES(task_id)
@@ -81,7 +81,8 @@ func LoadConversation(db *sql.DB, userId int64, conversationId int64) *Conversat
 		return nil
 	}
 
-	conversation.Message, err = utils.Unmarshal[[]globals.Message]([]byte(data))
+	messages, err := utils.Unmarshal[[]globals.StoredMessage]([]byte(data))
+	conversation.Message = globals.FromStoredMessages(messages)
 	if err != nil {
 		return nil
 	}
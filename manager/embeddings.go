@@ -0,0 +1,139 @@
+package manager
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CollectInputQuota collects the quota of the non-stream requests which may have no text output (e.g. embeddings, audio)
+func CollectInputQuota(c *gin.Context, user *auth.User, buffer *utils.Buffer, uncountable bool) {
+	db := utils.GetDBFromContext(c)
+	quota := buffer.GetRecordQuota()
+
+	if user == nil || quota <= 0 || uncountable {
+		return
+	}
+
+	user.UseQuota(db, quota, buffer.GetModel())
+}
+
+func getEmbeddingMessages(props *adaptercommon.EmbeddingProps) []globals.Message {
+	return utils.Each(props.GetInputs(), func(input string) globals.Message {
+		return globals.Message{
+			Role:    globals.User,
+			Content: input,
+		}
+	})
+}
+
+func isEmptyEmbeddingInput(input interface{}) bool {
+	switch v := input.(type) {
+	case string:
+		return len(strings.TrimSpace(v)) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+
+	return input == nil
+}
+
+func EmbeddingsRelayAPI(c *gin.Context) {
+	if globals.CloseRelay {
+		abortWithErrorResponse(c, globals.NewPermissionError("relay api is denied of access"))
+		return
+	}
+
+	username := utils.GetUserFromContext(c)
+	if username == "" {
+		abortWithErrorResponse(c, globals.NewAuthenticationError("access denied for invalid api key"))
+		return
+	}
+
+	if utils.GetAgentFromContext(c) != "api" {
+		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "authentication_error")
+		return
+	}
+
+	var form RelayEmbeddingForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	if isEmptyEmbeddingInput(form.Input) {
+		sendErrorResponse(c, globals.NewInvalidRequestError("input", "input is required"))
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+
+	form.Model = strings.TrimSuffix(form.Model, "-official")
+
+	props := adaptercommon.CreateEmbeddingProps(&adaptercommon.EmbeddingProps{
+		Model:          form.Model,
+		Input:          form.Input,
+		EncodingFormat: form.EncodingFormat,
+		Dimensions:     form.Dimensions,
+	})
+	props.User = auth.GetUsernameString(db, user)
+
+	messages := getEmbeddingMessages(props)
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
+	buffer.SetTokenName(globals.ApiTokenType)
+	if tokens := props.CountTokenInputs(); tokens > 0 {
+		// the token array inputs are not tokenized, they are counted as the fallback if the upstream reports no usage
+		buffer.SetInputUsage(utils.Multi(len(messages) > 0, buffer.CountInputToken()+tokens, tokens))
+	}
+
+	resp, err := channel.NewEmbeddingRequest(auth.GetGroup(db, user), props)
+	if resp != nil {
+		buffer.SetInputUsage(resp.InputTokens)
+	}
+
+	admin.AnalyseRequest(form.Model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+		globals.Warn(fmt.Sprintf("error from embedding request api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+
+		sendErrorResponse(c, err)
+		return
+	}
+
+	CollectInputQuota(c, user, buffer, plan)
+
+	c.JSON(http.StatusOK, RelayEmbeddingResponse{
+		Object: "list",
+		Data: utils.Each(resp.Data, func(item adaptercommon.EmbeddingData) RelayEmbeddingData {
+			return RelayEmbeddingData{
+				Object:    "embedding",
+				Index:     item.Index,
+				Embedding: item.Embedding,
+			}
+		}),
+		Model: form.Model,
+		Usage: RelayEmbeddingUsage{
+			PromptTokens: buffer.CountInputToken(),
+			TotalTokens:  buffer.CountInputToken(),
+		},
+		Quota: utils.ToPtr(buffer.GetQuota()),
+	})
+}
@@ -0,0 +1,334 @@
+package manager
+
+import (
+	"chat/auth"
+	"chat/globals"
+	"chat/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+
+	maxRelayFileSize     = 200 * 1024 * 1024 // 200 MiB (same as the openai batch input limit)
+	defaultFileListLimit = 100
+	maxFileListLimit     = 10000
+	relayFileStorageDir  = "storage/files"
+	relayFileContentType = "application/jsonl"
+)
+
+func getRelayFilePath(id string) string {
+	return fmt.Sprintf("%s/%s", relayFileStorageDir, id)
+}
+
+func getFileIdParam(c *gin.Context) string {
+	id := strings.TrimSpace(c.Param("id"))
+	if id == "" {
+		abortWithErrorResponse(c, globals.NewInvalidRequestError("id", "file id is required"))
+	}
+
+	return id
+}
+
+// getListLimit returns the `limit` query param of the list apis
+func getListLimit(c *gin.Context, fallback int, max int) int {
+	if value := c.Query("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return utils.Multi(n > max, max, n)
+		}
+	}
+
+	return fallback
+}
+
+func newFileNotFoundError(id string) *globals.RelayError {
+	return globals.NewRelayError(http.StatusNotFound, "invalid_request_error", "file_not_found", fmt.Sprintf("no such file object: %s", id)).WithParam("id")
+}
+
+func newRelayInternalError(message string) *globals.RelayError {
+	return globals.NewRelayError(http.StatusInternalServerError, "chatnio_api_error", "internal_error", message)
+}
+
+func newRelayFileId(seed string) string {
+	return fmt.Sprintf("file-%s", utils.Md5Encrypt(seed+time.Now().String()))
+}
+
+func saveRelayFile(db *sql.DB, userId int64, file *RelayFile) error {
+	_, err := globals.ExecDb(db, `
+		INSERT INTO relay_file (user_id, file_id, purpose, data) VALUES (?, ?, ?, ?)
+	`, userId, file.Id, file.Purpose, utils.Marshal(file))
+	return err
+}
+
+// createRelayFile moves the local file to the file storage and stores it as the file object of the user
+func createRelayFile(db *sql.DB, userId int64, source string, filename string, purpose string) (*RelayFile, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &RelayFile{
+		Id:        newRelayFileId(source),
+		Object:    "file",
+		Bytes:     info.Size(),
+		CreatedAt: time.Now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+
+	utils.CreateFolder(relayFileStorageDir)
+	if err := os.Rename(source, getRelayFilePath(file.Id)); err != nil {
+		return nil, err
+	}
+
+	if err := saveRelayFile(db, userId, file); err != nil {
+		_ = os.Remove(getRelayFilePath(file.Id))
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func getRelayFile(db *sql.DB, userId int64, id string) (*RelayFile, error) {
+	var data string
+	if err := globals.QueryRowDb(db, `
+		SELECT data FROM relay_file WHERE user_id = ? AND file_id = ?
+	`, userId, id).Scan(&data); err != nil {
+		return nil, newFileNotFoundError(id)
+	}
+
+	file, err := utils.UnmarshalString[RelayFile](data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse file object for file id %s", id)
+	}
+
+	return &file, nil
+}
+
+// getRelayFiles returns the files of the user after the cursor and whether there are more files
+func getRelayFiles(db *sql.DB, userId int64, purpose string, after string, limit int, asc bool) ([]RelayFile, bool, error) {
+	var cursor int64
+	if after != "" {
+		if err := globals.QueryRowDb(db, `
+			SELECT id FROM relay_file WHERE user_id = ? AND file_id = ?
+		`, userId, after).Scan(&cursor); err != nil {
+			return nil, false, newFileNotFoundError(after).WithParam("after")
+		}
+	}
+
+	rows, err := globals.QueryDb(db, fmt.Sprintf(`
+		SELECT data FROM relay_file
+		WHERE user_id = ? AND (? = '' OR purpose = ?) AND (? = 0 OR id %s ?)
+		ORDER BY id %s LIMIT ?
+	`, utils.Multi(asc, ">", "<"), utils.Multi(asc, "ASC", "DESC")), userId, purpose, purpose, cursor, cursor, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	files := make([]RelayFile, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, false, err
+		}
+
+		if file, err := utils.UnmarshalString[RelayFile](data); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) > limit {
+		return files[:limit], true, nil
+	}
+	return files, false, nil
+}
+
+func deleteRelayFile(db *sql.DB, userId int64, id string) error {
+	if _, err := globals.ExecDb(db, `
+		DELETE FROM relay_file WHERE user_id = ? AND file_id = ?
+	`, userId, id); err != nil {
+		return err
+	}
+
+	if err := os.Remove(getRelayFilePath(id)); err != nil && !os.IsNotExist(err) {
+		globals.Warn(fmt.Sprintf("[file] failed to remove file %s: %s", id, err.Error()))
+	}
+	return nil
+}
+
+func FilesUploadRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	purpose := strings.TrimSpace(c.PostForm("purpose"))
+	if purpose != FilePurposeBatch {
+		sendErrorResponse(c, globals.NewInvalidRequestError("purpose", "unsupported purpose `%s`, only `%s` is supported", purpose, FilePurposeBatch))
+		return
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		sendErrorResponse(c, globals.NewInvalidRequestError("file", "file is required"))
+		return
+	}
+
+	if path.Ext(header.Filename) != ".jsonl" {
+		sendErrorResponse(c, globals.NewInvalidRequestError("file", "the batch input file must be a .jsonl file"))
+		return
+	}
+
+	if header.Size > maxRelayFileSize {
+		sendErrorResponse(c, globals.NewInvalidRequestError("file", "file size exceeds the limit of %d bytes", maxRelayFileSize))
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+
+	file := &RelayFile{
+		Id:        newRelayFileId(username + header.Filename),
+		Object:    "file",
+		Bytes:     header.Size,
+		CreatedAt: time.Now().Unix(),
+		Filename:  header.Filename,
+		Purpose:   purpose,
+	}
+
+	utils.CreateFolder(relayFileStorageDir)
+	if err := c.SaveUploadedFile(header, getRelayFilePath(file.Id)); err != nil {
+		globals.Warn(fmt.Sprintf("[file] failed to save uploaded file: %s", err.Error()))
+		sendErrorResponse(c, newRelayInternalError("failed to save the uploaded file"))
+		return
+	}
+
+	if err := saveRelayFile(db, user.GetID(db), file); err != nil {
+		_ = os.Remove(getRelayFilePath(file.Id))
+		globals.Warn(fmt.Sprintf("[file] failed to store file object %s: %s", file.Id, err.Error()))
+		sendErrorResponse(c, newRelayInternalError("failed to store the file object"))
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+func FilesListRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+
+	files, more, err := getRelayFiles(
+		db, user.GetID(db), c.Query("purpose"), c.Query("after"),
+		getListLimit(c, defaultFileListLimit, maxFileListLimit), c.Query("order") == "asc",
+	)
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	list := RelayFileList{
+		Object:  "list",
+		Data:    files,
+		HasMore: more,
+	}
+	if len(files) > 0 {
+		list.FirstId = &files[0].Id
+		list.LastId = &files[len(files)-1].Id
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func FilesRetrieveRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getFileIdParam(c)
+	if id == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+
+	file, err := getRelayFile(db, user.GetID(db), id)
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	c.JSON(http.StatusOK, file)
+}
+
+func FilesContentRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getFileIdParam(c)
+	if id == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+
+	if _, err := getRelayFile(db, user.GetID(db), id); err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	c.Header("Content-Type", relayFileContentType)
+	c.File(getRelayFilePath(id))
+}
+
+func FilesDeleteRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getFileIdParam(c)
+	if id == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+	userId := user.GetID(db)
+
+	if _, err := getRelayFile(db, userId, id); err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	if err := deleteRelayFile(db, userId, id); err != nil {
+		sendErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RelayFileDeleted{
+		Id:      id,
+		Object:  "file",
+		Deleted: true,
+	})
+}
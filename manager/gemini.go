@@ -0,0 +1,466 @@
+package manager
+
+import (
+	"chat/adapter"
+	adaptercommon "chat/adapter/common"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	GeminiModelType    = "model"
+	GeminiFinishStop   = "STOP"
+	GeminiActionChat   = "generateContent"
+	GeminiActionStream = "streamGenerateContent"
+)
+
+// geminiErrorStatus is the google rpc status by the http status
+var geminiErrorStatus = map[int]string{
+	http.StatusBadRequest:      "INVALID_ARGUMENT",
+	http.StatusUnauthorized:    "UNAUTHENTICATED",
+	http.StatusPaymentRequired: "RESOURCE_EXHAUSTED",
+	http.StatusForbidden:       "PERMISSION_DENIED",
+	http.StatusNotFound:        "NOT_FOUND",
+	http.StatusTooManyRequests: "RESOURCE_EXHAUSTED",
+	http.StatusGatewayTimeout:  "DEADLINE_EXCEEDED",
+}
+
+func sendGeminiErrorResponse(c *gin.Context, err error, status ...string) {
+	relayErr := getRelayError(err, status...)
+	errStatus, ok := geminiErrorStatus[relayErr.Status]
+	if !ok {
+		errStatus = "UNAVAILABLE"
+	}
+
+	setRelayErrorHeader(c, relayErr)
+	c.JSON(relayErr.Status, GeminiErrorResponse{
+		Error: GeminiError{
+			Code:    relayErr.Status,
+			Message: relayErr.Message,
+			Status:  errStatus,
+		},
+	})
+}
+
+func abortWithGeminiErrorResponse(c *gin.Context, err error, status ...string) {
+	sendGeminiErrorResponse(c, err, status...)
+	c.Abort()
+}
+
+// getGeminiAction splits the gemini path param (e.g. `gemini-2.0-flash:generateContent`) to the model and the action
+func getGeminiAction(param string) (string, string) {
+	param = strings.TrimPrefix(param, "/")
+	idx := strings.LastIndex(param, ":")
+	if idx == -1 {
+		return param, ""
+	}
+
+	return param[:idx], param[idx+1:]
+}
+
+func getGeminiPartsText(parts []GeminiPart) string {
+	var result string
+	for _, part := range parts {
+		if part.Text != nil {
+			result += *part.Text
+		}
+
+		inline := part.InlineData
+		if inline == nil {
+			inline = part.InlineDataSnake
+		}
+		if inline != nil {
+			result += fmt.Sprintf(" data:%s;base64,%s ", inline.MimeType, inline.Data)
+		}
+
+		if part.FileData != nil {
+			result += fmt.Sprintf(" %s ", part.FileData.FileUri)
+		}
+	}
+
+	return result
+}
+
+// transformGeminiMessages converts the gemini system instruction and contents to the chat messages
+func transformGeminiMessages(form RelayGeminiForm) []globals.Message {
+	var messages []globals.Message
+	if form.SystemInstruction != nil {
+		if system := getGeminiPartsText(form.SystemInstruction.Parts); len(system) > 0 {
+			messages = append(messages, globals.Message{
+				Role:    globals.System,
+				Content: system,
+			})
+		}
+	}
+
+	// gemini function calls have no id, the function responses are matched by the function name
+	pending := map[string][]string{}
+	for i, content := range form.Contents {
+		var calls globals.ToolCalls
+		for j, part := range content.Parts {
+			if part.FunctionCall == nil {
+				continue
+			}
+
+			id := fmt.Sprintf("call_%d_%d", i, j)
+			pending[part.FunctionCall.Name] = append(pending[part.FunctionCall.Name], id)
+			calls = append(calls, globals.ToolCall{
+				Type: "function",
+				Id:   id,
+				Function: globals.ToolCallFunction{
+					Name:      part.FunctionCall.Name,
+					Arguments: utils.Marshal(utils.Multi[interface{}](part.FunctionCall.Args != nil, part.FunctionCall.Args, map[string]interface{}{})),
+				},
+			})
+		}
+
+		var results []globals.Message
+		for _, part := range content.Parts {
+			if part.FunctionResponse == nil {
+				continue
+			}
+
+			var id string
+			if queue := pending[part.FunctionResponse.Name]; len(queue) > 0 {
+				id, pending[part.FunctionResponse.Name] = queue[0], queue[1:]
+			}
+
+			results = append(results, globals.Message{
+				Role:       globals.Tool,
+				Content:    utils.Marshal(part.FunctionResponse.Response),
+				Name:       utils.ToPtr(part.FunctionResponse.Name),
+				ToolCallId: utils.ToPtr(id),
+			})
+		}
+		messages = append(messages, results...)
+
+		text := getGeminiPartsText(content.Parts)
+		if len(text) == 0 && len(calls) == 0 {
+			continue
+		}
+
+		messages = append(messages, globals.Message{
+			Role:      utils.Multi(content.Role == GeminiModelType, globals.Assistant, globals.User),
+			Content:   text,
+			ToolCalls: utils.Multi[*globals.ToolCalls](len(calls) > 0, &calls, nil),
+		})
+	}
+
+	return messages
+}
+
+func transformGeminiTools(form RelayGeminiForm) *globals.FunctionTools {
+	var tools globals.FunctionTools
+	for _, tool := range form.Tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			parameters := utils.MapToStruct[globals.ToolParameters](declaration.Parameters)
+			tools = append(tools, globals.ToolObject{
+				Type: "function",
+				Function: globals.ToolFunction{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  utils.GetPtrVal(parameters, globals.ToolParameters{Type: "object"}),
+				},
+			})
+		}
+	}
+
+	if len(tools) == 0 {
+		return nil
+	}
+
+	return &tools
+}
+
+func transformGeminiToolChoice(form RelayGeminiForm) *interface{} {
+	if form.ToolConfig == nil || form.ToolConfig.FunctionCallingConfig == nil {
+		return nil
+	}
+
+	config := form.ToolConfig.FunctionCallingConfig
+
+	var choice interface{}
+	switch strings.ToUpper(config.Mode) {
+	case "ANY":
+		if len(config.AllowedFunctionNames) == 1 {
+			choice = map[string]interface{}{
+				"type": "function",
+				"function": map[string]string{
+					"name": config.AllowedFunctionNames[0],
+				},
+			}
+		} else {
+			choice = "required"
+		}
+	case "NONE":
+		choice = "none"
+	default:
+		choice = "auto"
+	}
+
+	return &choice
+}
+
+func getGeminiProps(model string, form RelayGeminiForm, messages []globals.Message, buffer *utils.Buffer, user *auth.User, c *gin.Context) *adaptercommon.ChatProps {
+	config := utils.GetPtrVal(form.GenerationConfig, GeminiGenerationConfig{})
+
+	return adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
+		Model:            model,
+		Message:          messages,
+		MaxTokens:        config.MaxOutputTokens,
+		PresencePenalty:  config.PresencePenalty,
+		FrequencyPenalty: config.FrequencyPenalty,
+		Temperature:      config.Temperature,
+		TopP:             config.TopP,
+		TopK:             config.TopK,
+		Stop:             config.StopSequences,
+		Seed:             config.Seed,
+		Tools:            transformGeminiTools(form),
+		ToolChoice:       transformGeminiToolChoice(form),
+		User:             user.Username,
+		Ip:               getClientIP(c),
+	}, buffer)
+}
+
+// getGeminiParts converts the chat chunk (text and tool calls) to the gemini parts
+func getGeminiParts(content string, tools *globals.ToolCalls) []GeminiPart {
+	parts := make([]GeminiPart, 0)
+	if len(content) > 0 {
+		parts = append(parts, GeminiPart{Text: utils.ToPtr(content)})
+	}
+
+	if tools != nil {
+		for _, tool := range *tools {
+			parts = append(parts, GeminiPart{
+				FunctionCall: &GeminiFunctionCall{
+					Name: tool.Function.Name,
+					Args: getMessagesToolInput(tool.Function.Arguments),
+				},
+			})
+		}
+	}
+
+	return parts
+}
+
+func getGeminiUsage(buffer *utils.Buffer) *GeminiUsageMetadata {
+	output := buffer.CountOutputToken(false)
+	return &GeminiUsageMetadata{
+		PromptTokenCount:     buffer.CountInputToken(),
+		CandidatesTokenCount: output,
+		TotalTokenCount:      buffer.CountInputToken() + output,
+	}
+}
+
+func GeminiRelayAPI(c *gin.Context) {
+	if globals.CloseRelay {
+		abortWithGeminiErrorResponse(c, fmt.Errorf("relay api is denied of access"), "PERMISSION_DENIED")
+		return
+	}
+
+	username := utils.GetUserFromContext(c)
+	if username == "" {
+		abortWithGeminiErrorResponse(c, fmt.Errorf("access denied for invalid api key"), "UNAUTHENTICATED")
+		return
+	}
+
+	if utils.GetAgentFromContext(c) != "api" {
+		abortWithGeminiErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "UNAUTHENTICATED")
+		return
+	}
+
+	model, action := getGeminiAction(c.Param("model"))
+	if model == "" || (action != GeminiActionChat && action != GeminiActionStream) {
+		abortWithGeminiErrorResponse(c, fmt.Errorf("unsupported action: %s", c.Param("model")), "NOT_FOUND")
+		return
+	}
+
+	var form RelayGeminiForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithGeminiErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "INVALID_ARGUMENT")
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+
+	model = strings.TrimSuffix(model, "-official")
+	messages := transformGeminiMessages(form)
+
+	if err := checkModeration(db, user, model, messages, ModerationSourceRelay); err != nil {
+		sendGeminiErrorResponse(c, err, "INVALID_ARGUMENT")
+		return
+	}
+
+	check, plan := checkEnableState(db, cache, user, model, messages)
+	if check != nil {
+		sendGeminiErrorResponse(c, check, "RESOURCE_EXHAUSTED")
+		return
+	}
+
+	if action == GeminiActionStream && c.Query("alt") == "sse" {
+		sendStreamGeminiResponse(c, model, form, messages, user, plan)
+	} else {
+		sendGeminiResponse(c, model, form, messages, user, plan, action == GeminiActionStream)
+	}
+}
+
+func sendGeminiResponse(c *gin.Context, model string, form RelayGeminiForm, messages []globals.Message, user *auth.User, plan bool, array bool) {
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	buffer := utils.NewBuffer(model, messages, channel.ChargeInstance.GetCharge(model))
+	hit, err := channel.NewChatRequestWithCache(c.Request.Context(), cache, buffer, auth.GetGroup(db, user), getGeminiProps(model, form, messages, buffer, user, c), func(data *globals.Chunk) error {
+		buffer.WriteChunk(data)
+		return nil
+	})
+
+	admin.AnalyseRequest(model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, model)
+		globals.Warn(fmt.Sprintf("error from gemini request api: %s (instance: %s, client: %s)", err, model, c.ClientIP()))
+
+		sendGeminiErrorResponse(c, err)
+		return
+	}
+
+	if !hit {
+		CollectQuota(c, user, buffer, plan, err)
+	}
+
+	resp := RelayGeminiResponse{
+		Candidates: []GeminiCandidate{
+			{
+				Content: GeminiContent{
+					Role:  GeminiModelType,
+					Parts: getGeminiParts(buffer.Read(), buffer.GetToolCalls()),
+				},
+				FinishReason: GeminiFinishStop,
+			},
+		},
+		UsageMetadata: getGeminiUsage(buffer),
+		ModelVersion:  model,
+		Quota:         utils.ToPtr(buffer.GetQuota()),
+	}
+
+	if array {
+		// non-sse stream requests expect the json array of the responses
+		c.JSON(http.StatusOK, []RelayGeminiResponse{resp})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func sendStreamGeminiResponse(c *gin.Context, model string, form RelayGeminiForm, messages []globals.Message, user *auth.User, plan bool) {
+	partial := make(chan RelayGeminiResponse)
+	failed := make(chan error, 1)
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	group := auth.GetGroup(db, user)
+	charge := channel.ChargeInstance.GetCharge(model)
+
+	relay := newRelayStream(c)
+	defer relay.wait()
+
+	relay.run(func(ctx context.Context) {
+		defer close(partial)
+
+		buffer := utils.NewBuffer(model, messages, charge)
+		hit, err := channel.NewChatRequestWithCache(
+			ctx, cache, buffer, group, getGeminiProps(model, form, messages, buffer, user, c),
+			func(data *globals.Chunk) error {
+				buffer.WriteChunk(data)
+
+				if !data.IsEmpty() && !sendPartial(ctx, partial, RelayGeminiResponse{
+					Candidates: []GeminiCandidate{
+						{
+							Content: GeminiContent{
+								Role:  GeminiModelType,
+								Parts: getGeminiParts(data.Content, nil),
+							},
+						},
+					},
+					ModelVersion: model,
+				}) {
+					return ctx.Err()
+				}
+				return nil
+			},
+		)
+
+		admin.AnalyseRequest(model, buffer, err)
+		if adapter.IsCanceledError(err) {
+			// the client is gone, only the produced tokens are billed
+			CollectQuota(c, user, buffer, plan, nil)
+			return
+		}
+
+		if err != nil {
+			if adapter.IsPartialError(err) {
+				// the stream is failed halfway without retrying, the content delivered to the client is billed
+				CollectQuota(c, user, buffer, plan, nil)
+			} else {
+				auth.RevertSubscriptionUsage(db, cache, user, model)
+			}
+			globals.Warn(fmt.Sprintf("error from gemini request api: %s (instance: %s, client: %s)", err.Error(), model, c.ClientIP()))
+			failed <- err
+			return
+		}
+
+		// gemini function calls are sent as the complete parts, so the tool calls are sent with the finish chunk
+		sendPartial(ctx, partial, RelayGeminiResponse{
+			Candidates: []GeminiCandidate{
+				{
+					Content: GeminiContent{
+						Role:  GeminiModelType,
+						Parts: getGeminiParts("", buffer.GetToolCalls()),
+					},
+					FinishReason: GeminiFinishStop,
+				},
+			},
+			UsageMetadata: getGeminiUsage(buffer),
+			ModelVersion:  model,
+			Quota:         utils.ToPtr(buffer.GetQuota()),
+		})
+
+		if !hit {
+			CollectQuota(c, user, buffer, plan, err)
+		}
+	})
+
+	c.Stream(func(w io.Writer) bool {
+		if resp, ok := receive(relay, c, partial); ok {
+			c.Render(-1, utils.NewEvent(resp))
+			return true
+		}
+
+		select {
+		case err := <-failed:
+			c.Render(-1, utils.NewEvent(GeminiErrorResponse{
+				Error: GeminiError{
+					Code:    http.StatusServiceUnavailable,
+					Message: err.Error(),
+					Status:  "UNAVAILABLE",
+				},
+			}))
+		default:
+		}
+
+		return false
+	})
+}
@@ -16,19 +16,8 @@ import (
 )
 
 func ImagesRelayAPI(c *gin.Context) {
-	if globals.CloseRelay {
-		abortWithErrorResponse(c, fmt.Errorf("relay api is denied of access"), "access_denied_error")
-		return
-	}
-
-	username := utils.GetUserFromContext(c)
+	username := checkRelayState(c)
 	if username == "" {
-		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid api key"), "authentication_error")
-		return
-	}
-
-	if utils.GetAgentFromContext(c) != "api" {
-		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "authentication_error")
 		return
 	}
 
@@ -40,96 +29,170 @@ func ImagesRelayAPI(c *gin.Context) {
 
 	prompt := strings.TrimSpace(form.Prompt)
 	if prompt == "" {
-		sendErrorResponse(c, fmt.Errorf("prompt is required"), "invalid_request_error")
+		sendErrorResponse(c, globals.NewInvalidRequestError("prompt", "prompt is required"))
+		return
 	}
 
-	db := utils.GetDBFromContext(c)
-	user := &auth.User{
-		Username: username,
-	}
+	createRelayImageObject(c, username, adaptercommon.CreateImageProps(&adaptercommon.ImageProps{
+		Model:          strings.TrimSuffix(form.Model, "-official"),
+		Prompt:         prompt,
+		N:              form.N,
+		Size:           form.Size,
+		Quality:        form.Quality,
+		Style:          form.Style,
+		ResponseFormat: form.ResponseFormat,
+	}))
+}
 
-	created := time.Now().Unix()
+// getImageFormProps returns the image props of the multipart edit / variation request
+func getImageFormProps(c *gin.Context) (*adaptercommon.ImageProps, error) {
+	header, err := c.FormFile("image")
+	if err != nil {
+		return nil, globals.NewInvalidRequestError("image", "invalid request body: %s", err.Error())
+	}
 
-	if strings.HasSuffix(form.Model, "-official") {
-		form.Model = strings.TrimSuffix(form.Model, "-official")
+	image, name, err := utils.ReadFormFile(header)
+	if err != nil || len(image) == 0 {
+		return nil, globals.NewInvalidRequestError("image", "cannot read the image file")
 	}
 
-	check := auth.CanEnableModel(db, user, form.Model, []globals.Message{})
-	if check != nil {
-		sendErrorResponse(c, check, "quota_exceeded_error")
-		return
+	props := adaptercommon.CreateImageProps(&adaptercommon.ImageProps{
+		Model:          strings.TrimSuffix(utils.GetPtrVal(getPostFormPtr(c, "model"), globals.Dalle2), "-official"),
+		Size:           getPostFormPtr(c, "size"),
+		Quality:        getPostFormPtr(c, "quality"),
+		ResponseFormat: getPostFormPtr(c, "response_format"),
+		Image:          image,
+		ImageName:      name,
+	})
+
+	if n := getPostFormPtr(c, "n"); n != nil {
+		props.N = utils.ToPtr(utils.ParseInt(*n))
 	}
 
-	createRelayImageObject(c, form, prompt, created, user, supportRelayPlan())
+	return props, nil
 }
 
-func getImageProps(form RelayImageForm, messages []globals.Message, buffer *utils.Buffer) *adaptercommon.ChatProps {
-	return adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
-		Model:     form.Model,
-		Message:   messages,
-		MaxTokens: utils.ToPtr(-1),
-	}, buffer)
-}
+func ImagesEditsRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
 
-func getImageDataFromBuffer(buffer *utils.Buffer) (string, string) {
-	content := buffer.Read()
+	props, err := getImageFormProps(c)
+	if err != nil {
+		abortWithErrorResponse(c, err, "invalid_request_error")
+		return
+	}
 
-	urls := utils.ExtractImagesFromMarkdown(content)
-	if len(urls) > 0 {
-		return urls[len(urls)-1], ""
+	props.Prompt = utils.GetPtrVal(getPostFormPtr(c, "prompt"), "")
+	if props.Prompt == "" {
+		sendErrorResponse(c, globals.NewInvalidRequestError("prompt", "prompt is required"))
+		return
 	}
 
-	base64Data := utils.ExtractBase64FromMarkdown(content)
-	if len(base64Data) > 0 {
-		return "", base64Data[len(base64Data)-1]
+	if header, err := c.FormFile("mask"); err == nil {
+		mask, name, err := utils.ReadFormFile(header)
+		if err != nil {
+			abortWithErrorResponse(c, globals.NewInvalidRequestError("mask", "cannot read the mask file"))
+			return
+		}
+
+		props.Mask = mask
+		props.MaskName = name
 	}
 
-	return "", ""
+	createRelayImageObject(c, username, props)
 }
 
-func createRelayImageObject(c *gin.Context, form RelayImageForm, prompt string, created int64, user *auth.User, plan bool) {
-	db := utils.GetDBFromContext(c)
-	cache := utils.GetCacheFromContext(c)
+func ImagesVariationsRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
 
-	messages := []globals.Message{
-		{
-			Role:    globals.User,
-			Content: prompt,
-		},
+	props, err := getImageFormProps(c)
+	if err != nil {
+		abortWithErrorResponse(c, err, "invalid_request_error")
+		return
 	}
 
-	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
-	hit, err := channel.NewChatRequestWithCache(cache, buffer, auth.GetGroup(db, user), getImageProps(form, messages, buffer), func(data *globals.Chunk) error {
-		buffer.WriteChunk(data)
-		return nil
+	createRelayImageObject(c, username, props)
+}
+
+// getRelayImageData converts the generated images to the requested response format (url or b64_json),
+// the images are returned as the upstream returns if the response format is not specified
+func getRelayImageData(images []adaptercommon.ImageData, format string) []RelayImageData {
+	return utils.Each(images, func(image adaptercommon.ImageData) RelayImageData {
+		data := RelayImageData{
+			Url:           image.Url,
+			B64Json:       image.B64Json,
+			RevisedPrompt: image.RevisedPrompt,
+		}
+
+		switch format {
+		case "b64_json":
+			if data.B64Json == "" && data.Url != "" {
+				raw, err := utils.ConvertToBase64(data.Url)
+				if err != nil {
+					globals.Warn(fmt.Sprintf("cannot convert image to base64: %s", err.Error()))
+					return data
+				}
+
+				data.Url, data.B64Json = "", raw
+			}
+		case "url":
+			if data.Url == "" && data.B64Json != "" {
+				data.Url, data.B64Json = utils.StoreBase64Image(data.B64Json), ""
+			}
+		}
+
+		if data.Url != "" {
+			data.Url = utils.StoreImage(data.Url)
+		}
+
+		return data
 	})
+}
 
-	admin.AnalyseRequest(form.Model, buffer, err)
-	if err != nil {
-		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
-		globals.Warn(fmt.Sprintf("error from chat request api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+func createRelayImageObject(c *gin.Context, username string, props *adaptercommon.ImageProps) {
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
 
-		sendErrorResponse(c, err)
+	created := time.Now().Unix()
+	props.User = auth.GetUsernameString(db, user)
+
+	messages := []globals.Message{{Role: globals.User, Content: props.Prompt}}
+	check, plan := checkEnableState(db, cache, user, props.Model, messages)
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
 		return
 	}
 
-	if !hit {
-		CollectQuota(c, user, buffer, plan, err)
+	buffer := utils.NewBuffer(props.Model, messages, channel.ChargeInstance.GetCharge(props.Model))
+	buffer.SetTokenName(globals.ApiTokenType)
+	props.Buffer = buffer
+
+	resp, err := channel.NewImageRequest(auth.GetGroup(db, user), props)
+	if resp != nil {
+		buffer.AddImageUsage(len(resp.Images))
 	}
 
-	url, b64Json := getImageDataFromBuffer(buffer)
-	if url == "" && b64Json == "" {
-		sendErrorResponse(c, fmt.Errorf("no image generated"), "image_generation_error")
+	admin.AnalyseRequest(props.Model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, props.Model)
+		globals.Warn(fmt.Sprintf("error from image request api: %s (instance: %s, client: %s)", err, props.Model, c.ClientIP()))
+
+		sendErrorResponse(c, err)
 		return
 	}
 
+	CollectInputQuota(c, user, buffer, plan)
+
 	c.JSON(http.StatusOK, RelayImageResponse{
 		Created: created,
-		Data: []RelayImageData{
-			{
-				Url:     url,
-				B64Json: b64Json,
-			},
-		},
+		Data:    getRelayImageData(resp.Images, utils.GetPtrVal(props.ResponseFormat, "")),
 	})
 }
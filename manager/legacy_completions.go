@@ -0,0 +1,308 @@
+package manager
+
+import (
+	"chat/adapter"
+	adaptercommon "chat/adapter/common"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompletionsRelayAPI is the legacy `/v1/completions` relay api,
+// the prompt is sent as the raw prompt to the completion-type models and as a user message to the chat models
+func CompletionsRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	var form RelayCompletionForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	prompts := getCompletionPrompts(form.Prompt)
+	if len(prompts) == 0 {
+		sendErrorResponse(c, globals.NewInvalidRequestError("prompt", "prompt must be a string or an array of strings"))
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+	id := utils.Md5Encrypt(username + form.Model + time.Now().String())
+	created := time.Now().Unix()
+
+	if strings.HasSuffix(form.Model, "-official") {
+		form.Model = strings.TrimSuffix(form.Model, "-official")
+		form.Official = true
+	}
+
+	messages := getCompletionMessages(prompts...)
+	if err := checkModeration(db, user, form.Model, messages, ModerationSourceRelay); err != nil {
+		sendErrorResponse(c, err, "moderation_error")
+		return
+	}
+
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	if form.Stream {
+		sendStreamCompletionResponse(c, form, prompts, id, created, user, plan)
+	} else {
+		sendCompletionResponse(c, form, prompts, id, created, user, plan)
+	}
+}
+
+// getCompletionPrompts converts the prompt param (string or string array) to the prompts,
+// the token array prompts are not supported
+func getCompletionPrompts(prompt interface{}) []string {
+	switch v := prompt.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		prompts := utils.EachNotNil(v, func(item interface{}) *string {
+			if value, ok := item.(string); ok {
+				return &value
+			}
+			return nil
+		})
+
+		if len(prompts) == len(v) {
+			return prompts
+		}
+	}
+
+	return nil
+}
+
+func getCompletionMessages(prompts ...string) []globals.Message {
+	return utils.Each(prompts, func(prompt string) globals.Message {
+		return globals.Message{
+			Role:    globals.User,
+			Content: prompt,
+		}
+	})
+}
+
+func getCompletionProps(form RelayCompletionForm, prompt string, buffer *utils.Buffer, user *auth.User, c *gin.Context) *adaptercommon.ChatProps {
+	return adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
+		Model:            form.Model,
+		Message:          getCompletionMessages(prompt),
+		Prompt:           &prompt,
+		Suffix:           form.Suffix,
+		MaxTokens:        form.MaxTokens,
+		PresencePenalty:  form.PresencePenalty,
+		FrequencyPenalty: form.FrequencyPenalty,
+		Temperature:      form.Temperature,
+		TopP:             form.TopP,
+		Stop:             getStopSequences(form.Stop),
+		Seed:             form.Seed,
+		N:                form.N,
+		LogitBias:        form.LogitBias,
+		IncludeUsage:     form.StreamOptions != nil && form.StreamOptions.IncludeUsage,
+		User:             user.Username,
+		Ip:               getClientIP(c),
+	}, buffer)
+}
+
+// getCompletionChoice returns the choice of the completion, the prompt is prepended if echo is enabled
+func getCompletionChoice(form RelayCompletionForm, prompt string, text string, index int) CompletionChoice {
+	return CompletionChoice{
+		Text:         utils.Multi(form.Echo, prompt+text, text),
+		Index:        index,
+		FinishReason: ReasonStop,
+	}
+}
+
+func addRelayUsage(usage *Usage, buffer *utils.Buffer) {
+	current := getRelayUsage(buffer, false)
+
+	usage.PromptTokens += current.PromptTokens
+	usage.CompletionTokens += current.CompletionTokens
+	usage.TotalTokens += current.TotalTokens
+}
+
+func sendCompletionResponse(c *gin.Context, form RelayCompletionForm, prompts []string, id string, created int64, user *auth.User, plan bool) {
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	group := auth.GetGroup(db, user)
+	charge := channel.ChargeInstance.GetCharge(form.Model)
+	n := utils.GetPtrVal(form.N, 1)
+
+	var choices []CompletionChoice
+	var usage Usage
+	var quota float32
+
+	// each prompt is a standalone request, the choices of the prompt are indexed from `i * n`
+	for i, prompt := range prompts {
+		buffer := utils.NewBuffer(form.Model, getCompletionMessages(prompt), charge)
+		hit, err := channel.NewChatRequestWithCache(c.Request.Context(), cache, buffer, group, getCompletionProps(form, prompt, buffer, user, c), func(data *globals.Chunk) error {
+			buffer.WriteChunk(data)
+			return nil
+		})
+
+		admin.AnalyseRequest(form.Model, buffer, err)
+		if err != nil {
+			if adapter.IsPartialError(err) {
+				// the stream is failed halfway without retrying, the content delivered to the client is billed
+				CollectQuota(c, user, buffer, plan, nil)
+			} else {
+				auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+			}
+			globals.Warn(fmt.Sprintf("error from completion request api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+
+			sendErrorResponse(c, err)
+			return
+		}
+
+		if !hit {
+			CollectQuota(c, user, buffer, plan, err)
+		}
+
+		choices = append(choices, getCompletionChoice(form, prompt, buffer.Read(), i*n))
+		for j, choice := range buffer.GetChoices() {
+			choices = append(choices, getCompletionChoice(form, prompt, choice.Data, i*n+j+1))
+		}
+
+		addRelayUsage(&usage, buffer)
+		quota += buffer.GetQuota()
+	}
+
+	c.JSON(http.StatusOK, RelayCompletionResponse{
+		Id:      fmt.Sprintf("cmpl-%s", id),
+		Object:  "text_completion",
+		Created: created,
+		Model:   form.Model,
+		Choices: choices,
+		Usage:   &usage,
+		Quota:   utils.Multi[*float32](form.Official, nil, utils.ToPtr(quota)),
+	})
+}
+
+func getStreamCompletionForm(id string, created int64, form RelayCompletionForm, text string, index int, end bool) RelayCompletionResponse {
+	return RelayCompletionResponse{
+		Id:      fmt.Sprintf("cmpl-%s", id),
+		Object:  "text_completion",
+		Created: created,
+		Model:   form.Model,
+		Choices: []CompletionChoice{
+			{
+				Text:         text,
+				Index:        index,
+				FinishReason: utils.Multi[interface{}](end, ReasonStop, nil),
+			},
+		},
+	}
+}
+
+func sendStreamCompletionResponse(c *gin.Context, form RelayCompletionForm, prompts []string, id string, created int64, user *auth.User, plan bool) {
+	partial := make(chan RelayCompletionResponse)
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	group := auth.GetGroup(db, user)
+	charge := channel.ChargeInstance.GetCharge(form.Model)
+	n := utils.GetPtrVal(form.N, 1)
+
+	relay := newRelayStream(c)
+	defer relay.wait()
+
+	relay.run(func(ctx context.Context) {
+		defer close(partial)
+
+		var usage Usage
+		var quota float32
+
+		for i, prompt := range prompts {
+			offset := i * n
+			if form.Echo {
+				for j := 0; j < n; j++ {
+					sendPartial(ctx, partial, getStreamCompletionForm(id, created, form, prompt, offset+j, false))
+				}
+			}
+
+			buffer := utils.NewBuffer(form.Model, getCompletionMessages(prompt), charge)
+			hit, err := channel.NewChatRequestWithCache(
+				ctx, cache, buffer, group, getCompletionProps(form, prompt, buffer, user, c),
+				func(data *globals.Chunk) error {
+					buffer.WriteChunk(data)
+
+					if data.Content != "" && !sendPartial(ctx, partial, getStreamCompletionForm(id, created, form, data.Content, offset+data.Index, false)) {
+						return ctx.Err()
+					}
+					return nil
+				},
+			)
+
+			admin.AnalyseRequest(form.Model, buffer, err)
+			if adapter.IsCanceledError(err) {
+				// the client is gone, only the produced tokens are billed
+				CollectQuota(c, user, buffer, plan, nil)
+				return
+			}
+
+			if err != nil {
+				auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+				globals.Warn(fmt.Sprintf("error from completion request api: %s (instance: %s, client: %s)", err.Error(), form.Model, c.ClientIP()))
+				sendPartial(ctx, partial, RelayCompletionResponse{Error: err})
+				return
+			}
+
+			for j := 0; j < n; j++ {
+				sendPartial(ctx, partial, getStreamCompletionForm(id, created, form, "", offset+j, true))
+			}
+
+			if !hit {
+				CollectQuota(c, user, buffer, plan, err)
+			}
+
+			addRelayUsage(&usage, buffer)
+			quota += buffer.GetRecordQuota()
+		}
+
+		if form.StreamOptions != nil && form.StreamOptions.IncludeUsage {
+			sendPartial(ctx, partial, RelayCompletionResponse{
+				Id:      fmt.Sprintf("cmpl-%s", id),
+				Object:  "text_completion",
+				Created: created,
+				Model:   form.Model,
+				Choices: []CompletionChoice{},
+				Usage:   &usage,
+				Quota:   utils.Multi[*float32](form.Official, nil, utils.ToPtr(quota)),
+			})
+		}
+	})
+
+	c.Stream(func(w io.Writer) bool {
+		if resp, ok := receive(relay, c, partial); ok {
+			if resp.Error != nil {
+				sendStreamErrorResponse(c, resp.Error)
+				return false
+			}
+
+			c.Render(-1, utils.NewEvent(resp))
+			return true
+		}
+
+		c.Render(-1, utils.NewEndEvent())
+		return false
+	})
+}
@@ -120,6 +120,11 @@ func ChatAPI(c *gin.Context) {
 	})
 }
 func getClientIP(c *gin.Context) string {
+	if c == nil {
+		// the background requests (e.g. batch api) have no client
+		return ""
+	}
+
 	// 尝试从 X-Forwarded-For 头中获取 IP 地址
 	if forwardedFor := c.GetHeader("X-Forwarded-For"); forwardedFor != "" {
 		addresses := strings.Split(forwardedFor, ",")
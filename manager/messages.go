@@ -0,0 +1,602 @@
+package manager
+
+import (
+	"chat/adapter"
+	adaptercommon "chat/adapter/common"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MessagesStopEndTurn = "end_turn"
+	MessagesStopToolUse = "tool_use"
+)
+
+// messagesErrorType is the anthropic error type by the http status
+var messagesErrorType = map[int]string{
+	http.StatusBadRequest:      "invalid_request_error",
+	http.StatusUnauthorized:    "authentication_error",
+	http.StatusPaymentRequired: "billing_error",
+	http.StatusForbidden:       "permission_error",
+	http.StatusNotFound:        "not_found_error",
+	http.StatusTooManyRequests: "rate_limit_error",
+}
+
+func sendMessagesErrorResponse(c *gin.Context, err error, types ...string) {
+	relayErr := getRelayError(err, types...)
+	errType, ok := messagesErrorType[relayErr.Status]
+	if !ok {
+		errType = "api_error"
+	}
+
+	setRelayErrorHeader(c, relayErr)
+	c.JSON(relayErr.Status, MessagesErrorResponse{
+		Type: "error",
+		Error: TranshipmentError{
+			Message: relayErr.Message,
+			Type:    errType,
+		},
+	})
+}
+
+func abortWithMessagesErrorResponse(c *gin.Context, err error, types ...string) {
+	sendMessagesErrorResponse(c, err, types...)
+	c.Abort()
+}
+
+// getMessagesBlocks converts the anthropic content (string or content blocks) to the content blocks
+func getMessagesBlocks(content interface{}) []MessagesContentBlock {
+	switch v := content.(type) {
+	case nil:
+		return nil
+	case string:
+		return []MessagesContentBlock{{Type: "text", Text: v}}
+	default:
+		if blocks := utils.MapToStruct[[]MessagesContentBlock](v); blocks != nil {
+			return *blocks
+		}
+
+		return nil
+	}
+}
+
+func getMessagesImageUrl(source *MessagesImageSource) string {
+	if source == nil {
+		return ""
+	}
+
+	if source.Type == "url" {
+		return source.Url
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data)
+}
+
+// getMessagesText joins the text and image blocks to the plain message content
+func getMessagesText(blocks []MessagesContentBlock) string {
+	var result string
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			result += block.Text
+		case "image":
+			if url := getMessagesImageUrl(block.Source); url != "" {
+				result += fmt.Sprintf(" %s ", url)
+			}
+		}
+	}
+
+	return result
+}
+
+// getMessagesParts converts the image and document blocks to the content parts, nil if the blocks only have the text
+func getMessagesParts(blocks []MessagesContentBlock) []globals.ContentPart {
+	return getMultimodalParts(utils.EachNotNil(blocks, func(block MessagesContentBlock) *globals.ContentPart {
+		switch block.Type {
+		case "text":
+			return &globals.ContentPart{Type: globals.ContentTypeText, Text: utils.ToPtr(block.Text)}
+		case "image":
+			if url := getMessagesImageUrl(block.Source); url != "" {
+				return &globals.ContentPart{Type: globals.ContentTypeImageUrl, ImageUrl: &globals.ContentImageUrl{Url: url}}
+			}
+		case "document":
+			if block.Source != nil && block.Source.Type == "base64" {
+				return &globals.ContentPart{Type: globals.ContentTypeFile, File: &globals.ContentFile{FileData: utils.ToPtr(getMessagesImageUrl(block.Source))}}
+			}
+		}
+		return nil
+	}))
+}
+
+// getMessagesCacheControl returns the last cache breakpoint of the content blocks
+func getMessagesCacheControl(blocks []MessagesContentBlock) *globals.CacheControl {
+	var cache *globals.CacheControl
+	for _, block := range blocks {
+		if block.CacheControl != nil {
+			cache = block.CacheControl
+		}
+	}
+
+	return cache
+}
+
+// transformMessages converts the anthropic system prompt and messages to the chat messages
+func transformMessages(form RelayMessagesForm) []globals.Message {
+	var messages []globals.Message
+	blocks := getMessagesBlocks(form.System)
+	if system := getMessagesText(blocks); len(system) > 0 {
+		messages = append(messages, globals.Message{
+			Role:         globals.System,
+			Content:      system,
+			CacheControl: getMessagesCacheControl(blocks),
+		})
+	}
+
+	for _, message := range form.Messages {
+		blocks := getMessagesBlocks(message.Content)
+
+		var calls globals.ToolCalls
+		var results []globals.Message
+		for _, block := range blocks {
+			switch block.Type {
+			case "tool_use":
+				calls = append(calls, globals.ToolCall{
+					Type: "function",
+					Id:   block.Id,
+					Function: globals.ToolCallFunction{
+						Name:      block.Name,
+						Arguments: utils.Marshal(utils.Multi[interface{}](block.Input != nil, block.Input, map[string]interface{}{})),
+					},
+				})
+			case "tool_result":
+				results = append(results, globals.Message{
+					Role:         globals.Tool,
+					Content:      getMessagesText(getMessagesBlocks(block.Content)),
+					ToolCallId:   utils.ToPtr(block.ToolUseId),
+					CacheControl: block.CacheControl,
+				})
+			}
+		}
+
+		// tool results are sent as the tool messages before the rest of the user content
+		messages = append(messages, results...)
+
+		content := getMessagesText(blocks)
+		if len(content) == 0 && len(calls) == 0 && len(results) > 0 {
+			continue
+		}
+
+		messages = append(messages, globals.Message{
+			Role:         message.Role,
+			Content:      content,
+			Parts:        getMessagesParts(blocks),
+			ToolCalls:    utils.Multi[*globals.ToolCalls](len(calls) > 0, &calls, nil),
+			CacheControl: getMessagesCacheControl(blocks),
+		})
+	}
+
+	return messages
+}
+
+func transformMessagesTools(form RelayMessagesForm) *globals.FunctionTools {
+	if len(form.Tools) == 0 {
+		return nil
+	}
+
+	tools := utils.Each(form.Tools, func(tool MessagesTool) globals.ToolObject {
+		parameters := utils.MapToStruct[globals.ToolParameters](tool.InputSchema)
+		return globals.ToolObject{
+			Type: "function",
+			Function: globals.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  utils.GetPtrVal(parameters, globals.ToolParameters{Type: "object"}),
+			},
+		}
+	})
+
+	return (*globals.FunctionTools)(&tools)
+}
+
+// transformMessagesCacheControl returns the cache breakpoint of the tools
+func transformMessagesCacheControl(form RelayMessagesForm) *globals.CacheControl {
+	var cache *globals.CacheControl
+	for _, tool := range form.Tools {
+		if tool.CacheControl != nil {
+			cache = tool.CacheControl
+		}
+	}
+
+	return cache
+}
+
+func transformMessagesToolChoice(form RelayMessagesForm) *interface{} {
+	if form.ToolChoice == nil {
+		return nil
+	}
+
+	var choice interface{}
+	switch form.ToolChoice.Type {
+	case "any":
+		choice = "required"
+	case "none":
+		choice = "none"
+	case "tool":
+		choice = map[string]interface{}{
+			"type": "function",
+			"function": map[string]string{
+				"name": form.ToolChoice.Name,
+			},
+		}
+	default:
+		choice = "auto"
+	}
+
+	return &choice
+}
+
+func getMessagesProps(form RelayMessagesForm, messages []globals.Message, buffer *utils.Buffer, user *auth.User, c *gin.Context) *adaptercommon.ChatProps {
+	return adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
+		Model:          form.Model,
+		Message:        messages,
+		MaxTokens:      form.MaxTokens,
+		Temperature:    form.Temperature,
+		TopP:           form.TopP,
+		TopK:           form.TopK,
+		Stop:           form.StopSequences,
+		Tools:          transformMessagesTools(form),
+		ToolChoice:     transformMessagesToolChoice(form),
+		ThinkingBudget: getThinkingBudget(form.Thinking),
+		CacheControl:   transformMessagesCacheControl(form),
+		User:           user.Username,
+		Ip:             getClientIP(c),
+	}, buffer)
+}
+
+// getMessagesUsage returns the usage of the buffer, the cached tokens are excluded from the input tokens
+func getMessagesUsage(buffer *utils.Buffer) MessagesUsage {
+	usage := MessagesUsage{
+		InputTokens:  buffer.CountInputToken(),
+		OutputTokens: buffer.CountOutputToken(false),
+	}
+
+	if upstream := buffer.GetUsage(); upstream != nil {
+		usage.CacheReadInputTokens = upstream.CacheReadTokens
+		usage.CacheCreationInputTokens = upstream.CacheWriteTokens
+		usage.InputTokens = utils.Multi(usage.InputTokens > upstream.CacheReadTokens+upstream.CacheWriteTokens, usage.InputTokens-upstream.CacheReadTokens-upstream.CacheWriteTokens, 0)
+	}
+
+	return usage
+}
+
+func getMessagesStopReason(buffer *utils.Buffer) string {
+	if buffer.IsFunctionCalling() {
+		return MessagesStopToolUse
+	}
+
+	return MessagesStopEndTurn
+}
+
+func getMessagesToolInput(arguments string) interface{} {
+	if input := utils.UnmarshalForm[map[string]interface{}](arguments); input != nil {
+		return *input
+	}
+
+	return map[string]interface{}{}
+}
+
+func MessagesRelayAPI(c *gin.Context) {
+	if globals.CloseRelay {
+		abortWithMessagesErrorResponse(c, fmt.Errorf("relay api is denied of access"), "permission_error")
+		return
+	}
+
+	username := utils.GetUserFromContext(c)
+	if username == "" {
+		abortWithMessagesErrorResponse(c, fmt.Errorf("access denied for invalid api key"), "authentication_error")
+		return
+	}
+
+	if utils.GetAgentFromContext(c) != "api" {
+		abortWithMessagesErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "authentication_error")
+		return
+	}
+
+	var form RelayMessagesForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithMessagesErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+	id := utils.Md5Encrypt(username + form.Model + time.Now().String())
+
+	messages := transformMessages(form)
+	if strings.HasSuffix(form.Model, "-official") {
+		form.Model = strings.TrimSuffix(form.Model, "-official")
+		form.Official = true
+	}
+
+	if err := checkModeration(db, user, form.Model, messages, ModerationSourceRelay); err != nil {
+		sendMessagesErrorResponse(c, err, "moderation_error")
+		return
+	}
+
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		sendMessagesErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	if form.Stream {
+		sendStreamMessagesResponse(c, form, messages, id, user, plan)
+	} else {
+		sendMessagesResponse(c, form, messages, id, user, plan)
+	}
+}
+
+func sendMessagesResponse(c *gin.Context, form RelayMessagesForm, messages []globals.Message, id string, user *auth.User, plan bool) {
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
+	hit, err := channel.NewChatRequestWithCache(c.Request.Context(), cache, buffer, auth.GetGroup(db, user), getMessagesProps(form, messages, buffer, user, c), func(data *globals.Chunk) error {
+		buffer.WriteChunk(data)
+		return nil
+	})
+
+	admin.AnalyseRequest(form.Model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+		globals.Warn(fmt.Sprintf("error from messages request api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+
+		sendMessagesErrorResponse(c, err)
+		return
+	}
+
+	if !hit {
+		CollectQuota(c, user, buffer, plan, err)
+	}
+
+	// stop reason should be taken before the tool calls are read from the buffer
+	reason := getMessagesStopReason(buffer)
+
+	content := make([]MessagesContentBlock, 0)
+	if text := buffer.Read(); len(text) > 0 {
+		content = append(content, MessagesContentBlock{Type: "text", Text: text})
+	}
+
+	if tools := buffer.GetToolCalls(); tools != nil {
+		for _, tool := range *tools {
+			content = append(content, MessagesContentBlock{
+				Type:  "tool_use",
+				Id:    tool.Id,
+				Name:  tool.Function.Name,
+				Input: getMessagesToolInput(tool.Function.Arguments),
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, RelayMessagesResponse{
+		Id:         fmt.Sprintf("msg_%s", id),
+		Type:       "message",
+		Role:       globals.Assistant,
+		Model:      form.Model,
+		Content:    content,
+		StopReason: utils.ToPtr(reason),
+		Usage:      getMessagesUsage(buffer),
+		Quota:      utils.Multi[*float32](form.Official, nil, utils.ToPtr(buffer.GetQuota())),
+	})
+}
+
+// messagesStream converts the chat chunks to the anthropic content block events
+type messagesStream struct {
+	Index   int
+	Opened  bool
+	Kind    string
+	ToolIdx int
+	Events  []utils.StreamEvent
+}
+
+func (s *messagesStream) emit(event string, data interface{}) {
+	s.Events = append(s.Events, utils.NewNamedEvent(event, data))
+}
+
+func (s *messagesStream) stop() {
+	if !s.Opened {
+		return
+	}
+
+	s.emit("content_block_stop", gin.H{
+		"type":  "content_block_stop",
+		"index": s.Index,
+	})
+	s.Opened = false
+	s.Index++
+}
+
+func (s *messagesStream) start(kind string, block gin.H) {
+	s.stop()
+	s.emit("content_block_start", gin.H{
+		"type":          "content_block_start",
+		"index":         s.Index,
+		"content_block": block,
+	})
+	s.Opened = true
+	s.Kind = kind
+}
+
+func (s *messagesStream) delta(delta gin.H) {
+	s.emit("content_block_delta", gin.H{
+		"type":  "content_block_delta",
+		"index": s.Index,
+		"delta": delta,
+	})
+}
+
+// Write converts the chunk to the events and returns the pending events
+func (s *messagesStream) Write(data *globals.Chunk) []utils.StreamEvent {
+	s.Events = nil
+
+	if len(data.Content) > 0 {
+		if !s.Opened || s.Kind != "text" {
+			s.start("text", gin.H{"type": "text", "text": ""})
+		}
+
+		s.delta(gin.H{"type": "text_delta", "text": data.Content})
+	}
+
+	if data.ToolCall != nil {
+		for i, call := range *data.ToolCall {
+			idx := utils.GetPtrVal(call.Index, i)
+			if !s.Opened || s.Kind != "tool_use" || s.ToolIdx != idx {
+				s.start("tool_use", gin.H{
+					"type":  "tool_use",
+					"id":    call.Id,
+					"name":  call.Function.Name,
+					"input": gin.H{},
+				})
+				s.ToolIdx = idx
+			}
+
+			if len(call.Function.Arguments) > 0 {
+				s.delta(gin.H{"type": "input_json_delta", "partial_json": call.Function.Arguments})
+			}
+		}
+	}
+
+	return s.Events
+}
+
+// End closes the opened content block and returns the message ending events
+func (s *messagesStream) End(buffer *utils.Buffer) []utils.StreamEvent {
+	s.Events = nil
+
+	s.stop()
+	s.emit("message_delta", gin.H{
+		"type": "message_delta",
+		"delta": gin.H{
+			"stop_reason":   getMessagesStopReason(buffer),
+			"stop_sequence": nil,
+		},
+		"usage": getMessagesUsage(buffer),
+	})
+	s.emit("message_stop", gin.H{"type": "message_stop"})
+
+	return s.Events
+}
+
+type messagesPartial struct {
+	Events []utils.StreamEvent
+	Error  error
+}
+
+func sendStreamMessagesResponse(c *gin.Context, form RelayMessagesForm, messages []globals.Message, id string, user *auth.User, plan bool) {
+	partial := make(chan messagesPartial)
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	group := auth.GetGroup(db, user)
+	charge := channel.ChargeInstance.GetCharge(form.Model)
+
+	relay := newRelayStream(c)
+	defer relay.wait()
+
+	relay.run(func(ctx context.Context) {
+		defer close(partial)
+
+		buffer := utils.NewBuffer(form.Model, messages, charge)
+		stream := &messagesStream{}
+
+		sendPartial(ctx, partial, messagesPartial{Events: []utils.StreamEvent{
+			utils.NewNamedEvent("message_start", gin.H{
+				"type": "message_start",
+				"message": RelayMessagesResponse{
+					Id:      fmt.Sprintf("msg_%s", id),
+					Type:    "message",
+					Role:    globals.Assistant,
+					Model:   form.Model,
+					Content: []MessagesContentBlock{},
+					Usage: MessagesUsage{
+						InputTokens: buffer.CountInputToken(),
+					},
+				},
+			}),
+			utils.NewNamedEvent("ping", gin.H{"type": "ping"}),
+		}})
+
+		hit, err := channel.NewChatRequestWithCache(
+			ctx, cache, buffer, group, getMessagesProps(form, messages, buffer, user, c),
+			func(data *globals.Chunk) error {
+				buffer.WriteChunk(data)
+
+				if !data.IsEmpty() && !sendPartial(ctx, partial, messagesPartial{Events: stream.Write(data)}) {
+					return ctx.Err()
+				}
+				return nil
+			},
+		)
+
+		admin.AnalyseRequest(form.Model, buffer, err)
+		if adapter.IsCanceledError(err) {
+			// the client is gone, only the produced tokens are billed
+			CollectQuota(c, user, buffer, plan, nil)
+			return
+		}
+
+		if err != nil {
+			if adapter.IsPartialError(err) {
+				// the stream is failed halfway without retrying, the content delivered to the client is billed
+				CollectQuota(c, user, buffer, plan, nil)
+			} else {
+				auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+			}
+			globals.Warn(fmt.Sprintf("error from messages request api: %s (instance: %s, client: %s)", err.Error(), form.Model, c.ClientIP()))
+			sendPartial(ctx, partial, messagesPartial{Error: err})
+			return
+		}
+
+		sendPartial(ctx, partial, messagesPartial{Events: stream.End(buffer)})
+
+		if !hit {
+			CollectQuota(c, user, buffer, plan, err)
+		}
+	})
+
+	c.Stream(func(w io.Writer) bool {
+		if resp, ok := receive(relay, c, partial); ok {
+			if resp.Error != nil {
+				c.Render(-1, utils.NewNamedEvent("error", MessagesErrorResponse{
+					Type: "error",
+					Error: TranshipmentError{
+						Message: resp.Error.Error(),
+						Type:    "api_error",
+					},
+				}))
+				return false
+			}
+
+			for _, event := range resp.Events {
+				c.Render(-1, event)
+			}
+			return true
+		}
+
+		return false
+	})
+}
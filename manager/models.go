@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"chat/adapter"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getCallerGroup returns the subscription group of the caller (anonymous if not authenticated)
+func getCallerGroup(c *gin.Context) string {
+	db := utils.GetDBFromContext(c)
+	if username := utils.GetUserFromContext(c); username != "" {
+		return auth.GetGroup(db, &auth.User{Username: username})
+	}
+
+	return auth.GetGroup(db, nil)
+}
+
+// getReachableChannels returns the active channels of the model which the group can reach
+func getReachableChannels(model string, group string) channel.Sequence {
+	ticker := channel.ConduitInstance.GetTicker(model, group)
+	if ticker == nil {
+		return nil
+	}
+
+	return ticker.Sequence
+}
+
+func getModelPricing(model string) *globals.ModelPricing {
+	charge := channel.ChargeInstance.GetCharge(model)
+	if charge.IsUnsetType() {
+		return nil
+	}
+
+	return &globals.ModelPricing{
+		Type:       charge.GetType(),
+		Input:      charge.GetInput(),
+		Output:     charge.GetOutput(),
+		CacheRead:  utils.Multi[*float32](charge.CacheRead > 0, utils.ToPtr(charge.GetCacheRead()), nil),
+		CacheWrite: utils.Multi[*float32](charge.CacheWrite > 0, utils.ToPtr(charge.GetCacheWrite()), nil),
+		Anonymous:  charge.SupportAnonymous(),
+	}
+}
+
+// getModelItem merges the model metadata from the market, the charge rules, the vision config and the reachable channels
+func getModelItem(item globals.ListModelsItem, seq channel.Sequence) globals.ListModelsItem {
+	market := admin.MarketInstance.GetModel(item.Id)
+
+	item.Name = item.Id
+	item.Capabilities = &globals.ModelCapabilities{
+		Vision: globals.IsVisionModel(item.Id) || utils.IsCustomVisionModel(item.Id) || market.HasCapability(admin.CapabilityVision),
+		Tools: market.HasCapability(admin.CapabilityTools) || utils.Contains(true, utils.Each(seq, func(ch *channel.Channel) bool {
+			return adapter.SupportTools(ch.GetType())
+		})),
+		Reasoning: globals.IsReasoningModel(item.Id) || market.HasCapability(admin.CapabilityReasoning),
+	}
+	item.Pricing = getModelPricing(item.Id)
+
+	if market != nil {
+		item.Name = market.Name
+		item.Description = market.Description
+		item.Tags = market.Tag
+		item.ContextLength = market.ContextLength
+		item.Capabilities.HighContext = market.HighContext
+	}
+
+	return item
+}
+
+// ModelAPI lists the models reachable by the caller's group, the model metadata is included with `?extended=true`
+func ModelAPI(c *gin.Context) {
+	group := getCallerGroup(c)
+	extended := c.Query("extended") == "true"
+
+	data := make([]globals.ListModelsItem, 0)
+	for _, item := range globals.V1ListModels.Data {
+		seq := getReachableChannels(item.Id, group)
+		if len(seq) == 0 {
+			continue
+		}
+
+		if extended {
+			item = getModelItem(item, seq)
+		}
+		data = append(data, item)
+	}
+
+	c.JSON(http.StatusOK, globals.ListModels{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+// ModelDetailAPI returns the model with the metadata if it is reachable by the caller's group
+func ModelDetailAPI(c *gin.Context) {
+	id := strings.TrimPrefix(c.Param("id"), "/")
+	group := getCallerGroup(c)
+
+	for _, item := range globals.V1ListModels.Data {
+		if item.Id != id {
+			continue
+		}
+
+		if seq := getReachableChannels(item.Id, group); len(seq) > 0 {
+			c.JSON(http.StatusOK, getModelItem(item, seq))
+			return
+		}
+		break
+	}
+
+	sendErrorResponse(c, globals.NewModelNotFoundError("the model `%s` does not exist or you do not have access to it", id))
+}
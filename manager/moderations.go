@@ -0,0 +1,159 @@
+package manager
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultModerationModel = "omni-moderation-latest"
+
+	ModerationSourceRelay = "relay"
+	ModerationSourceChat  = "chat"
+)
+
+func ModerationsRelayAPI(c *gin.Context) {
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	var form RelayModerationForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+
+	form.Model = strings.TrimSuffix(utils.Multi(len(form.Model) > 0, form.Model, defaultModerationModel), "-official")
+
+	props := adaptercommon.CreateModerationProps(&adaptercommon.ModerationProps{
+		Model: form.Model,
+		Input: form.Input,
+	})
+	props.User = auth.GetUsernameString(db, user)
+
+	messages := utils.Each(props.GetInputs(), func(input string) globals.Message {
+		return globals.Message{
+			Role:    globals.User,
+			Content: input,
+		}
+	})
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
+	buffer.SetTokenName(globals.ApiTokenType)
+
+	resp, err := channel.NewModerationRequest(auth.GetGroup(db, user), props)
+
+	admin.AnalyseRequest(form.Model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+		globals.Warn(fmt.Sprintf("error from moderation request api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+
+		sendErrorResponse(c, err)
+		return
+	}
+
+	CollectInputQuota(c, user, buffer, plan)
+
+	c.JSON(http.StatusOK, RelayModerationResponse{
+		Id:      utils.Multi(len(resp.Id) > 0, resp.Id, fmt.Sprintf("modr-%s", utils.Md5Encrypt(username+form.Model+utils.Marshal(form.Input)))),
+		Model:   utils.Multi(len(resp.Model) > 0, resp.Model, form.Model),
+		Results: resp.Results,
+	})
+}
+
+// getModerationPrompt returns all the user and system content to moderate,
+// the relay apis are stateless so that the whole history of the request is moderated
+func getModerationPrompt(messages []globals.Message) string {
+	var prompts []string
+	for _, message := range messages {
+		if message.Role != globals.User && message.Role != globals.System {
+			continue
+		}
+
+		if content := strings.TrimSpace(message.Content); len(content) > 0 {
+			prompts = append(prompts, content)
+		}
+	}
+
+	return strings.Join(prompts, "\n\n")
+}
+
+// getModerationReason returns the reason why the prompt is blocked, empty if the prompt passes the moderation
+func getModerationReason(db *sql.DB, user *auth.User, prompt string) string {
+	content := strings.ToLower(prompt)
+	for _, keyword := range channel.SystemInstance.GetModerationKeywords() {
+		if strings.Contains(content, keyword) {
+			return fmt.Sprintf("keyword: %s", keyword)
+		}
+	}
+
+	model := channel.SystemInstance.GetModerationModel()
+	if len(model) == 0 {
+		return ""
+	}
+
+	resp, err := channel.NewModerationRequest(auth.GetGroup(db, user), adaptercommon.CreateModerationProps(&adaptercommon.ModerationProps{
+		Model: model,
+		Input: prompt,
+		User:  auth.GetUsernameString(db, user),
+	}))
+	if err != nil {
+		// the gate is fail-open, the moderation upstream errors should not block the requests
+		globals.Warn(fmt.Sprintf("[moderation] moderation request failed: %s (model: %s)", err.Error(), model))
+		return ""
+	}
+
+	if !resp.IsFlagged() {
+		return ""
+	}
+
+	return fmt.Sprintf("flagged: %s", strings.Join(resp.GetFlaggedCategories(), ", "))
+}
+
+// checkModeration runs the pre-flight moderation gate on the user and system prompts, the blocked prompts are recorded in the moderation log
+func checkModeration(db *sql.DB, user *auth.User, model string, messages []globals.Message, source string) error {
+	if !channel.SystemInstance.IsModerationEnabled() {
+		return nil
+	}
+
+	if groups := channel.SystemInstance.GetModerationGroups(); len(groups) > 0 && !auth.HitGroups(db, user, groups) {
+		return nil
+	}
+
+	prompt := getModerationPrompt(messages)
+	if len(strings.TrimSpace(prompt)) == 0 {
+		return nil
+	}
+
+	reason := getModerationReason(db, user, prompt)
+	if len(reason) == 0 {
+		return nil
+	}
+
+	globals.Info(fmt.Sprintf("[moderation] prompt blocked (user: %s, model: %s, source: %s, reason: %s)", auth.GetUsernameString(db, user), model, source, reason))
+	admin.AddModerationLog(db, auth.GetUsernameString(db, user), model, source, reason, utils.Extract(prompt, 4096, "..."))
+
+	return globals.NewRelayError(http.StatusBadRequest, "moderation_error", "content_policy_violation", "your prompt was blocked by the content moderation policy")
+}
@@ -4,14 +4,15 @@ import (
 	"chat/admin"
 	"chat/channel"
 	"chat/globals"
+	"chat/utils"
+	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func ModelAPI(c *gin.Context) {
-	c.JSON(http.StatusOK, globals.V1ListModels)
-}
-
 func MarketAPI(c *gin.Context) {
 	c.JSON(http.StatusOK, admin.MarketInstance.GetModels())
 }
@@ -24,23 +25,152 @@ func PlanAPI(c *gin.Context) {
 	c.JSON(http.StatusOK, channel.PlanInstance.GetPlans())
 }
 
+// relayErrorStatus is the http status of the untyped relay errors by the error type
+var relayErrorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"moderation_error":      http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"quota_exceeded_error":  http.StatusTooManyRequests,
+	"access_denied_error":   http.StatusForbidden,
+	"permission_error":      http.StatusForbidden,
+
+	// gemini error status
+	"INVALID_ARGUMENT":   http.StatusBadRequest,
+	"UNAUTHENTICATED":    http.StatusUnauthorized,
+	"PERMISSION_DENIED":  http.StatusForbidden,
+	"NOT_FOUND":          http.StatusNotFound,
+	"RESOURCE_EXHAUSTED": http.StatusTooManyRequests,
+}
+
+// getRelayError converts the error to the typed relay error,
+// the untyped errors without the error type are regarded as the upstream errors
+func getRelayError(err error, types ...string) *globals.RelayError {
+	var relayErr *globals.RelayError
+	if errors.As(err, &relayErr) {
+		return relayErr
+	}
+
+	if len(types) == 0 {
+		return globals.NewUpstreamError(err)
+	}
+
+	status, ok := relayErrorStatus[types[0]]
+	return globals.NewRelayError(utils.Multi(ok, status, http.StatusBadRequest), types[0], "", err.Error())
+}
+
+// setRelayErrorHeader sets the `Retry-After` header of the throttled relay errors
+func setRelayErrorHeader(c *gin.Context, err *globals.RelayError) {
+	if err.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(err.RetryAfter))
+	}
+}
+
 func sendErrorResponse(c *gin.Context, err error, types ...string) {
-	var errType string
-	if len(types) > 0 {
-		errType = types[0]
-	} else {
-		errType = "chatnio_api_error"
+	relayErr := getRelayError(err, types...)
+
+	setRelayErrorHeader(c, relayErr)
+	c.JSON(relayErr.Status, getRelayErrorResponse(relayErr))
+}
+
+// sendStreamErrorResponse sends the error of the stream relay, the sse `error` event is sent instead of the json body
+// once the stream is started (e.g. the heartbeat or the chunks are written), since the status and the headers are committed
+func sendStreamErrorResponse(c *gin.Context, err error, types ...string) {
+	if !c.Writer.Written() {
+		sendErrorResponse(c, err, types...)
+		return
 	}
 
-	c.JSON(http.StatusServiceUnavailable, RelayErrorResponse{
+	c.Render(-1, utils.NewNamedEvent("error", getRelayErrorResponse(getRelayError(err, types...))))
+}
+
+func getRelayErrorResponse(err *globals.RelayError) RelayErrorResponse {
+	return RelayErrorResponse{
 		Error: TranshipmentError{
-			Message: err.Error(),
-			Type:    errType,
+			Message: err.Message,
+			Type:    err.Type,
+			Param:   err.Param,
+			Code:    err.Code,
 		},
-	})
+	}
 }
 
 func abortWithErrorResponse(c *gin.Context, err error, types ...string) {
 	sendErrorResponse(c, err, types...)
 	c.Abort()
 }
+
+// relayStream is the upstream routine of the stream relays, the context of the routine is canceled
+// once the client is gone, which aborts the upstream connection immediately
+type relayStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	ticker *time.Ticker
+}
+
+func newRelayStream(c *gin.Context) *relayStream {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	stream := &relayStream{
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	if globals.StreamHeartbeat > 0 {
+		stream.ticker = time.NewTicker(globals.StreamHeartbeat)
+	}
+
+	return stream
+}
+
+func (s *relayStream) run(routine func(ctx context.Context)) {
+	go func() {
+		defer close(s.done)
+		routine(s.ctx)
+	}()
+}
+
+// heartbeat returns the channel of the heartbeat ticks (the nil channel never ticks if the heartbeat is disabled)
+func (s *relayStream) heartbeat() <-chan time.Time {
+	if s.ticker == nil {
+		return nil
+	}
+	return s.ticker.C
+}
+
+// wait cancels the routine and waits until it is done,
+// so that the produced tokens are billed before the gin context is released
+func (s *relayStream) wait() {
+	if s.ticker != nil {
+		s.ticker.Stop()
+	}
+
+	s.cancel()
+	<-s.done
+}
+
+// receive waits for the next partial data of the stream, the sse heartbeat is written to keep
+// the connection alive while the upstream is silent (e.g. the reasoning models before the first token)
+func receive[T any](s *relayStream, c *gin.Context, partial <-chan T) (data T, ok bool) {
+	for {
+		select {
+		case data, ok = <-partial:
+			return data, ok
+		case <-s.heartbeat():
+			if err := utils.WriteHeartbeat(c.Writer); err != nil {
+				return data, false
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// sendPartial sends the data to the stream, it returns false if the client is gone
+func sendPartial[T any](ctx context.Context, partial chan<- T, data T) bool {
+	select {
+	case partial <- data:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
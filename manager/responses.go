@@ -0,0 +1,629 @@
+package manager
+
+import (
+	"chat/adapter"
+	adaptercommon "chat/adapter/common"
+	"chat/admin"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ResponsesStatusInProgress = "in_progress"
+	ResponsesStatusCompleted  = "completed"
+
+	// ResponsesStoreExpiration is the expiration (in seconds) of the stored responses, 30 days
+	ResponsesStoreExpiration = 60 * 60 * 24 * 30
+)
+
+func getResponsesStoreKey(id string) string {
+	return fmt.Sprintf("nio:responses:%s", id)
+}
+
+// getResponsesHistory returns the stored conversation of the previous response (only the owner can access)
+func getResponsesHistory(cache *redis.Client, username string, id string) ([]globals.Message, error) {
+	store := utils.GetCacheStore[ResponsesStore](cache, getResponsesStoreKey(id))
+	if store == nil || store.Username != username {
+		return nil, fmt.Errorf("previous response with id '%s' not found", id)
+	}
+
+	return globals.FromStoredMessages(store.Messages), nil
+}
+
+func setResponsesHistory(cache *redis.Client, username string, id string, messages []globals.Message) {
+	if err := utils.SetJson(cache, getResponsesStoreKey(id), ResponsesStore{
+		Username: username,
+		Messages: globals.ToStoredMessages(messages),
+	}, ResponsesStoreExpiration); err != nil {
+		globals.Warn(fmt.Sprintf("[responses] failed to store response %s: %s", id, err.Error()))
+	}
+}
+
+// getResponsesParts converts the input content parts to the content parts
+func getResponsesParts(content interface{}) []globals.ContentPart {
+	parts := utils.MapToStruct[[]ResponsesContentPart](content)
+	if parts == nil {
+		return nil
+	}
+
+	return utils.EachNotNil(*parts, func(part ResponsesContentPart) *globals.ContentPart {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			return &globals.ContentPart{Type: globals.ContentTypeText, Text: utils.ToPtr(part.Text)}
+		case "input_image":
+			var url string
+			switch v := part.ImageUrl.(type) {
+			case string:
+				url = v
+			case map[string]interface{}:
+				url = utils.ToString(v["url"])
+			}
+
+			if url != "" {
+				return &globals.ContentPart{Type: globals.ContentTypeImageUrl, ImageUrl: &globals.ContentImageUrl{Url: url, Detail: part.Detail}}
+			}
+		case "input_file":
+			return &globals.ContentPart{Type: globals.ContentTypeFile, File: &globals.ContentFile{
+				FileId:   part.FileId,
+				FileData: part.FileData,
+				Filename: part.Filename,
+			}}
+		}
+		return nil
+	})
+}
+
+// getResponsesContent joins the text and image parts of the input content
+func getResponsesContent(content interface{}) string {
+	switch v := content.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return globals.GetPartsContent(getResponsesParts(v))
+	}
+}
+
+// transformResponsesInput converts the responses input (string or input items) to the chat messages
+func transformResponsesInput(input interface{}) []globals.Message {
+	if text, ok := input.(string); ok {
+		return []globals.Message{{Role: globals.User, Content: text}}
+	}
+
+	items := utils.MapToStruct[[]ResponsesInputItem](input)
+	if items == nil {
+		return nil
+	}
+
+	var messages []globals.Message
+	for _, item := range *items {
+		switch item.Type {
+		case "function_call":
+			call := globals.ToolCall{
+				Type: "function",
+				Id:   item.CallId,
+				Function: globals.ToolCallFunction{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+
+			// merge the parallel function calls to the previous assistant message
+			if size := len(messages); size > 0 && messages[size-1].Role == globals.Assistant && messages[size-1].ToolCalls != nil {
+				*messages[size-1].ToolCalls = append(*messages[size-1].ToolCalls, call)
+				continue
+			}
+
+			messages = append(messages, globals.Message{
+				Role:      globals.Assistant,
+				ToolCalls: &globals.ToolCalls{call},
+			})
+		case "function_call_output":
+			messages = append(messages, globals.Message{
+				Role:       globals.Tool,
+				Content:    utils.ToString(item.Output),
+				ToolCallId: utils.ToPtr(item.CallId),
+			})
+		case "", "message":
+			role := item.Role
+			if role == "developer" {
+				role = globals.System
+			}
+
+			messages = append(messages, globals.Message{
+				Role:    role,
+				Content: getResponsesContent(item.Content),
+				Parts:   getMultimodalParts(getResponsesParts(item.Content)),
+			})
+		}
+	}
+
+	return messages
+}
+
+func transformResponsesTools(form RelayResponsesForm) *globals.FunctionTools {
+	var tools globals.FunctionTools
+	for _, tool := range form.Tools {
+		if tool.Type != "function" {
+			// built-in tools (e.g. web_search, file_search) are not supported by the channels
+			continue
+		}
+
+		parameters := utils.MapToStruct[globals.ToolParameters](tool.Parameters)
+		tools = append(tools, globals.ToolObject{
+			Type: "function",
+			Function: globals.ToolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  utils.GetPtrVal(parameters, globals.ToolParameters{Type: "object"}),
+			},
+		})
+	}
+
+	if len(tools) == 0 {
+		return nil
+	}
+
+	return &tools
+}
+
+func transformResponsesToolChoice(form RelayResponsesForm) *interface{} {
+	var choice interface{}
+	switch v := form.ToolChoice.(type) {
+	case nil:
+		return nil
+	case string:
+		choice = v
+	case map[string]interface{}:
+		if v["type"] != "function" {
+			choice = "auto"
+			break
+		}
+
+		choice = map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name": v["name"],
+			},
+		}
+	default:
+		return nil
+	}
+
+	return &choice
+}
+
+func getResponsesReasoningEffort(form RelayResponsesForm) *string {
+	if form.Reasoning == nil {
+		return nil
+	}
+
+	return form.Reasoning.Effort
+}
+
+func getResponsesProps(form RelayResponsesForm, messages []globals.Message, buffer *utils.Buffer, user *auth.User, c *gin.Context) *adaptercommon.ChatProps {
+	return adaptercommon.CreateChatProps(&adaptercommon.ChatProps{
+		Model:           form.Model,
+		Message:         messages,
+		MaxTokens:       form.MaxOutputTokens,
+		Temperature:     form.Temperature,
+		TopP:            form.TopP,
+		Tools:           transformResponsesTools(form),
+		ToolChoice:      transformResponsesToolChoice(form),
+		ReasoningEffort: getResponsesReasoningEffort(form),
+		User:            user.Username,
+		Ip:              getClientIP(c),
+	}, buffer)
+}
+
+func getResponsesUsage(buffer *utils.Buffer) *ResponsesUsage {
+	output := buffer.CountOutputToken(false)
+	return &ResponsesUsage{
+		InputTokens:  buffer.CountInputToken(),
+		OutputTokens: output,
+		TotalTokens:  buffer.CountInputToken() + output,
+	}
+}
+
+// getResponsesOutput converts the text and tool calls to the output items
+func getResponsesOutput(id string, text string, tools *globals.ToolCalls) []ResponsesOutputItem {
+	output := make([]ResponsesOutputItem, 0)
+	if len(text) > 0 {
+		output = append(output, ResponsesOutputItem{
+			Type:   "message",
+			Id:     fmt.Sprintf("msg_%s", id),
+			Status: ResponsesStatusCompleted,
+			Role:   globals.Assistant,
+			Content: &[]ResponsesOutputContent{
+				{Type: "output_text", Text: text, Annotations: []interface{}{}},
+			},
+		})
+	}
+
+	if tools != nil {
+		for i, tool := range *tools {
+			output = append(output, ResponsesOutputItem{
+				Type:      "function_call",
+				Id:        fmt.Sprintf("fc_%s_%d", id, i),
+				Status:    ResponsesStatusCompleted,
+				CallId:    tool.Id,
+				Name:      tool.Function.Name,
+				Arguments: utils.ToPtr(tool.Function.Arguments),
+			})
+		}
+	}
+
+	return output
+}
+
+func ResponsesRelayAPI(c *gin.Context) {
+	if globals.CloseRelay {
+		abortWithErrorResponse(c, globals.NewPermissionError("relay api is denied of access"))
+		return
+	}
+
+	username := utils.GetUserFromContext(c)
+	if username == "" {
+		abortWithErrorResponse(c, globals.NewAuthenticationError("access denied for invalid api key"))
+		return
+	}
+
+	if utils.GetAgentFromContext(c) != "api" {
+		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "authentication_error")
+		return
+	}
+
+	var form RelayResponsesForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+	id := utils.Md5Encrypt(username + form.Model + time.Now().String())
+	created := time.Now().Unix()
+
+	// the instructions of the previous response are not carried over
+	var history []globals.Message
+	if form.PreviousResponseId != nil && len(*form.PreviousResponseId) > 0 {
+		previous, err := getResponsesHistory(cache, username, *form.PreviousResponseId)
+		if err != nil {
+			sendErrorResponse(c, err, "invalid_request_error")
+			return
+		}
+		history = previous
+	}
+	history = append(history, transformResponsesInput(form.Input)...)
+
+	messages := history
+	if form.Instructions != nil && len(*form.Instructions) > 0 {
+		messages = append([]globals.Message{{Role: globals.System, Content: *form.Instructions}}, history...)
+	}
+
+	if strings.HasSuffix(form.Model, "-official") {
+		form.Model = strings.TrimSuffix(form.Model, "-official")
+		form.Official = true
+	}
+
+	if err := checkModeration(db, user, form.Model, messages, ModerationSourceRelay); err != nil {
+		sendErrorResponse(c, err, "moderation_error")
+		return
+	}
+
+	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	if check != nil {
+		sendErrorResponse(c, check, "quota_exceeded_error")
+		return
+	}
+
+	if form.Stream {
+		sendStreamResponsesResponse(c, form, history, messages, id, created, user, plan)
+	} else {
+		sendResponsesResponse(c, form, history, messages, id, created, user, plan)
+	}
+}
+
+func getResponsesForm(form RelayResponsesForm, id string, created int64, status string, output []ResponsesOutputItem, buffer *utils.Buffer) RelayResponsesResponse {
+	resp := RelayResponsesResponse{
+		Id:                 fmt.Sprintf("resp_%s", id),
+		Object:             "response",
+		CreatedAt:          created,
+		Status:             status,
+		Model:              form.Model,
+		Output:             output,
+		Instructions:       form.Instructions,
+		PreviousResponseId: form.PreviousResponseId,
+	}
+
+	if status == ResponsesStatusCompleted {
+		resp.Usage = getResponsesUsage(buffer)
+		resp.Quota = utils.Multi[*float32](form.Official, nil, utils.ToPtr(buffer.GetQuota()))
+	}
+
+	return resp
+}
+
+// storeResponses stores the conversation (with the assistant output) for the `previous_response_id` chaining
+func storeResponses(cache *redis.Client, form RelayResponsesForm, username string, id string, history []globals.Message, text string, tools *globals.ToolCalls) {
+	if form.Store != nil && !*form.Store {
+		return
+	}
+
+	setResponsesHistory(cache, username, fmt.Sprintf("resp_%s", id), append(history, globals.Message{
+		Role:      globals.Assistant,
+		Content:   text,
+		ToolCalls: tools,
+	}))
+}
+
+func sendResponsesResponse(c *gin.Context, form RelayResponsesForm, history []globals.Message, messages []globals.Message, id string, created int64, user *auth.User, plan bool) {
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
+	hit, err := channel.NewChatRequestWithCache(c.Request.Context(), cache, buffer, auth.GetGroup(db, user), getResponsesProps(form, messages, buffer, user, c), func(data *globals.Chunk) error {
+		buffer.WriteChunk(data)
+		return nil
+	})
+
+	admin.AnalyseRequest(form.Model, buffer, err)
+	if err != nil {
+		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+		globals.Warn(fmt.Sprintf("error from responses request api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+
+		sendErrorResponse(c, err)
+		return
+	}
+
+	if !hit {
+		CollectQuota(c, user, buffer, plan, err)
+	}
+
+	tools := buffer.GetToolCalls()
+	storeResponses(cache, form, user.Username, id, history, buffer.Read(), tools)
+
+	c.JSON(http.StatusOK, getResponsesForm(form, id, created, ResponsesStatusCompleted, getResponsesOutput(id, buffer.Read(), tools), buffer))
+}
+
+// responsesStream converts the chat chunks to the responses semantic events
+type responsesStream struct {
+	Id       string
+	Sequence int
+	Items    []ResponsesOutputItem
+	Opened   bool
+	ToolIdx  int
+	Events   []utils.StreamEvent
+}
+
+func (s *responsesStream) emit(event string, data gin.H) {
+	data["type"] = event
+	data["sequence_number"] = s.Sequence
+	s.Sequence++
+
+	s.Events = append(s.Events, utils.NewNamedEvent(event, data))
+}
+
+func (s *responsesStream) current() *ResponsesOutputItem {
+	return &s.Items[len(s.Items)-1]
+}
+
+func (s *responsesStream) stop() {
+	if !s.Opened {
+		return
+	}
+
+	index := len(s.Items) - 1
+	item := s.current()
+	item.Status = ResponsesStatusCompleted
+
+	switch item.Type {
+	case "message":
+		part := (*item.Content)[0]
+		s.emit("response.output_text.done", gin.H{
+			"item_id":       item.Id,
+			"output_index":  index,
+			"content_index": 0,
+			"text":          part.Text,
+		})
+		s.emit("response.content_part.done", gin.H{
+			"item_id":       item.Id,
+			"output_index":  index,
+			"content_index": 0,
+			"part":          part,
+		})
+	case "function_call":
+		s.emit("response.function_call_arguments.done", gin.H{
+			"item_id":      item.Id,
+			"output_index": index,
+			"arguments":    utils.GetPtrVal(item.Arguments, ""),
+		})
+	}
+
+	s.emit("response.output_item.done", gin.H{
+		"output_index": index,
+		"item":         *item,
+	})
+	s.Opened = false
+}
+
+func (s *responsesStream) start(item ResponsesOutputItem) {
+	s.stop()
+
+	s.Items = append(s.Items, item)
+	s.Opened = true
+	s.emit("response.output_item.added", gin.H{
+		"output_index": len(s.Items) - 1,
+		"item":         item,
+	})
+}
+
+// Write converts the chunk to the events and returns the pending events
+func (s *responsesStream) Write(data *globals.Chunk) []utils.StreamEvent {
+	s.Events = nil
+
+	if len(data.Content) > 0 {
+		if !s.Opened || s.current().Type != "message" {
+			s.start(ResponsesOutputItem{
+				Type:    "message",
+				Id:      fmt.Sprintf("msg_%s", s.Id),
+				Status:  ResponsesStatusInProgress,
+				Role:    globals.Assistant,
+				Content: &[]ResponsesOutputContent{},
+			})
+
+			part := ResponsesOutputContent{Type: "output_text", Annotations: []interface{}{}}
+			*s.current().Content = append(*s.current().Content, part)
+			s.emit("response.content_part.added", gin.H{
+				"item_id":       s.current().Id,
+				"output_index":  len(s.Items) - 1,
+				"content_index": 0,
+				"part":          part,
+			})
+		}
+
+		(*s.current().Content)[0].Text += data.Content
+		s.emit("response.output_text.delta", gin.H{
+			"item_id":       s.current().Id,
+			"output_index":  len(s.Items) - 1,
+			"content_index": 0,
+			"delta":         data.Content,
+		})
+	}
+
+	if data.ToolCall != nil {
+		for i, call := range *data.ToolCall {
+			idx := utils.GetPtrVal(call.Index, i)
+			if !s.Opened || s.current().Type != "function_call" || s.ToolIdx != idx {
+				s.start(ResponsesOutputItem{
+					Type:      "function_call",
+					Id:        fmt.Sprintf("fc_%s_%d", s.Id, idx),
+					Status:    ResponsesStatusInProgress,
+					CallId:    call.Id,
+					Name:      call.Function.Name,
+					Arguments: utils.ToPtr(""),
+				})
+				s.ToolIdx = idx
+			}
+
+			if len(call.Function.Arguments) > 0 {
+				*s.current().Arguments += call.Function.Arguments
+				s.emit("response.function_call_arguments.delta", gin.H{
+					"item_id":      s.current().Id,
+					"output_index": len(s.Items) - 1,
+					"delta":        call.Function.Arguments,
+				})
+			}
+		}
+	}
+
+	return s.Events
+}
+
+type responsesPartial struct {
+	Events []utils.StreamEvent
+	Error  error
+}
+
+func sendStreamResponsesResponse(c *gin.Context, form RelayResponsesForm, history []globals.Message, messages []globals.Message, id string, created int64, user *auth.User, plan bool) {
+	partial := make(chan responsesPartial)
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+
+	group := auth.GetGroup(db, user)
+	charge := channel.ChargeInstance.GetCharge(form.Model)
+
+	relay := newRelayStream(c)
+	defer relay.wait()
+
+	relay.run(func(ctx context.Context) {
+		defer close(partial)
+
+		buffer := utils.NewBuffer(form.Model, messages, charge)
+		stream := &responsesStream{Id: id, Items: []ResponsesOutputItem{}}
+
+		initial := getResponsesForm(form, id, created, ResponsesStatusInProgress, []ResponsesOutputItem{}, buffer)
+		stream.emit("response.created", gin.H{"response": initial})
+		stream.emit("response.in_progress", gin.H{"response": initial})
+		sendPartial(ctx, partial, responsesPartial{Events: stream.Events})
+
+		hit, err := channel.NewChatRequestWithCache(
+			ctx, cache, buffer, group, getResponsesProps(form, messages, buffer, user, c),
+			func(data *globals.Chunk) error {
+				buffer.WriteChunk(data)
+
+				if !data.IsEmpty() && !sendPartial(ctx, partial, responsesPartial{Events: stream.Write(data)}) {
+					return ctx.Err()
+				}
+				return nil
+			},
+		)
+
+		admin.AnalyseRequest(form.Model, buffer, err)
+		if adapter.IsCanceledError(err) {
+			// the client is gone, only the produced tokens are billed
+			CollectQuota(c, user, buffer, plan, nil)
+			return
+		}
+
+		if err != nil {
+			if adapter.IsPartialError(err) {
+				// the stream is failed halfway without retrying, the content delivered to the client is billed
+				CollectQuota(c, user, buffer, plan, nil)
+			} else {
+				auth.RevertSubscriptionUsage(db, cache, user, form.Model)
+			}
+			globals.Warn(fmt.Sprintf("error from responses request api: %s (instance: %s, client: %s)", err.Error(), form.Model, c.ClientIP()))
+			sendPartial(ctx, partial, responsesPartial{Error: err})
+			return
+		}
+
+		stream.Events = nil
+		stream.stop()
+		stream.emit("response.completed", gin.H{
+			"response": getResponsesForm(form, id, created, ResponsesStatusCompleted, stream.Items, buffer),
+		})
+		sendPartial(ctx, partial, responsesPartial{Events: stream.Events})
+
+		if !hit {
+			CollectQuota(c, user, buffer, plan, err)
+		}
+
+		storeResponses(cache, form, user.Username, id, history, buffer.Read(), buffer.GetToolCalls())
+	})
+
+	c.Stream(func(w io.Writer) bool {
+		if resp, ok := receive(relay, c, partial); ok {
+			if resp.Error != nil {
+				c.Render(-1, utils.NewNamedEvent("error", gin.H{
+					"type":    "error",
+					"code":    "chatnio_api_error",
+					"message": resp.Error.Error(),
+				}))
+				return false
+			}
+
+			for _, event := range resp.Events {
+				c.Render(-1, event)
+			}
+			return true
+		}
+
+		return false
+	})
+}
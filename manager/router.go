@@ -9,15 +9,40 @@ import (
 func Register(app *gin.RouterGroup) {
 	app.GET("/chat", ChatAPI)
 	app.GET("/v1/models", ModelAPI)
+	app.GET("/v1/models/*id", ModelDetailAPI)
 	app.GET("/v1/market", MarketAPI)
 	app.GET("/v1/charge", ChargeAPI)
 	app.GET("/v1/plans", PlanAPI)
 	app.GET("/dashboard/billing/usage", GetBillingUsage)
 	app.GET("/dashboard/billing/subscription", GetSubscription)
 	app.POST("/v1/chat/completions", ChatRelayAPI)
+	app.POST("/v1/completions", CompletionsRelayAPI)
+	app.POST("/v1/responses", ResponsesRelayAPI)
+	app.POST("/v1/messages", MessagesRelayAPI)
+	app.POST("/v1beta/models/:model", GeminiRelayAPI)
+	app.POST("/v1/embeddings", EmbeddingsRelayAPI)
+	app.POST("/v1/moderations", ModerationsRelayAPI)
+	app.POST("/v1/audio/transcriptions", AudioTranscriptionsRelayAPI)
+	app.POST("/v1/audio/translations", AudioTranslationsRelayAPI)
+	app.POST("/v1/audio/speech", AudioSpeechRelayAPI)
 	app.POST("/v1/images/generations", ImagesRelayAPI)
+	app.POST("/v1/images/edits", ImagesEditsRelayAPI)
+	app.POST("/v1/images/variations", ImagesVariationsRelayAPI)
 	app.POST("/v1/videos", VideosRelayAPI)
+	app.GET("/v1/videos", VideosListRelayAPI)
+	app.GET("/v1/videos/:id", VideosRetrieveRelayAPI)
+	app.DELETE("/v1/videos/:id", VideosDeleteRelayAPI)
+	app.POST("/v1/videos/:id/remix", VideosRemixRelayAPI)
 	app.GET("/v1/videos/:id/content", VideosContentRelayAPI)
+	app.POST("/v1/files", FilesUploadRelayAPI)
+	app.GET("/v1/files", FilesListRelayAPI)
+	app.GET("/v1/files/:id", FilesRetrieveRelayAPI)
+	app.DELETE("/v1/files/:id", FilesDeleteRelayAPI)
+	app.GET("/v1/files/:id/content", FilesContentRelayAPI)
+	app.POST("/v1/batches", BatchesCreateRelayAPI)
+	app.GET("/v1/batches", BatchesListRelayAPI)
+	app.GET("/v1/batches/:id", BatchesRetrieveRelayAPI)
+	app.POST("/v1/batches/:id/cancel", BatchesCancelRelayAPI)
 
 	broadcast.Register(app)
 }
@@ -1,9 +1,9 @@
 package manager
 
 import (
+	adaptercommon "chat/adapter/common"
 	"chat/globals"
 	"chat/utils"
-	"fmt"
 )
 
 type Message struct {
@@ -13,6 +13,9 @@ type Message struct {
 	FunctionCall *globals.FunctionCall `json:"function_call,omitempty"` // only `function` role
 	ToolCallId   *string               `json:"tool_call_id,omitempty"`  // only `tool` role
 	ToolCalls    *globals.ToolCalls    `json:"tool_calls,omitempty"`    // only `assistant` role
+
+	ReasoningContent *string               `json:"reasoning_content,omitempty"` // only stream delta of the reasoning models
+	CacheControl     *globals.CacheControl `json:"cache_control,omitempty"`     // prompt caching breakpoint of the message
 }
 
 type ImageUrl struct {
@@ -21,9 +24,10 @@ type ImageUrl struct {
 }
 
 type MessageContent struct {
-	Type     string    `json:"type"`
-	Text     *string   `json:"text,omitempty"`
-	ImageUrl *ImageUrl `json:"image_url,omitempty"`
+	Type         string                `json:"type"`
+	Text         *string               `json:"text,omitempty"`
+	ImageUrl     *ImageUrl             `json:"image_url,omitempty"`
+	CacheControl *globals.CacheControl `json:"cache_control,omitempty"`
 }
 
 type MessageContents []MessageContent
@@ -41,13 +45,35 @@ type RelayForm struct {
 	TopK              *int      `json:"top_k"`
 	Tools             *globals.FunctionTools
 	ToolChoice        *interface{}
-	Official          bool `json:"official"`
+	ParallelToolCalls *bool                 `json:"parallel_tool_calls"`
+	ResponseFormat    *interface{}          `json:"response_format"` // text, json_object or json_schema
+	Stop              interface{}           `json:"stop"`            // string or []string
+	Seed              *int                  `json:"seed"`
+	N                 *int                  `json:"n"`
+	LogitBias         map[string]float32    `json:"logit_bias"`
+	Logprobs          *bool                 `json:"logprobs"`
+	TopLogprobs       *int                  `json:"top_logprobs"`
+	StreamOptions     *RelayStreamOptions   `json:"stream_options"`
+	ReasoningEffort   *string               `json:"reasoning_effort"` // low, medium or high
+	Thinking          *RelayThinking        `json:"thinking"`         // claude extended thinking
+	CacheControl      *globals.CacheControl `json:"cache_control"`    // prompt caching breakpoint of the tools and system prompt
+	Official          bool                  `json:"official"`
+}
+
+type RelayThinking struct {
+	Type         string `json:"type"` // enabled or disabled
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type RelayStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // emit a final usage-only chunk before [DONE]
 }
 
 type Choice struct {
-	Index        int             `json:"index"`
-	Message      globals.Message `json:"message"`
-	FinishReason string          `json:"finish_reason"`
+	Index        int                     `json:"index"`
+	Message      globals.Message         `json:"message"`
+	FinishReason string                  `json:"finish_reason"`
+	Logprobs     *globals.ChoiceLogprobs `json:"logprobs,omitempty"`
 }
 
 type StreamMessage struct {
@@ -60,9 +86,19 @@ type StreamMessage struct {
 }
 
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+}
+
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
 }
 
 type RelayResponse struct {
@@ -76,9 +112,10 @@ type RelayResponse struct {
 }
 
 type ChoiceDelta struct {
-	Index        int         `json:"index"`
-	Delta        Message     `json:"delta"`
-	FinishReason interface{} `json:"finish_reason"`
+	Index        int                     `json:"index"`
+	Delta        Message                 `json:"delta"`
+	FinishReason interface{}             `json:"finish_reason"`
+	Logprobs     *globals.ChoiceLogprobs `json:"logprobs,omitempty"`
 }
 
 type RelayStreamResponse struct {
@@ -92,6 +129,43 @@ type RelayStreamResponse struct {
 	Error   error         `json:"error,omitempty"`
 }
 
+type RelayCompletionForm struct {
+	Model            string              `json:"model" binding:"required"`
+	Prompt           interface{}         `json:"prompt" binding:"required"` // string or []string
+	Suffix           *string             `json:"suffix"`
+	Echo             bool                `json:"echo"`
+	Stream           bool                `json:"stream"`
+	MaxTokens        *int                `json:"max_tokens"`
+	PresencePenalty  *float32            `json:"presence_penalty"`
+	FrequencyPenalty *float32            `json:"frequency_penalty"`
+	Temperature      *float32            `json:"temperature"`
+	TopP             *float32            `json:"top_p"`
+	Stop             interface{}         `json:"stop"` // string or []string
+	Seed             *int                `json:"seed"`
+	N                *int                `json:"n"`
+	LogitBias        map[string]float32  `json:"logit_bias"`
+	StreamOptions    *RelayStreamOptions `json:"stream_options"`
+	Official         bool                `json:"official"`
+}
+
+type CompletionChoice struct {
+	Text         string      `json:"text"`
+	Index        int         `json:"index"`
+	Logprobs     interface{} `json:"logprobs"`
+	FinishReason interface{} `json:"finish_reason"`
+}
+
+type RelayCompletionResponse struct {
+	Id      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
+	Quota   *float32           `json:"quota,omitempty"`
+	Error   error              `json:"-"`
+}
+
 type RelayErrorResponse struct {
 	Error TranshipmentError `json:"error"`
 }
@@ -99,17 +173,24 @@ type RelayErrorResponse struct {
 type TranshipmentError struct {
 	Message string `json:"message"`
 	Type    string `json:"type"`
+	Param   string `json:"param,omitempty"`
+	Code    string `json:"code,omitempty"`
 }
 
 type RelayImageForm struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-	N      *int   `json:"n,omitempty"`
+	Model          string  `json:"model"`
+	Prompt         string  `json:"prompt"`
+	N              *int    `json:"n,omitempty"`
+	Size           *string `json:"size,omitempty"`
+	Quality        *string `json:"quality,omitempty"`
+	Style          *string `json:"style,omitempty"`
+	ResponseFormat *string `json:"response_format,omitempty"` // url or b64_json
 }
 
 type RelayImageData struct {
-	Url     string `json:"url,omitempty"`
-	B64Json string `json:"b64_json,omitempty"`
+	Url           string `json:"url,omitempty"`
+	B64Json       string `json:"b64_json,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
 }
 
 type RelayImageResponse struct {
@@ -117,6 +198,325 @@ type RelayImageResponse struct {
 	Data    []RelayImageData `json:"data"`
 }
 
+type RelayModerationForm struct {
+	Model string      `json:"model"`
+	Input interface{} `json:"input" binding:"required"` // string, string array or multimodal content array
+}
+
+type RelayModerationResponse struct {
+	Id      string                           `json:"id"`
+	Model   string                           `json:"model"`
+	Results []adaptercommon.ModerationResult `json:"results"`
+}
+
+type RelayEmbeddingForm struct {
+	Model          string      `json:"model" binding:"required"`
+	Input          interface{} `json:"input" binding:"required"`
+	EncodingFormat *string     `json:"encoding_format,omitempty"`
+	Dimensions     *int        `json:"dimensions,omitempty"`
+	User           *string     `json:"user,omitempty"`
+}
+
+type RelayEmbeddingData struct {
+	Object    string      `json:"object"`
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"`
+}
+
+type RelayEmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type RelayEmbeddingResponse struct {
+	Object string               `json:"object"`
+	Data   []RelayEmbeddingData `json:"data"`
+	Model  string               `json:"model"`
+	Usage  RelayEmbeddingUsage  `json:"usage"`
+	Quota  *float32             `json:"quota,omitempty"`
+}
+
+type RelaySpeechForm struct {
+	Model          string   `json:"model" binding:"required"`
+	Input          string   `json:"input" binding:"required"`
+	Voice          string   `json:"voice"`
+	ResponseFormat *string  `json:"response_format,omitempty"`
+	Speed          *float32 `json:"speed,omitempty"`
+}
+
+// anthropic messages api compatible types
+
+type MessagesImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+}
+
+type MessagesContentBlock struct {
+	Type      string               `json:"type"`
+	Text      string               `json:"text,omitempty"`
+	Source    *MessagesImageSource `json:"source,omitempty"`
+	Id        string               `json:"id,omitempty"`
+	Name      string               `json:"name,omitempty"`
+	Input     interface{}          `json:"input,omitempty"`
+	ToolUseId string               `json:"tool_use_id,omitempty"`
+	Content   interface{}          `json:"content,omitempty"`
+	IsError   bool                 `json:"is_error,omitempty"`
+
+	CacheControl *globals.CacheControl `json:"cache_control,omitempty"`
+}
+
+type MessagesMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type MessagesTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"input_schema"`
+
+	CacheControl *globals.CacheControl `json:"cache_control,omitempty"`
+}
+
+type MessagesToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type RelayMessagesForm struct {
+	Model         string              `json:"model" binding:"required"`
+	Messages      []MessagesMessage   `json:"messages" binding:"required"`
+	System        interface{}         `json:"system"`
+	MaxTokens     *int                `json:"max_tokens"`
+	Temperature   *float32            `json:"temperature"`
+	TopP          *float32            `json:"top_p"`
+	TopK          *int                `json:"top_k"`
+	StopSequences []string            `json:"stop_sequences"`
+	Stream        bool                `json:"stream"`
+	Tools         []MessagesTool      `json:"tools"`
+	ToolChoice    *MessagesToolChoice `json:"tool_choice"`
+	Thinking      *RelayThinking      `json:"thinking"`
+	Official      bool                `json:"official"`
+}
+
+type MessagesUsage struct {
+	InputTokens              int `json:"input_tokens"` // excludes the cached tokens
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type RelayMessagesResponse struct {
+	Id           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	Role         string                 `json:"role"`
+	Model        string                 `json:"model"`
+	Content      []MessagesContentBlock `json:"content"`
+	StopReason   *string                `json:"stop_reason"`
+	StopSequence *string                `json:"stop_sequence"`
+	Usage        MessagesUsage          `json:"usage"`
+	Quota        *float32               `json:"quota,omitempty"`
+}
+
+type MessagesErrorResponse struct {
+	Type  string            `json:"type"`
+	Error TranshipmentError `json:"error"`
+}
+
+// gemini generateContent api compatible types
+
+type GeminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type GeminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileUri  string `json:"fileUri"`
+}
+
+type GeminiFunctionCall struct {
+	Name string      `json:"name"`
+	Args interface{} `json:"args"`
+}
+
+type GeminiFunctionResponse struct {
+	Name     string      `json:"name"`
+	Response interface{} `json:"response"`
+}
+
+type GeminiPart struct {
+	Text             *string                 `json:"text,omitempty"`
+	InlineData       *GeminiInlineData       `json:"inlineData,omitempty"`
+	InlineDataSnake  *GeminiInlineData       `json:"inline_data,omitempty"`
+	FileData         *GeminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []GeminiPart `json:"parts"`
+}
+
+type GeminiGenerationConfig struct {
+	Temperature      *float32 `json:"temperature"`
+	TopP             *float32 `json:"topP"`
+	TopK             *int     `json:"topK"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens"`
+	PresencePenalty  *float32 `json:"presencePenalty"`
+	FrequencyPenalty *float32 `json:"frequencyPenalty"`
+	StopSequences    []string `json:"stopSequences"`
+	Seed             *int     `json:"seed"`
+}
+
+type GeminiFunctionDeclaration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  interface{} `json:"parameters"`
+}
+
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type GeminiToolConfig struct {
+	FunctionCallingConfig *struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames"`
+	} `json:"functionCallingConfig"`
+}
+
+type RelayGeminiForm struct {
+	Contents          []GeminiContent         `json:"contents" binding:"required"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig"`
+	Tools             []GeminiTool            `json:"tools"`
+	ToolConfig        *GeminiToolConfig       `json:"toolConfig"`
+}
+
+type GeminiCandidate struct {
+	Content      GeminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+	Index        int           `json:"index"`
+}
+
+type GeminiUsageMetadata struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type RelayGeminiResponse struct {
+	Candidates    []GeminiCandidate    `json:"candidates"`
+	UsageMetadata *GeminiUsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion  string               `json:"modelVersion"`
+	Quota         *float32             `json:"quota,omitempty"`
+}
+
+type GeminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+type GeminiErrorResponse struct {
+	Error GeminiError `json:"error"`
+}
+
+// openai responses api compatible types
+
+type ResponsesContentPart struct {
+	Type     string      `json:"type"`
+	Text     string      `json:"text,omitempty"`
+	ImageUrl interface{} `json:"image_url,omitempty"` // string or object
+	Detail   *string     `json:"detail,omitempty"`    // only `input_image` type
+	FileId   *string     `json:"file_id,omitempty"`   // only `input_file` type
+	FileData *string     `json:"file_data,omitempty"` // only `input_file` type
+	Filename *string     `json:"filename,omitempty"`  // only `input_file` type
+}
+
+type ResponsesInputItem struct {
+	Type      string      `json:"type"`
+	Role      string      `json:"role"`
+	Content   interface{} `json:"content"`
+	CallId    string      `json:"call_id"`
+	Name      string      `json:"name"`
+	Arguments string      `json:"arguments"`
+	Output    interface{} `json:"output"`
+}
+
+type ResponsesTool struct {
+	Type        string      `json:"type"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Parameters  interface{} `json:"parameters"`
+}
+
+type RelayResponsesForm struct {
+	Model              string              `json:"model" binding:"required"`
+	Input              interface{}         `json:"input" binding:"required"`
+	Instructions       *string             `json:"instructions"`
+	PreviousResponseId *string             `json:"previous_response_id"`
+	Stream             bool                `json:"stream"`
+	MaxOutputTokens    *int                `json:"max_output_tokens"`
+	Temperature        *float32            `json:"temperature"`
+	TopP               *float32            `json:"top_p"`
+	Tools              []ResponsesTool     `json:"tools"`
+	ToolChoice         interface{}         `json:"tool_choice"`
+	Store              *bool               `json:"store"`
+	Reasoning          *ResponsesReasoning `json:"reasoning"`
+	Official           bool                `json:"official"`
+}
+
+type ResponsesReasoning struct {
+	Effort *string `json:"effort"` // low, medium or high
+}
+
+type ResponsesOutputContent struct {
+	Type        string        `json:"type"`
+	Text        string        `json:"text"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+type ResponsesOutputItem struct {
+	Type      string                    `json:"type"`
+	Id        string                    `json:"id"`
+	Status    string                    `json:"status"`
+	Role      string                    `json:"role,omitempty"`
+	Content   *[]ResponsesOutputContent `json:"content,omitempty"`
+	CallId    string                    `json:"call_id,omitempty"`
+	Name      string                    `json:"name,omitempty"`
+	Arguments *string                   `json:"arguments,omitempty"`
+}
+
+type ResponsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type RelayResponsesResponse struct {
+	Id                 string                `json:"id"`
+	Object             string                `json:"object"`
+	CreatedAt          int64                 `json:"created_at"`
+	Status             string                `json:"status"`
+	Model              string                `json:"model"`
+	Output             []ResponsesOutputItem `json:"output"`
+	Instructions       *string               `json:"instructions"`
+	PreviousResponseId *string               `json:"previous_response_id"`
+	Usage              *ResponsesUsage       `json:"usage"`
+	Quota              *float32              `json:"quota,omitempty"`
+}
+
+// ResponsesStore is the stored conversation of the response for the `previous_response_id` chaining
+type ResponsesStore struct {
+	Username string                  `json:"username"`
+	Messages []globals.StoredMessage `json:"messages"`
+}
+
 type RelayVideoForm struct {
 	Model          string  `json:"model"`
 	Prompt         string  `json:"prompt" binding:"required"`
@@ -146,27 +546,158 @@ type RelayVideoJob struct {
 	Status             string           `json:"status"`
 }
 
+type RelayVideoRemixForm struct {
+	Prompt string `json:"prompt" binding:"required"`
+}
+
+type RelayVideoJobList struct {
+	Object  string          `json:"object"`
+	Data    []RelayVideoJob `json:"data"`
+	FirstId *string         `json:"first_id"`
+	LastId  *string         `json:"last_id"`
+	HasMore bool            `json:"has_more"`
+}
+
+type RelayVideoDeleted struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+type RelayFile struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+type RelayFileList struct {
+	Object  string      `json:"object"`
+	Data    []RelayFile `json:"data"`
+	FirstId *string     `json:"first_id"`
+	LastId  *string     `json:"last_id"`
+	HasMore bool        `json:"has_more"`
+}
+
+type RelayFileDeleted struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+type RelayBatchForm struct {
+	InputFileId      string            `json:"input_file_id" binding:"required"`
+	Endpoint         string            `json:"endpoint" binding:"required"`
+	CompletionWindow string            `json:"completion_window" binding:"required"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+type RelayBatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type RelayBatchError struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Param   *string `json:"param"`
+	Line    *int    `json:"line"`
+}
+
+type RelayBatchErrors struct {
+	Object string            `json:"object"`
+	Data   []RelayBatchError `json:"data"`
+}
+
+type RelayBatch struct {
+	Id               string                  `json:"id"`
+	Object           string                  `json:"object"`
+	Endpoint         string                  `json:"endpoint"`
+	Errors           *RelayBatchErrors       `json:"errors"`
+	InputFileId      string                  `json:"input_file_id"`
+	CompletionWindow string                  `json:"completion_window"`
+	Status           string                  `json:"status"`
+	OutputFileId     *string                 `json:"output_file_id"`
+	ErrorFileId      *string                 `json:"error_file_id"`
+	CreatedAt        int64                   `json:"created_at"`
+	InProgressAt     *int64                  `json:"in_progress_at"`
+	ExpiresAt        *int64                  `json:"expires_at"`
+	FinalizingAt     *int64                  `json:"finalizing_at"`
+	CompletedAt      *int64                  `json:"completed_at"`
+	FailedAt         *int64                  `json:"failed_at"`
+	ExpiredAt        *int64                  `json:"expired_at"`
+	CancellingAt     *int64                  `json:"cancelling_at"`
+	CancelledAt      *int64                  `json:"cancelled_at"`
+	RequestCounts    RelayBatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string       `json:"metadata"`
+}
+
+type RelayBatchList struct {
+	Object  string       `json:"object"`
+	Data    []RelayBatch `json:"data"`
+	FirstId *string      `json:"first_id"`
+	LastId  *string      `json:"last_id"`
+	HasMore bool         `json:"has_more"`
+}
+
+// BatchRequestLine is the line of the batch input file
+type BatchRequestLine struct {
+	CustomId string     `json:"custom_id"`
+	Method   string     `json:"method"`
+	Url      string     `json:"url"`
+	Body     *RelayForm `json:"body"`
+}
+
+type BatchResponse struct {
+	StatusCode int         `json:"status_code"`
+	RequestId  string      `json:"request_id"`
+	Body       interface{} `json:"body"`
+}
+
+// BatchResponseLine is the line of the batch output file (and the error file for the failed requests)
+type BatchResponseLine struct {
+	Id       string             `json:"id"`
+	CustomId string             `json:"custom_id"`
+	Response *BatchResponse     `json:"response"`
+	Error    *TranshipmentError `json:"error"`
+}
+
+// getMultimodalParts returns the content parts, nil if they only have the text parts (which are kept as the string content)
+func getMultimodalParts(parts []globals.ContentPart) []globals.ContentPart {
+	for _, part := range parts {
+		if part.Type != globals.ContentTypeText {
+			return parts
+		}
+	}
+
+	return nil
+}
+
+// transformParts returns the typed content parts of the content, nil if the content is the plain string
+func transformParts(content interface{}) []globals.ContentPart {
+	switch content.(type) {
+	case nil, string:
+		return nil
+	}
+
+	if parts := utils.MapToStruct[[]globals.ContentPart](content); parts != nil {
+		return getMultimodalParts(*parts)
+	}
+	return nil
+}
+
 func transformContent(content interface{}) string {
 	switch v := content.(type) {
 	case string:
 		return v
 	default:
-		var result string
-		data := utils.MapToStruct[MessageContents](v)
-		if data == nil || len(*data) == 0 {
-			return ""
-		}
-
-		for _, v := range *data {
-			if v.Text != nil {
-				result += *v.Text
-			}
-
-			if v.ImageUrl != nil {
-				result += fmt.Sprintf(" %s ", v.ImageUrl.Url)
-			}
+		if parts := utils.MapToStruct[[]globals.ContentPart](v); parts != nil {
+			return globals.GetPartsContent(*parts)
 		}
-		return result
+		return ""
 	}
 }
 
@@ -176,11 +707,34 @@ func transform(m []Message) []globals.Message {
 		messages = append(messages, globals.Message{
 			Role:         v.Role,
 			Content:      transformContent(v.Content),
+			Parts:        transformParts(v.Content),
 			Name:         v.Name,
 			FunctionCall: v.FunctionCall,
 			ToolCallId:   v.ToolCallId,
 			ToolCalls:    v.ToolCalls,
+			CacheControl: transformCacheControl(v),
 		})
 	}
 	return messages
 }
+
+// transformCacheControl returns the cache breakpoint of the message or its last content part
+func transformCacheControl(message Message) *globals.CacheControl {
+	if message.CacheControl != nil {
+		return message.CacheControl
+	}
+
+	if _, ok := message.Content.(string); ok {
+		return nil
+	}
+
+	var cache *globals.CacheControl
+	if data := utils.MapToStruct[MessageContents](message.Content); data != nil {
+		for _, content := range *data {
+			if content.CacheControl != nil {
+				cache = content.CacheControl
+			}
+		}
+	}
+	return cache
+}
@@ -0,0 +1,383 @@
+package manager
+
+import (
+	adaptercommon "chat/adapter/common"
+	"chat/auth"
+	"chat/channel"
+	"chat/globals"
+	"chat/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	VideoStatusCompleted = "completed"
+	VideoStatusFailed    = "failed"
+
+	defaultVideoListLimit = 20
+	maxVideoListLimit     = 100
+)
+
+// checkVideoRelayState is the relay state check of the video job apis, the web token is also allowed
+func checkVideoRelayState(c *gin.Context) string {
+	if globals.CloseRelay {
+		abortWithErrorResponse(c, globals.NewPermissionError("relay api is denied of access"))
+		return ""
+	}
+
+	username := utils.GetUserFromContext(c)
+	if username == "" {
+		abortWithErrorResponse(c, globals.NewAuthenticationError("access denied for invalid api key"))
+		return ""
+	}
+
+	if agent := utils.GetAgentFromContext(c); agent != "api" && agent != "token" {
+		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "authentication_error")
+		return ""
+	}
+
+	return username
+}
+
+func getVideoIdParam(c *gin.Context) string {
+	id := strings.TrimSpace(c.Param("id"))
+	if id == "" {
+		abortWithErrorResponse(c, globals.NewInvalidRequestError("id", "video id is required"))
+	}
+
+	return id
+}
+
+func newVideoNotFoundError(id string) *globals.RelayError {
+	return globals.NewRelayError(http.StatusNotFound, "invalid_request_error", "video_not_found", fmt.Sprintf("cannot find video job for video id %s", id))
+}
+
+// saveVideoJob stores the video job of the user, the stored job is updated if it already exists
+func saveVideoJob(db *sql.DB, userId int64, job *RelayVideoJob) {
+	var count int
+	if err := globals.QueryRowDb(db, `
+		SELECT COUNT(*) FROM video_job WHERE user_id = ? AND video_id = ?
+	`, userId, job.Id).Scan(&count); err != nil {
+		globals.Warn(fmt.Sprintf("[video] failed to query video job %s: %s", job.Id, err.Error()))
+		return
+	}
+
+	var err error
+	if count > 0 {
+		_, err = globals.ExecDb(db, `
+			UPDATE video_job SET model = ?, status = ?, data = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE user_id = ? AND video_id = ?
+		`, job.Model, job.Status, utils.Marshal(job), userId, job.Id)
+	} else {
+		_, err = globals.ExecDb(db, `
+			INSERT INTO video_job (user_id, video_id, model, status, data) VALUES (?, ?, ?, ?, ?)
+		`, userId, job.Id, job.Model, job.Status, utils.Marshal(job))
+	}
+
+	if err != nil {
+		globals.Warn(fmt.Sprintf("[video] failed to save video job %s: %s", job.Id, err.Error()))
+	}
+}
+
+// saveVideoJobChannel stores the channel which the video job is created with, the follow-up requests of the job are sent to it
+func saveVideoJobChannel(db *sql.DB, userId int64, id string, job *channel.VideoJobChannel) {
+	if _, err := globals.ExecDb(db, `
+		UPDATE video_job SET channel_id = ?, secret_fingerprint = ? WHERE user_id = ? AND video_id = ?
+	`, job.Id, job.Fingerprint, userId, id); err != nil {
+		globals.Warn(fmt.Sprintf("[video] failed to save channel of video job %s: %s", id, err.Error()))
+	}
+}
+
+func getVideoJobChannel(db *sql.DB, userId int64, id string) (*channel.VideoJobChannel, error) {
+	var channelId int
+	var fingerprint sql.NullString
+	if err := globals.QueryRowDb(db, `
+		SELECT channel_id, secret_fingerprint FROM video_job WHERE user_id = ? AND video_id = ?
+	`, userId, id).Scan(&channelId, &fingerprint); err != nil {
+		return nil, newVideoNotFoundError(id)
+	}
+
+	if channelId == 0 {
+		return nil, fmt.Errorf("cannot find the channel of video job %s", id)
+	}
+
+	return &channel.VideoJobChannel{Id: channelId, Fingerprint: fingerprint.String}, nil
+}
+
+func getVideoJob(db *sql.DB, userId int64, id string) (*RelayVideoJob, error) {
+	var data string
+	if err := globals.QueryRowDb(db, `
+		SELECT data FROM video_job WHERE user_id = ? AND video_id = ?
+	`, userId, id).Scan(&data); err != nil {
+		return nil, newVideoNotFoundError(id)
+	}
+
+	job, err := utils.UnmarshalString[RelayVideoJob](data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse video job for video id %s", id)
+	}
+
+	return &job, nil
+}
+
+// getVideoJobModel returns the model of the video job owned by the user,
+// the jobs created before the video job storage are looked up from the conversations
+func getVideoJobModel(db *sql.DB, userId int64, id string) (string, error) {
+	if job, err := getVideoJob(db, userId, id); err == nil {
+		return job.Model, nil
+	}
+
+	var model string
+	if err := globals.QueryRowDb(db, `
+		SELECT model FROM conversation WHERE user_id = ? AND task_id = ? LIMIT 1
+	`, userId, id).Scan(&model); err != nil {
+		return "", newVideoNotFoundError(id)
+	}
+
+	return model, nil
+}
+
+// getVideoJobs returns the video jobs of the user after the cursor and whether there are more jobs
+func getVideoJobs(db *sql.DB, userId int64, after string, limit int, asc bool) ([]RelayVideoJob, bool, error) {
+	var cursor int64
+	if after != "" {
+		if err := globals.QueryRowDb(db, `
+			SELECT id FROM video_job WHERE user_id = ? AND video_id = ?
+		`, userId, after).Scan(&cursor); err != nil {
+			return nil, false, newVideoNotFoundError(after).WithParam("after")
+		}
+	}
+
+	rows, err := globals.QueryDb(db, fmt.Sprintf(`
+		SELECT data FROM video_job
+		WHERE user_id = ? AND (? = 0 OR id %s ?)
+		ORDER BY id %s LIMIT ?
+	`, utils.Multi(asc, ">", "<"), utils.Multi(asc, "ASC", "DESC")), userId, cursor, cursor, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	jobs := make([]RelayVideoJob, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, false, err
+		}
+
+		if job, err := utils.UnmarshalString[RelayVideoJob](data); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+
+	if len(jobs) > limit {
+		return jobs[:limit], true, nil
+	}
+	return jobs, false, nil
+}
+
+func deleteVideoJob(db *sql.DB, userId int64, id string) error {
+	_, err := globals.ExecDb(db, `
+		DELETE FROM video_job WHERE user_id = ? AND video_id = ?
+	`, userId, id)
+	return err
+}
+
+func isVideoJobDone(job *RelayVideoJob) bool {
+	return job.Status == VideoStatusCompleted || job.Status == VideoStatusFailed
+}
+
+// requestVideoJob sends the follow-up request of the video job to the channel which the job is created with
+func requestVideoJob(db *sql.DB, userId int64, job *RelayVideoJob, request func(ch *channel.VideoJobChannel, props *adaptercommon.VideoJobProps) (string, error)) (string, error) {
+	ch, err := getVideoJobChannel(db, userId, job.Id)
+	if err != nil {
+		return "", err
+	}
+
+	return request(ch, &adaptercommon.VideoJobProps{
+		Model: job.Model,
+		Id:    job.Id,
+	})
+}
+
+func VideosListRelayAPI(c *gin.Context) {
+	username := checkVideoRelayState(c)
+	if username == "" {
+		return
+	}
+
+	limit := defaultVideoListLimit
+	if value := c.Query("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			limit = utils.Multi(n > maxVideoListLimit, maxVideoListLimit, n)
+		}
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+
+	jobs, more, err := getVideoJobs(db, user.GetID(db), c.Query("after"), limit, c.Query("order") == "asc")
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	list := RelayVideoJobList{
+		Object:  "list",
+		Data:    jobs,
+		HasMore: more,
+	}
+	if len(jobs) > 0 {
+		list.FirstId = &jobs[0].Id
+		list.LastId = &jobs[len(jobs)-1].Id
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func VideosRetrieveRelayAPI(c *gin.Context) {
+	username := checkVideoRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getVideoIdParam(c)
+	if id == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+	userId := user.GetID(db)
+
+	job, err := getVideoJob(db, userId, id)
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	if !isVideoJobDone(job) {
+		// refresh the status of the pending job from the channel it is created with, the stored job is returned on failure
+		data, err := requestVideoJob(db, userId, job, channel.NewVideoRetrieveRequest)
+		if err != nil {
+			globals.Warn(fmt.Sprintf("[video] failed to refresh video job %s: %s", id, err.Error()))
+		} else if current, err := utils.UnmarshalString[RelayVideoJob](data); err == nil && current.Id == id {
+			current.Model = job.Model
+			if current.RemixedFromVideoId == nil {
+				current.RemixedFromVideoId = job.RemixedFromVideoId
+			}
+
+			job = &current
+			saveVideoJob(db, userId, job)
+		}
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func VideosDeleteRelayAPI(c *gin.Context) {
+	username := checkVideoRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getVideoIdParam(c)
+	if id == "" {
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+	userId := user.GetID(db)
+
+	job, err := getVideoJob(db, userId, id)
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	// the upstream deletion is best-effort, the job is always removed from the user's jobs
+	if _, err := requestVideoJob(db, userId, job, func(ch *channel.VideoJobChannel, props *adaptercommon.VideoJobProps) (string, error) {
+		return "", channel.NewVideoDeleteRequest(ch, props)
+	}); err != nil {
+		globals.Warn(fmt.Sprintf("[video] failed to delete video job %s from upstream: %s", id, err.Error()))
+	}
+
+	if err := deleteVideoJob(db, userId, id); err != nil {
+		sendErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, RelayVideoDeleted{
+		Id:      id,
+		Object:  "video.deleted",
+		Deleted: true,
+	})
+}
+
+func VideosRemixRelayAPI(c *gin.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			stack := debug.Stack()
+			globals.Warn(fmt.Sprintf("caught panic from videos remix api: %s (client: %s)\n%s",
+				err, c.ClientIP(), stack,
+			))
+		}
+	}()
+
+	username := checkRelayState(c)
+	if username == "" {
+		return
+	}
+
+	id := getVideoIdParam(c)
+	if id == "" {
+		return
+	}
+
+	var form RelayVideoRemixForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		abortWithErrorResponse(c, fmt.Errorf("invalid request body: %s", err.Error()), "invalid_request_error")
+		return
+	}
+
+	prompt := strings.TrimSpace(form.Prompt)
+	if prompt == "" {
+		sendErrorResponse(c, globals.NewInvalidRequestError("prompt", "prompt is required"))
+		return
+	}
+
+	db := utils.GetDBFromContext(c)
+	user := &auth.User{Username: username}
+	userId := user.GetID(db)
+
+	job, err := getVideoJob(db, userId, id)
+	if err != nil {
+		sendErrorResponse(c, err, "invalid_request_error")
+		return
+	}
+
+	if job.Status != VideoStatusCompleted {
+		sendErrorResponse(c, globals.NewInvalidRequestError("id", "video job %s is not completed", id))
+		return
+	}
+
+	// the source job only exists at the channel it is created with
+	source, err := getVideoJobChannel(db, userId, id)
+	if err != nil {
+		sendErrorResponse(c, err)
+		return
+	}
+
+	createRelayVideoJob(c, username, adaptercommon.CreateVideoProps(&adaptercommon.VideoProps{
+		Model:        job.Model,
+		Prompt:       prompt,
+		RemixVideoId: &id,
+	}), source)
+}
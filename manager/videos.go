@@ -26,13 +26,13 @@ func VideosRelayAPI(c *gin.Context) {
 	}()
 
 	if globals.CloseRelay {
-		abortWithErrorResponse(c, fmt.Errorf("relay api is denied of access"), "access_denied_error")
+		abortWithErrorResponse(c, globals.NewPermissionError("relay api is denied of access"))
 		return
 	}
 
 	username := utils.GetUserFromContext(c)
 	if username == "" {
-		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid api key"), "authentication_error")
+		abortWithErrorResponse(c, globals.NewAuthenticationError("access denied for invalid api key"))
 		return
 	}
 
@@ -49,13 +49,8 @@ func VideosRelayAPI(c *gin.Context) {
 
 	prompt := strings.TrimSpace(form.Prompt)
 	if prompt == "" {
-		sendErrorResponse(c, fmt.Errorf("prompt is required"), "invalid_request_error")
-	}
-
-	db := utils.GetDBFromContext(c)
-	cache := utils.GetCacheFromContext(c)
-	user := &auth.User{
-		Username: username,
+		sendErrorResponse(c, globals.NewInvalidRequestError("prompt", "prompt is required"))
+		return
 	}
 
 	form.Model = strings.TrimSuffix(form.Model, "-official")
@@ -64,41 +59,62 @@ func VideosRelayAPI(c *gin.Context) {
 		form.Model = globals.Sora2
 	}
 
+	createRelayVideoJob(c, username, adaptercommon.CreateVideoProps(&adaptercommon.VideoProps{
+		Model:          form.Model,
+		Prompt:         prompt,
+		Seconds:        form.Seconds,
+		Size:           form.Size,
+		InputReference: form.InputReference,
+	}), nil)
+}
+
+// createRelayVideoJob creates (or remixes) the video job and stores it for the user,
+// the remix is sent to the channel which the source job is created with (source is nil for the new job)
+func createRelayVideoJob(c *gin.Context, username string, props *adaptercommon.VideoProps, source *channel.VideoJobChannel) {
+	db := utils.GetDBFromContext(c)
+	cache := utils.GetCacheFromContext(c)
+	user := &auth.User{
+		Username: username,
+	}
+
+	model := props.Model
 	messages := []globals.Message{
-		{Role: globals.User, Content: prompt},
+		{Role: globals.User, Content: props.Prompt},
 	}
-	check, plan := checkEnableState(db, cache, user, form.Model, messages)
+	check, plan := checkEnableState(db, cache, user, model, messages)
 	if check != nil {
 		sendErrorResponse(c, check, "quota_exceeded_error")
 		return
 	}
 
-	buffer := utils.NewBuffer(form.Model, messages, channel.ChargeInstance.GetCharge(form.Model))
+	buffer := utils.NewBuffer(model, messages, channel.ChargeInstance.GetCharge(model))
 	buffer.SetTokenName(globals.ApiTokenType)
 
-	props := adaptercommon.CreateVideoProps(&adaptercommon.VideoProps{
-		Model:          form.Model,
-		Prompt:         prompt,
-		Seconds:        form.Seconds,
-		Size:           form.Size,
-		InputReference: form.InputReference,
-	})
 	props.User = auth.GetUsernameString(db, user)
 
 	group := auth.GetGroup(db, user)
 
 	var jobJson string
-	hit, err := channel.NewVideoRequestWithCache(cache, buffer, group, props, func(data *globals.Chunk) error {
+	hook := func(data *globals.Chunk) error {
 		if data != nil {
 			jobJson = data.Content
 		}
 		return nil
-	})
+	}
+
+	var hit bool
+	var err error
+	owner := source
+	if source != nil {
+		err = channel.NewVideoRemixRequest(source, buffer, props, hook)
+	} else {
+		hit, owner, err = channel.NewVideoRequestWithCache(cache, buffer, group, props, hook)
+	}
 
-	analysis.AnalyseRequest(form.Model, props.User, buffer, err)
+	analysis.AnalyseRequest(model, props.User, buffer, err)
 	if err != nil {
-		auth.RevertSubscriptionUsage(db, cache, user, form.Model)
-		globals.Warn(fmt.Sprintf("error from video request api: %s (instance: %s, client: %s)", err, form.Model, c.ClientIP()))
+		auth.RevertSubscriptionUsage(db, cache, user, model)
+		globals.Warn(fmt.Sprintf("error from video request api: %s (instance: %s, client: %s)", err, model, c.ClientIP()))
 		sendErrorResponse(c, err)
 		return
 	}
@@ -113,8 +129,19 @@ func VideosRelayAPI(c *gin.Context) {
 		return
 	}
 
+	// the job is exposed with the requested model instead of the reflected one
+	job.Model = model
+	if job.RemixedFromVideoId == nil {
+		job.RemixedFromVideoId = props.RemixVideoId
+	}
+
 	if job.Id != "" {
 		userId := user.GetID(db)
+		saveVideoJob(db, userId, &job)
+		if owner != nil {
+			saveVideoJobChannel(db, userId, job.Id, owner)
+		}
+
 		var conversationId int64
 		err := globals.QueryRowDb(db, `
 			SELECT conversation_id
@@ -122,7 +149,7 @@ func VideosRelayAPI(c *gin.Context) {
 			WHERE user_id = ? AND model = ? AND (task_id IS NULL OR task_id = '')
 			ORDER BY updated_at DESC
 			LIMIT 1
-		`, userId, form.Model).Scan(&conversationId)
+		`, userId, model).Scan(&conversationId)
 		if err == nil && conversationId > 0 {
 			globals.Debug(fmt.Sprintf("[video] saving task_id %s to conversation %d for user %d", job.Id, conversationId, userId))
 			_, err := globals.ExecDb(db, `
@@ -159,91 +186,37 @@ func VideosContentRelayAPI(c *gin.Context) {
 		}
 	}()
 
-	if globals.CloseRelay {
-		abortWithErrorResponse(c, fmt.Errorf("relay api is denied of access"), "access_denied_error")
-		return
-	}
-
-	db := utils.GetDBFromContext(c)
-
-	username := utils.GetUserFromContext(c)
+	username := checkVideoRelayState(c)
 	if username == "" {
-		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid api key"), "authentication_error")
 		return
 	}
 
-	agent := utils.GetAgentFromContext(c)
-	if agent != "api" && agent != "token" {
-		abortWithErrorResponse(c, fmt.Errorf("access denied for invalid agent"), "authentication_error")
-		return
-	}
-
-	id := strings.TrimSpace(c.Param("id"))
+	id := getVideoIdParam(c)
 	if id == "" {
-		abortWithErrorResponse(c, fmt.Errorf("video id is required"), "invalid_request_error")
 		return
 	}
 
+	db := utils.GetDBFromContext(c)
 	user := &auth.User{Username: username}
 	userId := user.GetID(db)
-	var jobModel interface{}
-
-	err := globals.QueryRowDb(db, `
-		SELECT model
-		FROM conversation
-		WHERE user_id = ? AND task_id = ?
-		LIMIT 1
-	`, userId, id).Scan(&jobModel)
 
+	model, err := getVideoJobModel(db, userId, id)
 	if err != nil {
-		abortWithErrorResponse(c, fmt.Errorf("cannot find video job for video id %s", id), "invalid_request_error")
+		abortWithErrorResponse(c, err, "invalid_request_error")
 		return
 	}
 
-	var model string
-	if value, ok := jobModel.([]byte); ok {
-		model = string(value)
-	} else if str, ok := jobModel.(string); ok {
-		model = str
-	} else {
-		abortWithErrorResponse(c, fmt.Errorf("cannot parse model from conversation for video id %s", id), "invalid_request_error")
-		return
-	}
-	group := auth.GetGroup(db, user)
-	ticker := channel.ConduitInstance.GetTicker(model, group)
-	if ticker == nil || ticker.IsEmpty() {
-		abortWithErrorResponse(c, fmt.Errorf("cannot find channel for model %s", model), "invalid_request_error")
-		return
-	}
-
-	var lastErr error
-	for !ticker.IsDone() {
-		ch := ticker.Next()
-		if ch == nil {
-			break
-		}
-
-		endpoint := ch.GetEndpoint()
-		secret := ch.GetRandomSecret()
-		uri := fmt.Sprintf("%s/v1/videos/%s/content", endpoint, id)
-
-		headers := map[string]string{
-			"Authorization": fmt.Sprintf("Bearer %s", secret),
-		}
-
-		data, err := utils.HttpRaw(uri, http.MethodGet, headers, nil, []globals.ProxyConfig{ch.GetProxy()})
-		if err != nil || data == nil {
-			lastErr = err
-			continue
-		}
-
-		contentType := "video/mp4"
-		c.Data(http.StatusOK, contentType, data)
+	// the jobs created from the chat are not stored with the channel
+	source, _ := getVideoJobChannel(db, userId, id)
+	data, err := channel.NewVideoContentRequest(source, auth.GetGroup(db, user), &adaptercommon.VideoJobProps{
+		Model: model,
+		Id:    id,
+	})
+	if err != nil {
+		sendErrorResponse(c, err)
 		return
 	}
 
-	if lastErr == nil {
-		lastErr = fmt.Errorf("failed to fetch video content")
-	}
-	sendErrorResponse(c, lastErr)
+	contentType := "video/mp4"
+	c.Data(http.StatusOK, contentType, data)
 }
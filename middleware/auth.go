@@ -2,10 +2,12 @@ package middleware
 
 import (
 	"chat/auth"
+	"chat/globals"
 	"chat/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -28,10 +30,7 @@ func ProcessKey(c *gin.Context, key string) *auth.User {
 	cache := utils.GetCacheFromContext(c)
 
 	if utils.IsInBlackList(cache, addr) {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-			"code":    403,
-			"message": "ip in black list",
-		})
+		abortWithRelayError(c, globals.NewPermissionError("ip in black list"))
 		return nil
 	}
 
@@ -43,20 +42,66 @@ func ProcessKey(c *gin.Context, key string) *auth.User {
 	}
 
 	utils.IncrIP(cache, addr)
-	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-		"code":    401,
-		"message": "Access denied. Please provide correct api key.",
-	})
+	abortWithRelayError(c, globals.NewAuthenticationError("Access denied. Please provide correct api key."))
 	return nil
 }
 
-func ProcessAuthorization(c *gin.Context) *auth.User {
+// getAuthorizationKey returns the api key or the token of the request (without the `Bearer` prefix)
+func getAuthorizationKey(c *gin.Context) string {
 	k := strings.TrimSpace(c.GetHeader("Authorization"))
-	if k != "" {
-		if strings.HasPrefix(k, "Bearer ") {
-			k = strings.TrimPrefix(k, "Bearer ")
+	if k == "" {
+		// anthropic compatible api key header
+		k = strings.TrimSpace(c.GetHeader("x-api-key"))
+	}
+
+	if k == "" && isGeminiRequest(c) {
+		// gemini compatible api key header (or `key` query param), only the api keys are accepted
+		// since the query param is easily leaked (e.g. the access logs and the referer)
+		if key := strings.TrimSpace(utils.Multi(c.GetHeader("x-goog-api-key") != "", c.GetHeader("x-goog-api-key"), c.Query("key"))); strings.HasPrefix(key, "sk-") {
+			k = key
 		}
+	}
+
+	return strings.TrimPrefix(k, "Bearer ")
+}
 
+// isGeminiRequest returns whether the request is sent to the gemini compatible routes (`/v1beta`)
+func isGeminiRequest(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	if viper.GetBool("serve_static") {
+		path = strings.TrimPrefix(path, "/api")
+	}
+
+	return strings.HasPrefix(path, "/v1beta/")
+}
+
+// isApiKeyRequest returns whether the request is authorized by the api key (relay api clients)
+func isApiKeyRequest(c *gin.Context) bool {
+	return strings.HasPrefix(getAuthorizationKey(c), "sk-")
+}
+
+// abortWithRelayError aborts the relay request with the openai compatible error body
+func abortWithRelayError(c *gin.Context, err *globals.RelayError) {
+	if err.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(err.RetryAfter))
+	}
+
+	body := gin.H{
+		"message": err.Message,
+		"type":    err.Type,
+	}
+	if err.Param != "" {
+		body["param"] = err.Param
+	}
+	if err.Code != "" {
+		body["code"] = err.Code
+	}
+
+	c.AbortWithStatusJSON(err.Status, gin.H{"error": body})
+}
+
+func ProcessAuthorization(c *gin.Context) *auth.User {
+	if k := getAuthorizationKey(c); k != "" {
 		if strings.HasPrefix(k, "sk-") {
 			// api agent
 			return ProcessKey(c, k)
@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"chat/globals"
 	"chat/utils"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/spf13/viper"
+	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -67,6 +70,11 @@ func ThrottleMiddleware() gin.HandlerFunc {
 			rate, err := limiter.RateLimit(cache, ip, path)
 
 			if err != nil {
+				if isApiKeyRequest(c) {
+					abortWithRelayError(c, globals.NewRelayError(http.StatusServiceUnavailable, "chatnio_api_error", "", err.Error()))
+					return
+				}
+
 				c.JSON(200, gin.H{
 					"status": false,
 					"reason": err.Error(),
@@ -77,6 +85,13 @@ func ThrottleMiddleware() gin.HandlerFunc {
 			}
 
 			if rate {
+				if isApiKeyRequest(c) {
+					// relay api clients back off with the standard throttling response
+					abortWithRelayError(c, globals.NewRateLimitError(limiter.Duration, "You have sent too many requests. Please try again later."))
+					return
+				}
+
+				c.Header("Retry-After", strconv.Itoa(limiter.Duration))
 				c.JSON(200, gin.H{
 					"status": false,
 					"reason": "You have sent too many requests. Please try again later.",
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"encoding/binary"
+	"regexp"
+	"strconv"
+)
+
+// defaultAudioByteRate is the fallback byte rate (128 kbps) to estimate the duration of the compressed audio
+const defaultAudioByteRate = 16000
+
+var subtitleTimestampExp = regexp.MustCompile(`(\d{2}):(\d{2}):(\d{2})[,.](\d{3})`)
+
+// GetSubtitleDuration returns the latest timestamp (in seconds) of the srt / vtt subtitle
+func GetSubtitleDuration(data string) float32 {
+	var duration float32
+	for _, match := range subtitleTimestampExp.FindAllStringSubmatch(data, -1) {
+		hour, _ := strconv.Atoi(match[1])
+		minute, _ := strconv.Atoi(match[2])
+		second, _ := strconv.Atoi(match[3])
+		milli, _ := strconv.Atoi(match[4])
+
+		value := float32(hour*3600+minute*60+second) + float32(milli)/1000
+		if value > duration {
+			duration = value
+		}
+	}
+
+	return duration
+}
+
+// EstimateAudioDuration returns the duration (in seconds) of the audio file,
+// it is exact for wav files and estimated by the file size for the other formats
+func EstimateAudioDuration(data []byte) float32 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	if len(data) > 44 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE" {
+		// wav header: byte rate is at offset 28 (little endian)
+		if rate := binary.LittleEndian.Uint32(data[28:32]); rate > 0 {
+			return float32(len(data)-44) / float32(rate)
+		}
+	}
+
+	return float32(len(data)) / defaultAudioByteRate
+}
@@ -12,6 +12,8 @@ type Charge interface {
 	GetModels() []string
 	GetInput() float32
 	GetOutput() float32
+	GetCacheRead() float32
+	GetCacheWrite() float32
 	SupportAnonymous() bool
 	IsBilling() bool
 	IsBillingType(t string) bool
@@ -22,6 +24,7 @@ type Buffer struct {
 	Model           string                `json:"model"`
 	Quota           float32               `json:"quota"`
 	Data            string                `json:"data"`
+	Reasoning       string                `json:"reasoning"`
 	Latest          string                `json:"latest"`
 	Cursor          int                   `json:"cursor"`
 	Times           int                   `json:"times"`
@@ -35,6 +38,15 @@ type Buffer struct {
 	TokenName       string                `json:"-"`
 	Charge          Charge                `json:"-"`
 	VisionRecall    bool                  `json:"-"`
+	Logprobs        []interface{}         `json:"logprobs"`
+	Choices         map[int]*BufferChoice `json:"choices"`
+	Usage           *globals.ChunkUsage   `json:"usage"`
+}
+
+// BufferChoice is the extra choice of the buffer (index > 0, only when n > 1)
+type BufferChoice struct {
+	Data     string        `json:"data"`
+	Logprobs []interface{} `json:"logprobs"`
 }
 
 func initInputToken(model string, history []globals.Message) int {
@@ -107,13 +119,85 @@ func (b *Buffer) WriteChunk(data *globals.Chunk) string {
 		return ""
 	}
 
+	if data.Index > 0 {
+		b.SetUsage(data.Usage)
+		b.WriteChoice(data)
+		return data.Content
+	}
+
+	b.SetUsage(data.Usage)
+	b.WriteReasoning(data.Reasoning)
 	b.Write(data.Content)
+	b.AddLogprobs(data.Logprobs)
 	b.AddToolCalls(data.ToolCall)
 	b.SetFunctionCall(data.FunctionCall)
 
 	return data.Content
 }
 
+// WriteReasoning writes the reasoning content of the first choice, it is billed as the output tokens
+func (b *Buffer) WriteReasoning(data string) {
+	if len(data) == 0 {
+		return
+	}
+
+	b.Reasoning += data
+	b.Times++
+}
+
+// WriteChoice writes the chunk of the extra choice (the tool calls of the extra choices are not supported)
+func (b *Buffer) WriteChoice(data *globals.Chunk) {
+	if b.Choices == nil {
+		b.Choices = make(map[int]*BufferChoice)
+	}
+
+	choice, ok := b.Choices[data.Index]
+	if !ok {
+		choice = &BufferChoice{}
+		b.Choices[data.Index] = choice
+	}
+
+	choice.Data += data.Content
+	if data.Logprobs != nil {
+		choice.Logprobs = append(choice.Logprobs, data.Logprobs.Content...)
+	}
+	b.Times++
+}
+
+func (b *Buffer) AddLogprobs(logprobs *globals.ChoiceLogprobs) {
+	if logprobs == nil {
+		return
+	}
+
+	b.Logprobs = append(b.Logprobs, logprobs.Content...)
+}
+
+// GetLogprobs returns the logprobs of the first choice, nil if logprobs is not enabled
+func (b *Buffer) GetLogprobs() *globals.ChoiceLogprobs {
+	if b.Logprobs == nil {
+		return nil
+	}
+
+	return &globals.ChoiceLogprobs{Content: b.Logprobs}
+}
+
+// GetChoices returns the extra choices ordered by the choice index (index 1 at position 0)
+func (b *Buffer) GetChoices() []BufferChoice {
+	size := 0
+	for index := range b.Choices {
+		if index > size {
+			size = index
+		}
+	}
+
+	choices := make([]BufferChoice, size)
+	for index, choice := range b.Choices {
+		choices[index-1] = *choice
+	}
+
+	return choices
+}
+
 func (b *Buffer) GetChunk() string {
 	return b.Latest
 }
@@ -246,6 +330,10 @@ func (b *Buffer) ToChargeInfo() string {
 		)
 	case globals.TimesBilling:
 		return fmt.Sprintf("%f quota per request\n", b.Charge.GetLimit())
+	case globals.SecondBilling:
+		return fmt.Sprintf("%0.4f quota / second of audio\n", b.Charge.GetInput())
+	case globals.CharacterBilling:
+		return fmt.Sprintf("%0.4f quota / 1k characters\n", b.Charge.GetInput())
 	case globals.NonBilling:
 		return "no cost"
 	}
@@ -261,6 +349,21 @@ func (b *Buffer) Read() string {
 	return b.Data
 }
 
+// GetReasoning returns the reasoning content of the first choice, empty if the model does not reason
+func (b *Buffer) GetReasoning() string {
+	return b.Reasoning
+}
+
+// ReadWithReasoning returns the data with the reasoning content wrapped in the think block (for the stored conversations)
+func (b *Buffer) ReadWithReasoning(_default string) string {
+	data := b.ReadWithDefault(_default)
+	if len(strings.TrimSpace(b.Reasoning)) == 0 {
+		return data
+	}
+
+	return fmt.Sprintf("<think>\n%s\n</think>\n\n%s", strings.TrimSpace(b.Reasoning), data)
+}
+
 func (b *Buffer) ReadBytes() []byte {
 	return []byte(b.Data)
 }
@@ -280,18 +383,105 @@ func (b *Buffer) SetInputTokens(tokens int) {
 	b.InputTokens = tokens
 }
 
+// SetInputUsage overrides the estimated input tokens with the upstream reported tokens and recounts the input quota,
+// the reported cached tokens are counted at the cache prices
+func (b *Buffer) SetInputUsage(tokens int) {
+	if tokens <= 0 {
+		return
+	}
+
+	b.InputTokens = tokens
+	if b.Usage != nil {
+		b.Quota = CountCachedInputQuota(b.Charge, tokens, b.Usage.CacheReadTokens, b.Usage.CacheWriteTokens)
+	} else {
+		b.Quota = CountInputQuota(b.Charge, tokens)
+	}
+}
+
+// SetUsage merges the upstream reported usage into the buffer, the reported tokens are preferred over the estimated ones
+func (b *Buffer) SetUsage(usage *globals.ChunkUsage) {
+	if usage == nil {
+		return
+	}
+
+	if b.Usage == nil {
+		b.Usage = &globals.ChunkUsage{}
+	}
+
+	if usage.CacheReadTokens > 0 {
+		b.Usage.CacheReadTokens = usage.CacheReadTokens
+	}
+	if usage.CacheWriteTokens > 0 {
+		b.Usage.CacheWriteTokens = usage.CacheWriteTokens
+	}
+	if usage.InputTokens > 0 {
+		b.Usage.InputTokens = usage.InputTokens
+	}
+	if b.Usage.InputTokens > 0 && (usage.InputTokens > 0 || usage.CacheReadTokens > 0 || usage.CacheWriteTokens > 0) {
+		b.SetInputUsage(b.Usage.InputTokens)
+	}
+	if usage.OutputTokens > 0 {
+		b.Usage.OutputTokens = usage.OutputTokens
+	}
+	if usage.ReasoningTokens > 0 {
+		b.Usage.ReasoningTokens = usage.ReasoningTokens
+	}
+}
+
+// GetUsage returns the upstream reported usage, nil if the upstream does not report it
+func (b *Buffer) GetUsage() *globals.ChunkUsage {
+	return b.Usage
+}
+
+// HasOutputUsage returns whether the upstream reported the output tokens
+func (b *Buffer) HasOutputUsage() bool {
+	return b.Usage != nil && b.Usage.OutputTokens > 0
+}
+
+// AddAudioUsage adds the quota of the audio usage for the second-billing and character-billing charges
+func (b *Buffer) AddAudioUsage(seconds float32, characters int) {
+	b.Quota += CountAudioQuota(b.Charge, seconds, characters)
+}
+
+// AddImageUsage adds the quota of the generated images for the times-billing charges (per-image billing)
+func (b *Buffer) AddImageUsage(images int) {
+	b.Quota += CountImageQuota(b.Charge, images)
+}
+
 func (b *Buffer) CountInputToken() int {
 	return b.InputTokens
 }
 
 func (b *Buffer) CountOutputToken(running bool) int {
+	if b.HasOutputUsage() {
+		// prefer the upstream reported output tokens
+		return b.Usage.OutputTokens
+	}
+
 	if running {
 		// performance optimization:
 		// if the buffer is still running, the output token counted using the times instead
 		return b.Times
 	}
 
-	return NumTokensFromResponse(b.Read(), b.Model)
+	tokens := NumTokensFromResponse(b.Read(), b.Model) + b.CountReasoningToken()
+	for _, choice := range b.Choices {
+		tokens += NumTokensFromResponse(choice.Data, b.Model)
+	}
+
+	return tokens
+}
+
+// CountReasoningToken returns the reasoning tokens, the upstream reported tokens are preferred over the estimated ones
+func (b *Buffer) CountReasoningToken() int {
+	if b.Usage != nil && b.Usage.ReasoningTokens > 0 {
+		return b.Usage.ReasoningTokens
+	}
+
+	if len(b.Reasoning) == 0 {
+		return 0
+	}
+	return NumTokensFromResponse(b.Reasoning, b.Model)
 }
 
 func (b *Buffer) CountToken() int {
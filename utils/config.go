@@ -44,6 +44,12 @@ func ReadConf() {
 		globals.HttpMaxTimeout = time.Second * time.Duration(timeout)
 		globals.Debug(fmt.Sprintf("[service] http client timeout set to %ds from env", timeout))
 	}
+
+	if viper.IsSet("stream_heartbeat") {
+		heartbeat := viper.GetInt("stream_heartbeat")
+		globals.StreamHeartbeat = time.Second * time.Duration(max(heartbeat, 0))
+		globals.Debug(fmt.Sprintf("[service] stream heartbeat interval set to %ds from env", heartbeat))
+	}
 }
 
 // normalizeLinuxDoConfig ensures legacy linuxdo keys without underscores map to the canonical linux_do keys.
@@ -125,6 +125,20 @@ func ConvertToBase64(url string) (string, error) {
 	return Base64EncodeBytes(data), nil
 }
 
+// ParseDataUrl returns the mime type and the base64 data of the data url (e.g. data:application/pdf;base64,...)
+func ParseDataUrl(url string) (string, string, bool) {
+	if !strings.HasPrefix(url, "data:") {
+		return "", "", false
+	}
+
+	segments := SafeSplit(strings.TrimPrefix(url, "data:"), ",", 2)
+	if segments[1] == "" || !strings.HasSuffix(segments[0], ";base64") {
+		return "", "", false
+	}
+
+	return strings.TrimSuffix(segments[0], ";base64"), segments[1], true
+}
+
 func (i *Image) GetWidth() int {
 	return i.Object.Bounds().Max.X
 }
@@ -261,3 +275,24 @@ func StoreImage(url string) string {
 
 	return url
 }
+
+// StoreBase64Image stores the raw base64 image and returns the url, the data uri is returned if the image store is disabled
+func StoreBase64Image(b64 string) string {
+	data, err := Base64Decode(b64)
+	if err != nil {
+		return ""
+	}
+
+	contentType := http.DetectContentType(data)
+	if globals.AcceptImageStore {
+		hash := fmt.Sprintf("%s.%s", Md5Encrypt(b64), strings.TrimPrefix(contentType, "image/"))
+
+		if err := os.WriteFile(fmt.Sprintf("storage/attachments/%s", hash), data, 0644); err != nil {
+			globals.Warn(fmt.Sprintf("[utils] save image error: %s", err.Error()))
+		} else {
+			return fmt.Sprintf("%s/attachments/%s", globals.NotifyUrl, hash)
+		}
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", contentType, b64)
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+)
+
+type MultipartFile struct {
+	Field string
+	Name  string
+	Data  []byte
+}
+
+// NewMultipartBody creates the multipart form body, returns the body reader and the content type (with boundary)
+func NewMultipartBody(fields map[string]string, files ...MultipartFile) (io.Reader, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.Field, file.Name)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if _, err := part.Write(file.Data); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for key, value := range fields {
+		if len(value) == 0 {
+			continue
+		}
+
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body, writer.FormDataContentType(), nil
+}
+
+// ReadFormFile reads the uploaded file from the multipart form, returns the file data and the file name
+func ReadFormFile(header *multipart.FileHeader) ([]byte, string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, header.Filename, nil
+}
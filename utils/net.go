@@ -324,7 +324,7 @@ func ConvertBody(body interface{}) (form io.Reader) {
 	return form
 }
 
-func EventSource(method string, uri string, headers map[string]string, body interface{}, callback func(string) error, config ...globals.ProxyConfig) error {
+func EventSource(ctx context.Context, method string, uri string, headers map[string]string, body interface{}, callback func(string) error, config ...globals.ProxyConfig) error {
 	// panic recovery
 	defer func() {
 		if err := recover(); err != nil {
@@ -340,7 +340,7 @@ func EventSource(method string, uri string, headers map[string]string, body inte
 	}
 
 	client := newClient(config)
-	req, err := http.NewRequest(method, uri, ConvertBody(body))
+	req, err := http.NewRequestWithContext(ctx, method, uri, ConvertBody(body))
 	if err != nil {
 		if globals.DebugMode {
 			globals.Debug(fmt.Sprintf("[http-stream] failed to create request: %s", err))
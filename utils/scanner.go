@@ -4,20 +4,24 @@ import (
 	"bufio"
 	"bytes"
 	"chat/globals"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"runtime/debug"
 	"strings"
+	"time"
 )
 
 type EventScannerProps struct {
+	Ctx      context.Context // the request is aborted once the context is canceled (e.g. the client is gone)
 	Method   string
 	Uri      string
 	Headers  map[string]string
 	Body     interface{}
 	Callback func(string) error
 	FullSSE  bool
+	Timeout  globals.TimeoutConfig // the stalled stream is aborted to fail over to the next channel
 }
 
 type EventScannerError struct {
@@ -25,6 +29,45 @@ type EventScannerError struct {
 	Body  string
 }
 
+func (p *EventScannerProps) GetContext() context.Context {
+	if p.Ctx == nil {
+		return context.Background()
+	}
+	return p.Ctx
+}
+
+// streamWatchdog cancels the stream once the upstream is stalled longer than the timeout of the current stage
+type streamWatchdog struct {
+	timer  *time.Timer
+	cancel context.CancelCauseFunc
+}
+
+func (w *streamWatchdog) reset(timeout time.Duration, stage string) {
+	w.stop()
+	if timeout <= 0 {
+		return
+	}
+
+	w.timer = time.AfterFunc(timeout, func() {
+		w.cancel(fmt.Errorf("upstream %s timeout (%s)", stage, timeout))
+	})
+}
+
+func (w *streamWatchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// getCauseError returns the cause of the canceled context (e.g. the timeout of the watchdog) instead of `context canceled`
+func getCauseError(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil {
+		return cause
+	}
+	return err
+}
+
 func getErrorBody(resp *http.Response) string {
 	if resp == nil {
 		return ""
@@ -50,8 +93,15 @@ func EventScanner(props *EventScannerProps, config ...globals.ProxyConfig) *Even
 		globals.Debug(fmt.Sprintf("[sse] event source: %s %s\nheaders: %v\nbody: %v", props.Method, props.Uri, Marshal(props.Headers), Marshal(props.Body)))
 	}
 
+	ctx, cancel := context.WithCancelCause(props.GetContext())
+	defer cancel(nil)
+
+	watchdog := &streamWatchdog{cancel: cancel}
+	defer watchdog.stop()
+	watchdog.reset(props.Timeout.GetConnect(), "connect")
+
 	client := newClient(config)
-	req, err := http.NewRequest(props.Method, props.Uri, ConvertBody(props.Body))
+	req, err := http.NewRequestWithContext(ctx, props.Method, props.Uri, ConvertBody(props.Body))
 	if err != nil {
 		if globals.DebugMode {
 			globals.Debug(fmt.Sprintf("[sse] failed to create request: %s", err))
@@ -68,10 +118,11 @@ func EventScanner(props *EventScannerProps, config ...globals.ProxyConfig) *Even
 			globals.Debug(fmt.Sprintf("[sse] failed to send request: %s", err))
 		}
 
-		return &EventScannerError{Error: err}
+		return &EventScannerError{Error: getCauseError(ctx, err)}
 	}
 
 	defer resp.Body.Close()
+	watchdog.reset(props.Timeout.GetFirstToken(), "first token")
 
 	if resp.StatusCode >= 400 {
 		// for error response
@@ -86,11 +137,30 @@ func EventScanner(props *EventScannerProps, config ...globals.ProxyConfig) *Even
 		}
 	}
 
+	callback := func(data string) error {
+		// the watchdog is paused while the chunk is handled (e.g. waiting for the slow client)
+		watchdog.stop()
+		if err := props.Callback(data); err != nil {
+			return err
+		}
+
+		watchdog.reset(props.Timeout.GetIdle(), "idle")
+		return nil
+	}
+
+	var result *EventScannerError
 	if props.FullSSE {
-		return processFullSSE(resp.Body, props.Callback)
+		result = processFullSSE(resp.Body, callback)
+	} else {
+		result = processLegacySSE(resp.Body, callback)
+	}
+
+	if err := context.Cause(ctx); err != nil && result == nil {
+		// the body reading is interrupted by the canceled context or the watchdog rather than the end of the stream
+		return &EventScannerError{Error: err}
 	}
 
-	return processLegacySSE(resp.Body, props.Callback)
+	return result
 }
 
 func processFullSSE(body io.ReadCloser, callback func(string) error) *EventScannerError {
@@ -41,6 +41,9 @@ func checkWriter(writer io.Writer) stringWriter {
 
 func encode(writer io.Writer, event StreamEvent) error {
 	w := checkWriter(writer)
+	if len(event.Event) > 0 {
+		w.writeString(fmt.Sprintf("event: %s\n", event.Event))
+	}
 	return writeData(w, event.Data)
 }
 
@@ -73,8 +76,24 @@ func NewEvent(data interface{}) StreamEvent {
 	}
 }
 
+// NewNamedEvent creates the event with the event type (e.g. anthropic `message_start`, `content_block_delta`)
+func NewNamedEvent(event string, data interface{}) StreamEvent {
+	return StreamEvent{
+		Event: event,
+		Data:  fmt.Sprintf("data: %s", Marshal(data)),
+	}
+}
+
 func NewEndEvent() StreamEvent {
 	return StreamEvent{
 		Data: "data: [DONE]",
 	}
 }
+
+// WriteHeartbeat writes the sse comment, which is ignored by the clients but keeps the idle connection alive
+func WriteHeartbeat(w http.ResponseWriter) error {
+	StreamEvent{}.WriteContentType(w)
+
+	_, err := io.WriteString(w, ": ping\n\n")
+	return err
+}
@@ -98,6 +98,20 @@ func CountInputQuota(charge Charge, token int) float32 {
 	return 0
 }
 
+// CountCachedInputQuota counts the input quota with the cached tokens (included in the input tokens) at the cache prices
+func CountCachedInputQuota(charge Charge, token int, read int, write int) float32 {
+	if charge.GetType() != globals.TokenBilling {
+		return 0
+	}
+
+	uncached := token - read - write
+	if uncached < 0 {
+		uncached = 0
+	}
+
+	return (float32(uncached)*charge.GetInput() + float32(read)*charge.GetCacheRead() + float32(write)*charge.GetCacheWrite()) / 1000
+}
+
 func CountOutputToken(charge Charge, token int) float32 {
 	switch charge.GetType() {
 	case globals.TokenBilling:
@@ -108,3 +122,24 @@ func CountOutputToken(charge Charge, token int) float32 {
 		return 0
 	}
 }
+
+// CountAudioQuota counts the quota of the audio usage (seconds of input audio or characters of input text)
+func CountAudioQuota(charge Charge, seconds float32, characters int) float32 {
+	switch charge.GetType() {
+	case globals.SecondBilling:
+		return seconds * charge.GetInput()
+	case globals.CharacterBilling:
+		return float32(characters) / 1000 * charge.GetInput()
+	default:
+		return 0
+	}
+}
+
+// CountImageQuota counts the quota of the extra generated images, the first image is counted as the times-billing request
+func CountImageQuota(charge Charge, images int) float32 {
+	if charge.GetType() == globals.TimesBilling && images > 1 {
+		return float32(images-1) * charge.GetOutput()
+	}
+
+	return 0
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"chat/globals"
+	"context"
 	"database/sql"
 	"io"
 	"net/http"
@@ -52,6 +53,8 @@ type WebSocket struct {
 	Conn       *websocket.Conn
 	MaxTimeout time.Duration
 	Closed     bool
+
+	stop func() bool // stops closing the connection on the context cancellation (only for the clients)
 }
 
 var defaultMaxTimeout = 15 * time.Minute
@@ -90,14 +93,19 @@ func NewWebsocket(c *gin.Context, strict bool) *WebSocket {
 	}
 }
 
-func NewWebsocketClient(url string) *WebSocket {
-	if conn, _, err := websocket.DefaultDialer.Dial(url, nil); err != nil {
+// NewWebsocketClient dials the upstream websocket, the connection is closed once the context is canceled
+// (which interrupts the pending reads immediately)
+func NewWebsocketClient(ctx context.Context, url string) *WebSocket {
+	if conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil); err != nil {
 		return nil
 	} else {
 		instance := &WebSocket{
 			Conn: conn,
 		}
 		instance.Init()
+		instance.stop = context.AfterFunc(ctx, func() {
+			_ = conn.Close()
+		})
 		return instance
 	}
 }
@@ -140,6 +148,10 @@ func (w *WebSocket) Close() error {
 }
 
 func (w *WebSocket) DeferClose() {
+	if w.stop != nil {
+		w.stop()
+	}
+
 	decreaseConns()
 	if err := w.Close(); err != nil {
 		return